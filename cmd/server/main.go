@@ -1,15 +1,39 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"project-root/config"
 	"project-root/internal/api"
+	"project-root/internal/auth"
+	"project-root/internal/authz"
+	"project-root/internal/bootstrap"
+	"project-root/internal/events"
+	"project-root/internal/health"
 	"project-root/internal/kafka"
+	"project-root/internal/lifecycle"
+	"project-root/internal/outbox"
+	"project-root/internal/ratelimit"
 	"project-root/internal/storage"
+	"project-root/internal/tlsconfig"
+	"project-root/internal/tracing"
+	"project-root/pkg/logger"
 )
 
+// storageStack is a backend wrapped with the configured decorators, quotas included.
+type storageStack struct {
+	adapter storage.StorageAdapter
+	dedup   *storage.DedupStorage
+	quota   *storage.QuotaStorage
+}
+
 func main() {
 
 	cfg, err := config.LoadConfig()
@@ -17,31 +41,325 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	var storageAdapter storage.StorageAdapter
-	if cfg.Azure.AccountName != "" && cfg.Azure.AccountKey != "" {
-		storageAdapter, err = storage.NewAzureStorage(cfg.Azure.AccountName, cfg.Azure.AccountKey, cfg.Azure.ContainerName)
+	shutdownLogging, err := logger.Setup(bootstrap.LoggingConfig(cfg))
+	if err != nil {
+		log.Fatalf("Failed to initialize logging: %v", err)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		File:        cfg.Tracing.File,
+		ServiceName: "storage-server",
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
+	backend, err := bootstrap.NewBackend(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	checker := health.NewChecker(cfg.Health.Timeout, cfg.Health.Timeouts)
+	checker.Add(health.Check{Name: "storage", Probe: func(ctx context.Context) error {
+		return storage.CheckHealth(ctx, backend)
+	}})
+
+	stack, err := newStorageStack(cfg, backend)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	storageAdapter := stack.adapter
+
+	var cache *storage.CachingStorage
+	if cfg.Cache.Enabled {
+		if cfg.Encryption.Enabled && !cfg.Cache.AllowPlaintext {
+			log.Fatalf("The cache stores decrypted files on local disk; set cache.allowPlaintext to use it with encryption")
+		}
+		cache, err = storage.NewCachingStorage(storageAdapter, storage.CacheConfig{
+			Dir:             cfg.Cache.Dir,
+			MaxBytes:        cfg.Cache.MaxBytes,
+			RevalidateAfter: cfg.Cache.RevalidateAfter,
+		})
 		if err != nil {
-			log.Fatalf("Failed to initialize Azure Storage: %v", err)
+			log.Fatalf("Failed to initialize cache: %v", err)
+		}
+		storageAdapter = cache
+	}
+
+	var tenants *storage.TenantStorage
+	if cfg.Tenancy.Enabled {
+		// Without authentication there is nothing trustworthy to take the tenant from.
+		if !cfg.Auth.Enabled {
+			log.Fatalf("Invalid tenancy configuration: tenancy.enabled requires auth.enabled")
 		}
-		log.Println("Using Azure Storage")
-	} else {
-		storageAdapter = storage.NewLocalStorage("./local_data")
-		log.Println("Azure credentials missing, using Local Storage")
+		dedicated := make(map[string]storage.StorageAdapter, len(cfg.Tenancy.Containers))
+		for tenantID, containerName := range cfg.Tenancy.Containers {
+			if err := storage.ValidateTenantID(tenantID); err != nil {
+				log.Fatalf("Invalid tenancy configuration: %v", err)
+			}
+			tenantBackend, err := bootstrap.NewAzureStorage(cfg, containerName)
+			if err != nil {
+				log.Fatalf("Failed to initialize container for tenant %s: %v", tenantID, err)
+			}
+			checker.Add(health.Check{Name: "storage/" + tenantID, Probe: tenantBackend.HealthCheck})
+			tenantStack, err := newStorageStack(cfg, bootstrap.Instrumented(tenantBackend, "azure"))
+			if err != nil {
+				log.Fatalf("Failed to initialize storage for tenant %s: %v", tenantID, err)
+			}
+			dedicated[tenantID] = tenantStack.adapter
+		}
+		tenants = storage.NewTenantStorage(storageAdapter, cfg.Tenancy.RootPrefix, dedicated)
+		storageAdapter = tenants
+		slog.Info("Multi-tenancy enabled", "rootPrefix", cfg.Tenancy.RootPrefix, "dedicatedContainers", len(dedicated))
+	}
+
+	groupID := cfg.Kafka.ConsumerGroup
+	if cache != nil {
+		// Every instance needs its own group to see all invalidation events.
+		hostname, _ := os.Hostname()
+		groupID = fmt.Sprintf("%s-cache-%s", cfg.Kafka.ConsumerGroup, hostname)
 	}
 
-	kafkaClient, err := kafka.NewKafkaClient(cfg.Kafka.Brokers, cfg.Kafka.ConsumerGroup)
+	kafkaClient, err := kafka.NewKafkaClient(bootstrap.KafkaConfig(cfg, groupID))
 	if err != nil {
 		log.Fatalf("Failed to initialize Kafka: %v", err)
 	}
-	defer kafkaClient.Close()
+	checker.Add(health.Check{Name: "kafka", Probe: kafkaClient.Ping})
+	if err := bootstrap.ConfigureSerializers(cfg, kafkaClient); err != nil {
+		log.Fatalf("Invalid Kafka formats: %v", err)
+	}
+
+	lc := lifecycle.New()
+	// Added first so they stop last, after the logs and spans of everything else are recorded.
+	lc.Add(lifecycle.Component{Name: "logging", Stop: shutdownLogging})
+	lc.Add(lifecycle.Component{Name: "tracing", Stop: shutdownTracing})
+
+	var eventOutbox *outbox.Outbox
+	if cfg.Outbox.Enabled {
+		eventOutbox, err = outbox.Open(outbox.Config{
+			Path:         cfg.Outbox.Path,
+			RetryBackoff: cfg.Outbox.RetryBackoff,
+			MaxBackoff:   cfg.Outbox.MaxBackoff,
+		})
+		if err != nil {
+			log.Fatalf("Failed to open outbox: %v", err)
+		}
+		// Closed after Kafka, so async messages failing during the final flush are still requeued.
+		lc.Add(lifecycle.Component{Name: "outbox", Stop: func(context.Context) error {
+			return eventOutbox.Close()
+		}})
+		kafkaClient.SetFailureHandler(eventOutbox.Requeue)
+	}
+
+	lc.Add(lifecycle.Component{
+		Name: "kafka",
+		Start: func(context.Context) error {
+			if cache == nil {
+				return nil
+			}
+			return kafkaClient.StartConsumers(context.Background(), []string{cfg.Kafka.Topics.StorageEvents})
+		},
+		// Closing after the HTTP server has drained lets in-flight requests publish their events.
+		Stop: func(context.Context) error {
+			kafkaClient.Close()
+			return nil
+		},
+	})
+
+	if eventOutbox != nil {
+		lc.Add(outboxRelay(eventOutbox, kafkaClient))
+	}
+
+	if cache != nil {
+		invalidate := func(_ context.Context, event *events.StorageEvent) error {
+			path := event.Path
+			if tenants != nil {
+				// Event paths are tenant-relative; dedicated containers are not cached.
+				namespace := tenants.Namespace(event.TenantID)
+				if event.TenantID == "" || namespace == "" {
+					return nil
+				}
+				path = namespace + "/" + path
+			}
+			// A deleted directory drops every cached file under it.
+			cache.Invalidate(path)
+			return nil
+		}
+		kafkaClient.RegisterHandler(events.FileUploaded, invalidate)
+		kafkaClient.RegisterHandler(events.FileDeleted, invalidate)
+		kafkaClient.RegisterHandler(events.DirectoryDeleted, invalidate)
+	}
+
+	var authenticator auth.Authenticator
+	if cfg.Auth.Enabled {
+		authenticator, err = newAuthenticator(cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize authentication: %v", err)
+		}
+	}
+
+	var policy *authz.Engine
+	if cfg.Authz.Enabled {
+		policy, err = authz.NewEngine(cfg.Authz.PolicyFile)
+		if err != nil {
+			log.Fatalf("Failed to load authorization policy: %v", err)
+		}
+		lc.Add(lifecycle.Background("policy watcher", func(ctx context.Context) {
+			policy.Watch(ctx, cfg.Authz.ReloadInterval)
+		}))
+	}
+
+	if stack.quota != nil {
+		lc.Add(lifecycle.Background("quota usage watcher", func(ctx context.Context) {
+			stack.quota.Watch(ctx, cfg.Quota.RescanInterval)
+		}))
+	}
 
 	apiInstance := &api.API{
-		Storage: storageAdapter,
-		Kafka:   kafkaClient,
+		Storage:         storageAdapter,
+		Kafka:           kafkaClient,
+		Events:          events.NewFactory("storage-server"),
+		EventsTopic:     cfg.Kafka.Topics.StorageEvents,
+		Outbox:          eventOutbox,
+		ServeCompressed: cfg.Compression.Enabled && cfg.Compression.ServeEncoded,
+		Dedup:           stack.dedup,
+		Quota:           stack.quota,
+		Tenants:         tenants,
+		Auth:            authenticator,
+		Authz:           policy,
+		Limits: api.Limits{
+			PerIP:          ratelimit.New(cfg.Limits.PerIP.RequestsPerSecond, cfg.Limits.PerIP.Burst),
+			PerIdentity:    ratelimit.New(cfg.Limits.PerIdentity.RequestsPerSecond, cfg.Limits.PerIdentity.Burst),
+			ReadBandwidth:  ratelimit.New(cfg.Limits.ReadBytesPerSecond, 0),
+			WriteBandwidth: ratelimit.New(cfg.Limits.WriteBytesPerSecond, 0),
+			MaxUploadBytes: cfg.Limits.MaxUploadBytes,
+		},
+		Health:  checker,
+		Metrics: promhttp.Handler(),
 	}
 
 	r := api.SetupRoutes(apiInstance)
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid server.trustedProxies: %v", err)
+	}
 	serverAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-	log.Printf("Starting server on %s", serverAddr)
-	r.Run(serverAddr)
+	server := &http.Server{Addr: serverAddr, Handler: r}
+
+	if tlsConfig := cfg.Server.TLS; tlsConfig.Enabled {
+		certs, err := tlsconfig.New(tlsconfig.Config{
+			CertFile:     tlsConfig.CertFile,
+			KeyFile:      tlsConfig.KeyFile,
+			MinVersion:   tlsConfig.MinVersion,
+			CipherPolicy: tlsConfig.CipherPolicy,
+			CipherSuites: tlsConfig.CipherSuites,
+			ClientCAFile: tlsConfig.ClientCAFile,
+			ClientAuth:   tlsConfig.ClientAuth,
+		})
+		if err != nil {
+			log.Fatalf("Failed to initialize TLS: %v", err)
+		}
+		server.TLSConfig = certs.TLSConfig()
+		lc.Add(lifecycle.Background("certificate watcher", func(ctx context.Context) {
+			certs.Watch(ctx, tlsConfig.ReloadInterval)
+		}))
+	}
+	lc.Add(lifecycle.HTTPServer(lc, server))
+
+	if err := lc.Run(context.Background(), cfg.Lifecycle.ShutdownTimeout); err != nil {
+		log.Fatalf("Server stopped: %v", err)
+	}
+	slog.Info("Server stopped")
+}
+
+// newAuthenticator accepts verified client certificates, the configured API keys and, when a
+// secret or JWKS file is set, JWTs.
+func newAuthenticator(cfg *config.Config) (auth.Authenticator, error) {
+	var chain auth.Chain
+	if len(cfg.Auth.ClientCerts) > 0 {
+		certs := make([]auth.ClientCert, 0, len(cfg.Auth.ClientCerts))
+		for _, cert := range cfg.Auth.ClientCerts {
+			certs = append(certs, auth.ClientCert(cert))
+		}
+		clientCerts, err := auth.NewClientCertAuthenticator(certs)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, clientCerts)
+	}
+
+	keys := make([]auth.APIKey, 0, len(cfg.Auth.APIKeys))
+	for _, key := range cfg.Auth.APIKeys {
+		keys = append(keys, auth.APIKey(key))
+	}
+	apiKeys, err := auth.NewAPIKeyAuthenticator(keys)
+	if err != nil {
+		return nil, err
+	}
+	chain = append(chain, apiKeys)
+
+	jwtConfig := cfg.Auth.JWT
+	if jwtConfig.HMACSecret != "" || jwtConfig.JWKSFile != "" {
+		jwt, err := auth.NewJWTAuthenticator(auth.JWTConfig{
+			HMACSecret:   []byte(jwtConfig.HMACSecret),
+			JWKSFile:     jwtConfig.JWKSFile,
+			Issuer:       jwtConfig.Issuer,
+			Audience:     jwtConfig.Audience,
+			SubjectClaim: jwtConfig.SubjectClaim,
+			TenantClaim:  jwtConfig.TenantClaim,
+			RolesClaim:   jwtConfig.RolesClaim,
+			Leeway:       jwtConfig.Leeway,
+		})
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, jwt)
+	}
+	return chain, nil
+}
+
+// newStorageStack wraps backend with the shared decorators and, as configured, quotas.
+func newStorageStack(cfg *config.Config, backend storage.StorageAdapter) (*storageStack, error) {
+	shared, err := bootstrap.NewStack(cfg, backend)
+	if err != nil {
+		return nil, err
+	}
+	stack := &storageStack{adapter: shared.Adapter, dedup: shared.Dedup}
+
+	if cfg.Quota.Enabled {
+		stack.quota = storage.NewQuotaStorage(stack.adapter, storage.QuotaConfig{
+			DefaultUser: storage.QuotaLimit(cfg.Quota.DefaultUser),
+			Users:       quotaLimits(cfg.Quota.Users),
+			Prefixes:    quotaLimits(cfg.Quota.Prefixes),
+		})
+		stack.adapter = stack.quota
+	}
+
+	return stack, nil
+}
+
+func quotaLimits(limits map[string]config.QuotaLimit) map[string]storage.QuotaLimit {
+	converted := make(map[string]storage.QuotaLimit, len(limits))
+	for name, limit := range limits {
+		converted[name] = storage.QuotaLimit(limit)
+	}
+	return converted
+}
+
+// outboxRelay delivers the outbox to Kafka while the server runs. Added after the Kafka
+// client, it stops before the client closes, making a last pass for events recorded by
+// requests that finished during shutdown; anything left is delivered after the next start.
+func outboxRelay(eventOutbox *outbox.Outbox, kafkaClient *kafka.KafkaClient) lifecycle.Component {
+	relay := lifecycle.Background("outbox relay", func(ctx context.Context) {
+		eventOutbox.Run(ctx, kafkaClient)
+	})
+	stopRelay := relay.Stop
+	relay.Stop = func(ctx context.Context) error {
+		stopRelay(ctx)
+		eventOutbox.Flush(ctx, kafkaClient)
+		return nil
+	}
+	return relay
 }
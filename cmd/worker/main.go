@@ -2,12 +2,25 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"project-root/config"
+	"project-root/internal/bootstrap"
 	"project-root/internal/events"
+	"project-root/internal/health"
 	"project-root/internal/kafka"
+	"project-root/internal/lifecycle"
+	"project-root/internal/replication"
 	"project-root/internal/storage"
+	"project-root/internal/tracing"
+	"project-root/pkg/logger"
 )
 
 func main() {
@@ -17,46 +30,269 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	shutdownLogging, err := logger.Setup(bootstrap.LoggingConfig(cfg))
+	if err != nil {
+		log.Fatalf("Failed to initialize logging: %v", err)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		File:        cfg.Tracing.File,
+		ServiceName: "storage-worker",
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
 	// Initialize storage adapter (Azure or Local)
-	var storageAdapter storage.StorageAdapter
-	storageAdapter, err = storage.NewAzureStorage(cfg.Azure.AccountName, cfg.Azure.AccountKey, cfg.Azure.ContainerName)
+	backend, err := bootstrap.NewBackend(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	// Components start in dependency order and stop in reverse, so the Kafka consumer added
+	// last stops first and handlers finish before storage jobs end.
+	lc := lifecycle.New()
+	// Added first so they stop last, after the logs and spans of everything else are recorded.
+	lc.Add(lifecycle.Component{Name: "logging", Stop: shutdownLogging})
+	lc.Add(lifecycle.Component{Name: "tracing", Stop: shutdownTracing})
+
+	checker := health.NewChecker(cfg.Health.Timeout, cfg.Health.Timeouts)
+	checker.Add(health.Check{Name: "storage", Probe: func(ctx context.Context) error {
+		return storage.CheckHealth(ctx, backend)
+	}})
+
+	// The monitoring server is added first so it keeps answering until everything else has stopped.
+	if cfg.Health.WorkerPort > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/", checker.Handler())
+		mux.Handle("GET /metrics", promhttp.Handler())
+		monitoringServer := lifecycle.HTTPServer(lc, &http.Server{
+			Addr:    fmt.Sprintf(":%d", cfg.Health.WorkerPort),
+			Handler: mux,
+		})
+		monitoringServer.Name = "monitoring server"
+		lc.Add(monitoringServer)
+	}
+
+	storageAdapter, err := newStorageStack(cfg, lc, backend)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 
+	// Event paths are relative to the tenant's namespace when tenancy is enabled.
+	// Dedicated tenant containers are also kept undecorated for replication.
+	var tenants *storage.TenantStorage
+	dedicatedBackends := make(map[string]storage.StorageAdapter)
+	if cfg.Tenancy.Enabled {
+		dedicated := make(map[string]storage.StorageAdapter, len(cfg.Tenancy.Containers))
+		for tenantID, containerName := range cfg.Tenancy.Containers {
+			tenantBackend, err := bootstrap.NewAzureStorage(cfg, containerName)
+			if err != nil {
+				log.Fatalf("Failed to initialize container for tenant %s: %v", tenantID, err)
+			}
+			checker.Add(health.Check{Name: "storage/" + tenantID, Probe: tenantBackend.HealthCheck})
+			dedicatedBackends[tenantID] = bootstrap.Instrumented(tenantBackend, "azure")
+			if dedicated[tenantID], err = newStorageStack(cfg, lc, dedicatedBackends[tenantID]); err != nil {
+				log.Fatalf("Failed to initialize storage for tenant %s: %v", tenantID, err)
+			}
+		}
+		tenants = storage.NewTenantStorage(storageAdapter, cfg.Tenancy.RootPrefix, dedicated)
+	}
+
 	// Initialize Kafka client
-	kafkaClient, err := kafka.NewKafkaClient(cfg.Kafka.Brokers, cfg.Kafka.ConsumerGroup)
+	kafkaClient, err := kafka.NewKafkaClient(bootstrap.KafkaConfig(cfg, cfg.Kafka.ConsumerGroup))
 	if err != nil {
 		log.Fatalf("Failed to initialize Kafka: %v", err)
 	}
-	defer kafkaClient.Close()
+	checker.Add(health.Check{Name: "kafka", Probe: kafkaClient.Ping})
+	if err := bootstrap.ConfigureSerializers(cfg, kafkaClient); err != nil {
+		log.Fatalf("Invalid Kafka formats: %v", err)
+	}
 
 	// Register event handlers
-	kafkaClient.RegisterHandler(events.FileUploaded, func(event *events.StorageEvent) {
-		log.Printf("📥 Processing uploaded file: %s", event.Path)
+	if cfg.Replication.Enabled {
+		secondary, err := newSecondaryStorage(cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize replication target: %v", err)
+		}
+		checker.Add(health.Check{Name: "replica", Probe: func(ctx context.Context) error {
+			return storage.CheckHealth(ctx, secondary)
+		}})
+		// Replicas are copied from the raw backends, so the secondary holds the same
+		// ciphertext and metadata as the primary. Tenants with a dedicated container are
+		// mirrored to their prefix on the secondary and reconciled on their own.
+		shared := replication.NewReplicator(backend, secondary, cfg.Replication.MaxRetries, cfg.Replication.RetryBackoff)
+		shared.Name = "shared"
+		replicators := map[string]*replication.Replicator{"": shared}
+		if tenants != nil {
+			replicaTenants := storage.NewTenantStorage(secondary, cfg.Tenancy.RootPrefix, nil)
+			for tenantID, tenantBackend := range dedicatedBackends {
+				namespace := replicaTenants.Namespace(tenantID)
+				replicators[tenantID] = replication.NewReplicator(tenantBackend, storage.NewPrefixStorage(secondary, namespace), cfg.Replication.MaxRetries, cfg.Replication.RetryBackoff)
+				replicators[tenantID].Name = tenantID
+				shared.Excluded = append(shared.Excluded, namespace)
+			}
+		}
 
-		content := []byte("Placeholder content")
-		if err := storageAdapter.WriteFile(context.Background(), event.Path, content, true); err != nil {
-			log.Printf("❌ Failed to process uploaded file: %v", err)
-		} else {
-			log.Printf("✅ Successfully processed uploaded file: %s", event.Path)
+		replicate := func(ctx context.Context, event *events.StorageEvent) error {
+			slog.InfoContext(ctx, "Replicating event", "type", event.Type, "path", event.Path)
+			replicator, backendEvent := replicators[""], event
+			if tenants != nil && event.TenantID != "" {
+				if dedicated, ok := replicators[event.TenantID]; ok {
+					replicator = dedicated
+				} else {
+					backendEvent = inNamespace(event, tenants.Namespace(event.TenantID))
+				}
+			}
+			if err := replicator.HandleEvent(ctx, backendEvent); err != nil {
+				return fmt.Errorf("replication failed: %w", err)
+			}
+			stats := replicator.Stats()
+			slog.InfoContext(ctx, "Replicated event", "type", event.Type, "path", event.Path, "lag", stats.LastLag)
+			return nil
+		}
+		for _, eventType := range []events.EventType{events.FileUploaded, events.FileDeleted, events.FileMoved, events.DirectoryDeleted} {
+			kafkaClient.RegisterHandler(eventType, replicate)
 		}
+
+		for tenantID, replicator := range replicators {
+			name := "replication reconciler"
+			if tenantID != "" {
+				name += "/" + tenantID
+			}
+			lc.Add(lifecycle.Background(name, func(ctx context.Context) {
+				runReconciliation(ctx, tenantID, replicator, cfg.Replication.ReconcileInterval)
+			}))
+		}
+	}
+
+	lc.Add(lifecycle.Component{
+		Name: "kafka consumer",
+		Start: func(context.Context) error {
+			if err := kafkaClient.StartConsumers(context.Background(), []string{cfg.Kafka.Topics.StorageEvents}); err != nil {
+				return err
+			}
+			slog.Info("Worker is listening for Kafka events", "topic", cfg.Kafka.Topics.StorageEvents, "group", cfg.Kafka.ConsumerGroup)
+			return nil
+		},
+		// Close waits for the event being handled and commits the final offsets.
+		Stop: func(context.Context) error {
+			kafkaClient.Close()
+			return nil
+		},
 	})
 
-	kafkaClient.RegisterHandler(events.FileDeleted, func(event *events.StorageEvent) {
-		log.Printf("🗑️ Processing deleted file: %s", event.Path)
-		if err := storageAdapter.DeleteFile(context.Background(), event.Path); err != nil {
-			log.Printf("❌ Failed to process deleted file: %v", err)
+	if err := lc.Run(context.Background(), cfg.Lifecycle.ShutdownTimeout); err != nil {
+		log.Fatalf("Worker stopped: %v", err)
+	}
+	slog.Info("Worker stopped")
+}
+
+// newStorageStack wraps backend with the shared decorators, rotating keys and adding dedup
+// garbage collection for it to lc.
+func newStorageStack(cfg *config.Config, lc *lifecycle.Manager, backend storage.StorageAdapter) (storage.StorageAdapter, error) {
+	stack, err := bootstrap.NewStack(cfg, backend)
+	if err != nil {
+		return nil, err
+	}
+
+	if stack.Encrypted != nil && cfg.Encryption.RotateOnStartup {
+		rotated, err := stack.Encrypted.RotateKeys(context.Background(), ".")
+		if err != nil {
+			slog.Error("Key rotation stopped", "rewrapped", rotated, "error", err)
 		} else {
-			log.Printf("✅ Successfully processed deleted file: %s", event.Path)
+			slog.Info("Re-wrapped data keys", "files", rotated)
+		}
+	}
+
+	if dedup := stack.Dedup; dedup != nil {
+		lc.Add(lifecycle.Background("dedup garbage collector", func(ctx context.Context) {
+			runDedupGC(ctx, dedup, cfg.Dedup.GCInterval, cfg.Dedup.GCGracePeriod)
+		}))
+	}
+
+	return stack.Adapter, nil
+}
+
+// runDedupGC periodically removes content blobs that no file references.
+func runDedupGC(ctx context.Context, dedup *storage.DedupStorage, interval, gracePeriod time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := dedup.CollectGarbage(ctx, gracePeriod)
+		if err != nil {
+			slog.ErrorContext(ctx, "Dedup garbage collection failed", "error", err)
+		} else {
+			slog.InfoContext(ctx, "Dedup garbage collection finished", "scanned", result.Scanned, "deleted", result.Deleted, "freedBytes", result.FreedBytes)
 		}
-	})
 
-	ctx := context.Background()
-	if err := kafkaClient.StartConsumers(ctx, []string{cfg.Kafka.Topics.StorageEvents}); err != nil {
-		log.Fatalf("Failed to start Kafka consumers: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
+}
 
-	log.Println("Worker is now listening for Kafka events...")
-	select {}
+// newSecondaryStorage builds the replication target: Azure when credentials are set, otherwise local storage.
+func newSecondaryStorage(cfg *config.Config) (storage.StorageAdapter, error) {
+	secondary := cfg.Replication.Secondary
+	if secondary.AccountName != "" && secondary.AccountKey != "" {
+		azureStorage, err := storage.NewAzureStorage(secondary.AccountName, secondary.AccountKey, secondary.ContainerName)
+		if err != nil {
+			return nil, err
+		}
+		return bootstrap.Instrumented(azureStorage, "replica-azure"), nil
+	}
+	if secondary.LocalPath == "" {
+		return nil, fmt.Errorf("replication.secondary needs Azure credentials or a localPath")
+	}
+	return bootstrap.Instrumented(storage.NewLocalStorage(secondary.LocalPath), "replica-local"), nil
+}
+
+// inNamespace maps a tenant's event to the paths of the shared backend, where the tenant's
+// files live under namespace.
+func inNamespace(event *events.StorageEvent, namespace string) *events.StorageEvent {
+	mapped := *event
+	mapped.Path = path.Join(namespace, path.Clean("/"+event.Path))
+	if source, ok := event.MetaData[events.MetaSourcePath]; ok {
+		mapped.MetaData = make(map[string]string, len(event.MetaData))
+		for k, v := range event.MetaData {
+			mapped.MetaData[k] = v
+		}
+		mapped.MetaData[events.MetaSourcePath] = path.Join(namespace, path.Clean("/"+source))
+	}
+	return &mapped
+}
+
+// runReconciliation periodically repairs drift between primary and secondary.
+// tenantID names the dedicated container reconciled, or is "" for the shared backend.
+func runReconciliation(ctx context.Context, tenantID string, replicator *replication.Replicator, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		result, err := replicator.Reconcile(ctx, ".")
+		if err != nil {
+			slog.ErrorContext(ctx, "Replication reconciliation failed", "tenant", tenantID, "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "Replication reconciled", "tenant", tenantID, "scanned", result.Scanned, "copied", result.Copied, "deleted", result.Deleted, "failed", result.Failed)
+	}
 }
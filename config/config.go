@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -10,14 +11,44 @@ import (
 // Config struct defines all the configurations needed
 type Config struct {
 	Server struct {
-		Port int    `yaml:"port"`
-		Host string `yaml:"host"`
+		Port           int      `yaml:"port"`
+		Host           string   `yaml:"host"`
+		TrustedProxies []string `yaml:"trustedProxies"`
+		TLS            struct {
+			Enabled        bool          `yaml:"enabled"`
+			CertFile       string        `yaml:"certFile"`
+			KeyFile        string        `yaml:"keyFile"`
+			MinVersion     string        `yaml:"minVersion"`
+			CipherPolicy   string        `yaml:"cipherPolicy"`
+			CipherSuites   []string      `yaml:"cipherSuites"`
+			ClientCAFile   string        `yaml:"clientCAFile"`
+			ClientAuth     string        `yaml:"clientAuth"`
+			ReloadInterval time.Duration `yaml:"reloadInterval"`
+		} `yaml:"tls"`
 	} `yaml:"server"`
 
+	Lifecycle struct {
+		ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	} `yaml:"lifecycle"`
+
+	Tracing struct {
+		Exporter    string  `yaml:"exporter"`
+		Endpoint    string  `yaml:"endpoint"`
+		File        string  `yaml:"file"`
+		SampleRatio float64 `yaml:"sampleRatio"`
+	} `yaml:"tracing"`
+
+	Health struct {
+		Timeout    time.Duration            `yaml:"timeout"`
+		Timeouts   map[string]time.Duration `yaml:"timeouts"`
+		WorkerPort int                      `yaml:"workerPort"`
+	} `yaml:"health"`
+
 	Azure struct {
-		AccountName   string `yaml:"accountName"`
-		AccountKey    string `yaml:"accountKey"`
-		ContainerName string `yaml:"containerName"`
+		AccountName        string `yaml:"accountName"`
+		AccountKey         string `yaml:"accountKey"`
+		ContainerName      string `yaml:"containerName"`
+		NativeImmutability bool   `yaml:"nativeImmutability"`
 	} `yaml:"azure"`
 
 	Kafka struct {
@@ -26,18 +57,184 @@ type Config struct {
 		Topics        struct {
 			StorageEvents string `yaml:"storageEvents"`
 		} `yaml:"topics"`
+		Formats        map[string]string `yaml:"formats"`
+		SchemaRegistry struct {
+			URL  string `yaml:"url"`
+			File string `yaml:"file"`
+		} `yaml:"schemaRegistry"`
+		ClientID string `yaml:"clientId"`
+		Version  string `yaml:"version"`
 		Producer struct {
-			RequiredAcks int `yaml:"requiredAcks"`
-			Compression  int `yaml:"compression"`
-			Retries      int `yaml:"retries"`
+			RequiredAcks    *int          `yaml:"requiredAcks"`
+			Compression     string        `yaml:"compression"`
+			Retries         *int          `yaml:"retries"`
+			Idempotent      bool          `yaml:"idempotent"`
+			Mode            string        `yaml:"mode"`
+			BatchSize       int           `yaml:"batchSize"`
+			Linger          time.Duration `yaml:"linger"`
+			QueueSize       int           `yaml:"queueSize"`
+			DeadLetterTopic string        `yaml:"deadLetterTopic"`
 		} `yaml:"producer"`
+		Consumer struct {
+			InitialOffset     string `yaml:"initialOffset"`
+			RebalanceStrategy string `yaml:"rebalanceStrategy"`
+		} `yaml:"consumer"`
+		TLS struct {
+			Enabled            bool   `yaml:"enabled"`
+			CAFile             string `yaml:"caFile"`
+			CertFile           string `yaml:"certFile"`
+			KeyFile            string `yaml:"keyFile"`
+			ServerName         string `yaml:"serverName"`
+			InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+		} `yaml:"tls"`
+		SASL struct {
+			Mechanism string `yaml:"mechanism"`
+			Username  string `yaml:"username"`
+			Password  string `yaml:"password"`
+		} `yaml:"sasl"`
 	} `yaml:"kafka"`
 
+	Outbox struct {
+		Enabled      bool          `yaml:"enabled"`
+		Path         string        `yaml:"path"`
+		RetryBackoff time.Duration `yaml:"retryBackoff"`
+		MaxBackoff   time.Duration `yaml:"maxBackoff"`
+	} `yaml:"outbox"`
+
+	Limits struct {
+		MaxUploadBytes      int64     `yaml:"maxUploadBytes"`
+		PerIP               RateLimit `yaml:"perIP"`
+		PerIdentity         RateLimit `yaml:"perIdentity"`
+		ReadBytesPerSecond  float64   `yaml:"readBytesPerSecond"`
+		WriteBytesPerSecond float64   `yaml:"writeBytesPerSecond"`
+	} `yaml:"limits"`
+
+	Auth struct {
+		Enabled     bool         `yaml:"enabled"`
+		APIKeys     []APIKey     `yaml:"apiKeys"`
+		ClientCerts []ClientCert `yaml:"clientCerts"`
+		JWT         struct {
+			HMACSecret   string        `yaml:"hmacSecret"`
+			JWKSFile     string        `yaml:"jwksFile"`
+			Issuer       string        `yaml:"issuer"`
+			Audience     string        `yaml:"audience"`
+			SubjectClaim string        `yaml:"subjectClaim"`
+			TenantClaim  string        `yaml:"tenantClaim"`
+			RolesClaim   string        `yaml:"rolesClaim"`
+			Leeway       time.Duration `yaml:"leeway"`
+		} `yaml:"jwt"`
+	} `yaml:"auth"`
+
+	Authz struct {
+		Enabled        bool          `yaml:"enabled"`
+		PolicyFile     string        `yaml:"policyFile"`
+		ReloadInterval time.Duration `yaml:"reloadInterval"`
+	} `yaml:"authz"`
+
+	Encryption struct {
+		Enabled         bool   `yaml:"enabled"`
+		KeyFile         string `yaml:"keyFile"`
+		RotateOnStartup bool   `yaml:"rotateOnStartup"`
+	} `yaml:"encryption"`
+
+	Compression struct {
+		Enabled      bool     `yaml:"enabled"`
+		Algorithm    string   `yaml:"algorithm"`
+		ContentTypes []string `yaml:"contentTypes"`
+		ServeEncoded bool     `yaml:"serveEncoded"`
+		SpoolDir     string   `yaml:"spoolDir"`
+	} `yaml:"compression"`
+
+	Dedup struct {
+		Enabled       bool          `yaml:"enabled"`
+		SpoolDir      string        `yaml:"spoolDir"`
+		HashKey       string        `yaml:"hashKey"`
+		GCInterval    time.Duration `yaml:"gcInterval"`
+		GCGracePeriod time.Duration `yaml:"gcGracePeriod"`
+	} `yaml:"dedup"`
+
+	Cache struct {
+		Enabled         bool          `yaml:"enabled"`
+		Dir             string        `yaml:"dir"`
+		MaxBytes        int64         `yaml:"maxBytes"`
+		RevalidateAfter time.Duration `yaml:"revalidateAfter"`
+		AllowPlaintext  bool          `yaml:"allowPlaintext"`
+	} `yaml:"cache"`
+
+	Quota struct {
+		Enabled        bool                  `yaml:"enabled"`
+		DefaultUser    QuotaLimit            `yaml:"defaultUser"`
+		Users          map[string]QuotaLimit `yaml:"users"`
+		Prefixes       map[string]QuotaLimit `yaml:"prefixes"`
+		RescanInterval time.Duration         `yaml:"rescanInterval"`
+	} `yaml:"quota"`
+
+	Tenancy struct {
+		Enabled    bool              `yaml:"enabled"`
+		RootPrefix string            `yaml:"rootPrefix"`
+		Containers map[string]string `yaml:"containers"`
+	} `yaml:"tenancy"`
+
+	Replication struct {
+		Enabled   bool `yaml:"enabled"`
+		Secondary struct {
+			LocalPath     string `yaml:"localPath"`
+			AccountName   string `yaml:"accountName"`
+			AccountKey    string `yaml:"accountKey"`
+			ContainerName string `yaml:"containerName"`
+		} `yaml:"secondary"`
+		MaxRetries        int           `yaml:"maxRetries"`
+		RetryBackoff      time.Duration `yaml:"retryBackoff"`
+		ReconcileInterval time.Duration `yaml:"reconcileInterval"`
+	} `yaml:"replication"`
+
 	Logging struct {
-		ElasticsearchURL string `yaml:"elasticsearchURL"`
+		Level  string `yaml:"level"`
+		Stdout bool   `yaml:"stdout"`
+		File   struct {
+			Path       string `yaml:"path"`
+			MaxBytes   int64  `yaml:"maxBytes"`
+			MaxBackups int    `yaml:"maxBackups"`
+		} `yaml:"file"`
+		Elasticsearch struct {
+			URL           string        `yaml:"url"`
+			Index         string        `yaml:"index"`
+			BatchSize     int           `yaml:"batchSize"`
+			FlushInterval time.Duration `yaml:"flushInterval"`
+			BufferSize    int           `yaml:"bufferSize"`
+			MaxRetries    int           `yaml:"maxRetries"`
+		} `yaml:"elasticsearch"`
 	} `yaml:"logging"`
 }
 
+// RateLimit is a token bucket; zero RequestsPerSecond is unlimited.
+type RateLimit struct {
+	RequestsPerSecond float64 `yaml:"requestsPerSecond"`
+	Burst             int     `yaml:"burst"`
+}
+
+// APIKey is a static API key; Hash is the hex SHA-256 of the key.
+type APIKey struct {
+	Name   string   `yaml:"name"`
+	Hash   string   `yaml:"hash"`
+	Tenant string   `yaml:"tenant"`
+	Roles  []string `yaml:"roles"`
+}
+
+// ClientCert maps a client certificate subject (full DN or common name) to an identity.
+type ClientCert struct {
+	Subject string   `yaml:"subject"`
+	Name    string   `yaml:"name"`
+	Tenant  string   `yaml:"tenant"`
+	Roles   []string `yaml:"roles"`
+}
+
+// QuotaLimit bounds bytes and object count; zero is unlimited.
+type QuotaLimit struct {
+	MaxBytes   int64 `yaml:"maxBytes"`
+	MaxObjects int64 `yaml:"maxObjects"`
+}
+
 // LoadConfig reads the configuration from file
 func LoadConfig() (*Config, error) {
 	file, err := os.ReadFile("config.yaml")
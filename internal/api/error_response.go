@@ -1,5 +1,18 @@
 package api
 
+import (
+	"github.com/gin-gonic/gin"
+
+	"project-root/pkg/logger"
+)
+
 type ErrorResponse struct {
 	Error string `json:"error"`
+	// RequestID identifies the request in the server's logs and the events it published.
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// errorResponse is the body of a failed request.
+func errorResponse(c *gin.Context, message string) ErrorResponse {
+	return ErrorResponse{Error: message, RequestID: logger.RequestIDFromContext(c.Request.Context())}
 }
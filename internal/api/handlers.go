@@ -1,57 +1,143 @@
 package api
 
 import (
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"project-root/internal/auth"
+	"project-root/internal/authz"
 	"project-root/internal/events"
+	"project-root/internal/health"
 	"project-root/internal/kafka"
+	"project-root/internal/outbox"
+	"project-root/internal/ratelimit"
 	"project-root/internal/storage"
+	"project-root/pkg/logger"
 )
 
+// defaultEvents creates events when API.Events is not set.
+var defaultEvents = events.NewFactory("storage-api")
+
+// defaultEventsTopic receives events when API.EventsTopic is not set.
+const defaultEventsTopic = "storage-events"
+
+// defaultOutboxEntries is how many entries GET /outbox/entries lists without a limit.
+const defaultOutboxEntries = 100
+
+// identityKey holds the caller's *auth.Identity on the Gin context.
+const identityKey = "identity"
+
 type API struct {
 	Storage storage.StorageAdapter // Exported (uppercase S)
 	Kafka   *kafka.KafkaClient     // Exported (uppercase K)
+	// Events creates published events; when nil, they are attributed to "storage-api".
+	Events *events.Factory
+	// EventsTopic is the Kafka topic events are published to; empty is "storage-events".
+	EventsTopic string
+	// Outbox, when set, records events durably and its relay publishes them, so events
+	// are not lost while Kafka is unavailable. It backs GET /outbox/stats and /outbox/entries.
+	Outbox *outbox.Outbox
+
+	// ServeCompressed sends compressed files as stored when the client accepts the encoding.
+	ServeCompressed bool
+	// Dedup is set when deduplication is enabled and backs GET /dedup/stats.
+	Dedup *storage.DedupStorage
+	// Quota is set when quotas are enabled and backs GET /usage.
+	Quota *storage.QuotaStorage
+	// Tenants is set when multi-tenancy is enabled; every request must then name a tenant.
+	Tenants *storage.TenantStorage
+	// Auth identifies callers; when nil, requests are anonymous.
+	Auth auth.Authenticator
+	// Authz authorizes every route against the policy; when nil, all requests are allowed.
+	Authz *authz.Engine
+	// Limits throttles clients; the zero value is unlimited.
+	Limits Limits
+	// Health backs /healthz and /readyz when set.
+	Health *health.Checker
+	// Metrics serves GET /metrics when set.
+	Metrics http.Handler
+}
+
+// Limits bounds request rates, bandwidth and upload size. Nil limiters and a zero
+// MaxUploadBytes are unlimited.
+type Limits struct {
+	// PerIP limits requests per client IP, checked before authentication.
+	PerIP *ratelimit.Limiter
+	// PerIdentity limits requests per authenticated caller (per IP when anonymous).
+	PerIdentity *ratelimit.Limiter
+	// ReadBandwidth and WriteBandwidth throttle downloads and uploads in bytes per second per caller.
+	ReadBandwidth  *ratelimit.Limiter
+	WriteBandwidth *ratelimit.Limiter
+	MaxUploadBytes int64
 }
 
 // 🔹 Upload File Handler
 func (api *API) uploadFile(c *gin.Context) {
 	path := c.Param("path")
 	if path == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Path parameter is required"})
+		c.JSON(http.StatusBadRequest, errorResponse(c, "Path parameter is required"))
+		return
+	}
+
+	tags := tagParams(c)
+	if err := storage.ValidateTags(tags); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, "Invalid tags: "+err.Error()))
 		return
 	}
 
 	file, err := c.FormFile("file")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, errorResponse(c, fmt.Sprintf("Upload exceeds the %d byte limit", maxBytesErr.Limit)))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file: " + err.Error()})
+		c.JSON(http.StatusBadRequest, errorResponse(c, "Invalid file: "+err.Error()))
 		return
 	}
 
 	fileContent, err := file.Open()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, "Failed to open file: "+err.Error()))
 		return
 	}
 	defer fileContent.Close()
 
-	content, err := ioutil.ReadAll(fileContent)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file: " + err.Error()})
+	overwrite := c.DefaultQuery("overwrite", "false") == "true"
+	opts := storage.WriteOptions{Overwrite: overwrite, Tags: tags}
+	if contentType := file.Header.Get("Content-Type"); contentType != "" {
+		opts.Metadata = map[string]string{storage.MetaContentType: contentType}
+	}
+	err = api.Storage.WriteStream(c.Request.Context(), path, fileContent, opts)
+	if errors.Is(err, storage.ErrImmutable) {
+		c.JSON(http.StatusConflict, errorResponse(c, "Storage write rejected: "+err.Error()))
+		return
+	}
+	var quotaErr *storage.QuotaError
+	if errors.As(err, &quotaErr) {
+		// A file larger than the whole quota can never fit; otherwise space may be freed.
+		status := http.StatusInsufficientStorage
+		if quotaErr.Resource == "bytes" && file.Size > quotaErr.Limit {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, errorResponse(c, err.Error()))
 		return
 	}
-
-	overwrite := c.DefaultQuery("overwrite", "false") == "true"
-	err = api.Storage.WriteFile(c.Request.Context(), path, content, overwrite)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Storage write failed: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, "Storage write failed: "+err.Error()))
 		return
 	}
 
-	api.publishEvent(events.FileUploaded, path, int64(len(content)), map[string]string{
+	api.publishEvent(c, events.FileUploaded, path, file.Size, map[string]string{
 		"filename":    file.Filename,
 		"contentType": file.Header.Get("Content-Type"),
 		"overwrite":   fmt.Sprintf("%v", overwrite),
@@ -64,17 +150,21 @@ func (api *API) uploadFile(c *gin.Context) {
 func (api *API) deleteFile(c *gin.Context) {
 	path := c.Param("path")
 	if path == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Path parameter is required"})
+		c.JSON(http.StatusBadRequest, errorResponse(c, "Path parameter is required"))
 		return
 	}
 
 	err := api.Storage.DeleteFile(c.Request.Context(), path)
+	if errors.Is(err, storage.ErrImmutable) {
+		c.JSON(http.StatusConflict, errorResponse(c, "Delete rejected: "+err.Error()))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found or cannot be deleted: " + err.Error()})
+		c.JSON(http.StatusNotFound, errorResponse(c, "File not found or cannot be deleted: "+err.Error()))
 		return
 	}
 
-	api.publishEvent(events.FileDeleted, path, 0, nil)
+	api.publishEvent(c, events.FileDeleted, path, 0, nil)
 	c.Status(http.StatusNoContent)
 }
 
@@ -82,18 +172,22 @@ func (api *API) deleteFile(c *gin.Context) {
 func (api *API) createDirectory(c *gin.Context) {
 	path := c.Param("path")
 	if path == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Path parameter is required"})
+		c.JSON(http.StatusBadRequest, errorResponse(c, "Path parameter is required"))
 		return
 	}
 
 	// Create an empty directory (depends on the storage adapter)
 	err := api.Storage.WriteFile(c.Request.Context(), path+"/.keep", []byte{}, false)
+	if errors.Is(err, storage.ErrQuotaExceeded) {
+		c.JSON(http.StatusInsufficientStorage, errorResponse(c, err.Error()))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create directory: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, "Failed to create directory: "+err.Error()))
 		return
 	}
 
-	api.publishEvent(events.DirectoryCreated, path, 0, nil)
+	api.publishEvent(c, events.DirectoryCreated, path, 0, nil)
 	c.Status(http.StatusCreated)
 }
 
@@ -101,17 +195,21 @@ func (api *API) createDirectory(c *gin.Context) {
 func (api *API) deleteDirectory(c *gin.Context) {
 	path := c.Param("path")
 	if path == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Path parameter is required"})
+		c.JSON(http.StatusBadRequest, errorResponse(c, "Path parameter is required"))
 		return
 	}
 
 	err := api.Storage.DeleteFile(c.Request.Context(), path)
+	if errors.Is(err, storage.ErrImmutable) {
+		c.JSON(http.StatusConflict, errorResponse(c, "Delete rejected: "+err.Error()))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Directory not found or cannot be deleted: " + err.Error()})
+		c.JSON(http.StatusNotFound, errorResponse(c, "Directory not found or cannot be deleted: "+err.Error()))
 		return
 	}
 
-	api.publishEvent(events.DirectoryDeleted, path, 0, nil)
+	api.publishEvent(c, events.DirectoryDeleted, path, 0, nil)
 	c.Status(http.StatusNoContent)
 }
 
@@ -119,18 +217,43 @@ func (api *API) deleteDirectory(c *gin.Context) {
 func (api *API) readFile(c *gin.Context) {
 	path := c.Param("path")
 	if path == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Path parameter is required"})
+		c.JSON(http.StatusBadRequest, errorResponse(c, "Path parameter is required"))
 		return
 	}
 
-	content, err := api.Storage.ReadFile(c.Request.Context(), path)
+	info, err := api.Storage.Stat(c.Request.Context(), path)
+	if err != nil {
+		c.JSON(http.StatusNotFound, errorResponse(c, "File not found: "+err.Error()))
+		return
+	}
 
+	ctx := c.Request.Context()
+	size := info.Size
+	var headers map[string]string
+	if api.ServeCompressed {
+		encodedCtx := storage.WithEncodedContent(ctx)
+		stored, err := api.Storage.Stat(encodedCtx, path)
+		encoding := ""
+		if err == nil {
+			encoding = stored.Metadata[storage.MetaContentEncoding]
+		}
+		if encoding != "" && acceptsEncoding(c.GetHeader("Accept-Encoding"), encoding) {
+			// Stream the stored bytes; the compressed length is not known up front.
+			ctx = encodedCtx
+			size = -1
+			headers = map[string]string{"Content-Encoding": encoding, "Vary": "Accept-Encoding"}
+		}
+	}
+
+	content, err := api.Storage.OpenFile(ctx, path)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found: " + err.Error()})
+		c.JSON(http.StatusNotFound, errorResponse(c, "File not found: "+err.Error()))
 		return
 	}
+	defer content.Close()
 
-	c.Data(http.StatusOK, "application/octet-stream", content)
+	body := api.Limits.ReadBandwidth.Reader(ctx, callerKey(c), content)
+	c.DataFromReader(http.StatusOK, size, "application/octet-stream", body, headers)
 }
 
 // 🔹 List Files Handler
@@ -142,23 +265,443 @@ func (api *API) listFiles(c *gin.Context) {
 
 	files, err := api.Storage.ListFiles(c.Request.Context(), dirPath)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list files: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, "Failed to list files: "+err.Error()))
 		return
 	}
 
+	visible := make([]string, 0, len(files))
+	for _, file := range files {
+		if api.allowed(c, authz.List, file) {
+			visible = append(visible, file)
+		}
+	}
+	files = visible
+
 	c.JSON(http.StatusOK, gin.H{"files": files})
 }
 
+// 🔹 Search Files By Tags Handler
+func (api *API) searchFiles(c *gin.Context) {
+	tags := tagParams(c)
+	if len(tags) == 0 {
+		c.JSON(http.StatusBadRequest, errorResponse(c, "At least one tag.<key> query parameter is required"))
+		return
+	}
+	if err := storage.ValidateTags(tags); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, "Invalid tags: "+err.Error()))
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(storage.DefaultTagPageSize)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, errorResponse(c, "limit must be a positive integer"))
+		return
+	}
+
+	result, err := api.Storage.FindFilesByTags(c.Request.Context(), storage.TagQuery{
+		Tags:       tags,
+		Marker:     c.Query("marker"),
+		MaxResults: limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, "Tag search failed: "+err.Error()))
+		return
+	}
+
+	visible := make([]storage.TaggedFile, 0, len(result.Files))
+	for _, file := range result.Files {
+		if api.allowed(c, authz.List, file.Path) {
+			visible = append(visible, file)
+		}
+	}
+	result.Files = visible
+
+	c.JSON(http.StatusOK, result)
+}
+
+// 🔹 List Retention Rules Handler
+func (api *API) listRetentionRules(c *gin.Context) {
+	rules, err := api.Storage.ListRetentionRules(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, "Failed to list retention rules: "+err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// 🔹 Set Immutability Policy Handler
+func (api *API) setImmutabilityPolicy(c *gin.Context) {
+	var req struct {
+		Target      string    `json:"target" binding:"required"`
+		RetainUntil time.Time `json:"retainUntil" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, "Invalid policy: "+err.Error()))
+		return
+	}
+	// The route has no path; the target is only known from the body.
+	if !api.allowed(c, authz.Admin, req.Target) {
+		c.JSON(http.StatusForbidden, errorResponse(c, fmt.Sprintf("Not allowed to %s %q", authz.Admin, req.Target)))
+		return
+	}
+
+	err := api.Storage.SetImmutabilityPolicy(c.Request.Context(), req.Target, req.RetainUntil)
+	if errors.Is(err, storage.ErrImmutable) {
+		c.JSON(http.StatusConflict, errorResponse(c, err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, "Failed to set immutability policy: "+err.Error()))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// 🔹 Set Legal Hold Handler
+func (api *API) setLegalHold(c *gin.Context) {
+	var req struct {
+		Target    string `json:"target" binding:"required"`
+		LegalHold *bool  `json:"legalHold" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, "Invalid legal hold: "+err.Error()))
+		return
+	}
+	if !api.allowed(c, authz.Admin, req.Target) {
+		c.JSON(http.StatusForbidden, errorResponse(c, fmt.Sprintf("Not allowed to %s %q", authz.Admin, req.Target)))
+		return
+	}
+
+	if err := api.Storage.SetLegalHold(c.Request.Context(), req.Target, *req.LegalHold); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, "Failed to set legal hold: "+err.Error()))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// 🔹 Dedup Stats Handler
+func (api *API) dedupStats(c *gin.Context) {
+	if api.Dedup == nil {
+		c.JSON(http.StatusNotFound, errorResponse(c, "Deduplication is not enabled"))
+		return
+	}
+	if api.Tenants != nil {
+		c.JSON(http.StatusForbidden, errorResponse(c, "Deduplication stats span all tenants"))
+		return
+	}
+
+	stats, err := api.Dedup.Stats(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, "Failed to read dedup stats: "+err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// 🔹 Outbox Stats Handler
+func (api *API) outboxStats(c *gin.Context) {
+	if api.Outbox == nil {
+		c.JSON(http.StatusNotFound, errorResponse(c, "The outbox is not enabled"))
+		return
+	}
+
+	stats, err := api.Outbox.Stats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, "Failed to read outbox: "+err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// 🔹 Outbox Entries Handler
+func (api *API) outboxEntries(c *gin.Context) {
+	if api.Outbox == nil {
+		c.JSON(http.StatusNotFound, errorResponse(c, "The outbox is not enabled"))
+		return
+	}
+	if api.Tenants != nil {
+		c.JSON(http.StatusForbidden, errorResponse(c, "Outbox entries span all tenants"))
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultOutboxEntries)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, errorResponse(c, "limit must be a positive integer"))
+		return
+	}
+	entries, err := api.Outbox.Entries(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, "Failed to read outbox: "+err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+// 🔹 Usage Handler
+func (api *API) usage(c *gin.Context) {
+	if api.Quota == nil {
+		c.JSON(http.StatusNotFound, errorResponse(c, "Quotas are not enabled"))
+		return
+	}
+
+	report, err := api.Quota.Usage(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, "Failed to read usage: "+err.Error()))
+		return
+	}
+	if api.Tenants != nil {
+		report = api.tenantUsage(c, report)
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// tenantUsage narrows a usage report to the caller's own user and the prefixes inside
+// the tenant's namespace, named relative to it.
+func (api *API) tenantUsage(c *gin.Context, report *storage.UsageReport) *storage.UsageReport {
+	scoped := &storage.UsageReport{Users: map[string]storage.ScopeUsage{}, Prefixes: map[string]storage.ScopeUsage{}}
+	if userID := storage.UserFromContext(c.Request.Context()); userID != "" {
+		if usage, ok := report.Users[userID]; ok {
+			scoped.Users[userID] = usage
+		}
+	}
+
+	namespace := api.Tenants.Namespace(storage.TenantFromContext(c.Request.Context()))
+	if namespace == "" {
+		return scoped
+	}
+	for prefix, usage := range report.Prefixes {
+		normalized := strings.Trim(prefix, "/")
+		if normalized == namespace {
+			scoped.Prefixes["."] = usage
+		} else if rel, ok := strings.CutPrefix(normalized, namespace+"/"); ok {
+			scoped.Prefixes[rel] = usage
+		}
+	}
+	return scoped
+}
+
+// 🔹 Explain Access Handler
+func (api *API) explainAccess(c *gin.Context) {
+	if api.Authz == nil {
+		c.JSON(http.StatusNotFound, errorResponse(c, "Authorization is not enabled"))
+		return
+	}
+
+	action := authz.Action(c.Query("action"))
+	if action == "" {
+		c.JSON(http.StatusBadRequest, errorResponse(c, "action query parameter is required"))
+		return
+	}
+	req := callerRequest(c, action, c.Query("path"))
+
+	// Explaining someone else's access is an administrative operation.
+	if subject := c.Query("subject"); subject != "" && subject != req.Subject {
+		if !api.allowed(c, authz.Admin, "") {
+			c.JSON(http.StatusForbidden, errorResponse(c, "Explaining another subject's access requires admin"))
+			return
+		}
+		req.Subject = subject
+		req.Roles = nil
+		if roles := c.Query("roles"); roles != "" {
+			req.Roles = strings.Split(roles, ",")
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"request": req, "decision": api.Authz.Evaluate(req)})
+}
+
+// authorize rejects the request unless the policy allows action on the route's path.
+func (api *API) authorize(action authz.Action) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !api.allowed(c, action, c.Param("path")) {
+			c.AbortWithStatusJSON(http.StatusForbidden, errorResponse(c, fmt.Sprintf("Not allowed to %s %q", action, c.Param("path"))))
+			return
+		}
+		c.Next()
+	}
+}
+
+// allowed reports whether the caller may perform action on path.
+func (api *API) allowed(c *gin.Context, action authz.Action, path string) bool {
+	if api.Authz == nil {
+		return true
+	}
+	return api.Authz.Evaluate(callerRequest(c, action, path)).Allowed
+}
+
+// callerRequest describes an access by the request's caller; unauthenticated callers
+// are evaluated as the anonymous subject.
+func callerRequest(c *gin.Context, action authz.Action, path string) authz.Request {
+	req := authz.Request{Subject: storage.AnonymousUser, Action: action, Path: path}
+	if identity := auth.FromContext(c.Request.Context()); identity != nil {
+		req.Subject = identity.Subject
+		req.Roles = identity.Roles
+	}
+	return req
+}
+
+// limitIP rejects requests from client IPs over their request rate.
+func (api *API) limitIP(c *gin.Context) {
+	if ok, retryAfter := api.Limits.PerIP.Allow("ip:" + c.ClientIP()); !ok {
+		tooManyRequests(c, retryAfter)
+		return
+	}
+	c.Next()
+}
+
+// limitIdentity rejects requests from callers over their request rate.
+func (api *API) limitIdentity(c *gin.Context) {
+	if ok, retryAfter := api.Limits.PerIdentity.Allow(callerKey(c)); !ok {
+		tooManyRequests(c, retryAfter)
+		return
+	}
+	c.Next()
+}
+
+// limitUpload caps the request body at MaxUploadBytes and throttles it to the write
+// bandwidth while it streams, before anything is buffered.
+func (api *API) limitUpload(c *gin.Context) {
+	if max := api.Limits.MaxUploadBytes; max > 0 {
+		if c.Request.ContentLength > max {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, errorResponse(c, fmt.Sprintf("Upload exceeds the %d byte limit", max)))
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+	}
+	if api.Limits.WriteBandwidth != nil {
+		body := c.Request.Body
+		c.Request.Body = struct {
+			io.Reader
+			io.Closer
+		}{api.Limits.WriteBandwidth.Reader(c.Request.Context(), callerKey(c), body), body}
+	}
+	c.Next()
+}
+
+func tooManyRequests(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, errorResponse(c, "Rate limit exceeded"))
+}
+
+// callerKey identifies the caller for rate limiting: its subject, or its IP when anonymous.
+func callerKey(c *gin.Context) string {
+	if identity := auth.FromContext(c.Request.Context()); identity != nil {
+		return "user:" + identity.Subject
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// authenticate identifies the caller and attributes the request's storage operations to it.
+func (api *API) authenticate(c *gin.Context) {
+	identity, err := api.Auth.Authenticate(c.Request)
+	if err != nil {
+		message := err.Error()
+		if errors.Is(err, auth.ErrNoCredentials) {
+			message = "Authentication required"
+		}
+		c.Header("WWW-Authenticate", `Bearer realm="storage"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(c, message))
+		return
+	}
+
+	c.Set(identityKey, identity)
+	ctx := auth.WithIdentity(c.Request.Context(), identity)
+	c.Request = c.Request.WithContext(storage.WithUser(ctx, identity.Subject))
+	c.Next()
+}
+
+// resolveTenant scopes the request to the tenant bound to the caller's credentials.
+// Requests without a valid tenant are rejected before reaching any handler, and so is
+// every request when authentication is disabled: a client-supplied tenant is never trusted.
+func (api *API) resolveTenant(c *gin.Context) {
+	if api.Auth == nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(c, "Tenancy requires authentication"))
+		return
+	}
+	tenantID := ""
+	if identity := auth.FromContext(c.Request.Context()); identity != nil {
+		tenantID = identity.Tenant
+	}
+	if tenantID == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, errorResponse(c, "Credentials are not bound to a tenant"))
+		return
+	}
+	if err := storage.ValidateTenantID(tenantID); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse(c, err.Error()))
+		return
+	}
+
+	c.Request = c.Request.WithContext(storage.WithTenant(c.Request.Context(), tenantID))
+	c.Next()
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows encoding.
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// tagParams collects tag.<key>=<value> query parameters.
+func tagParams(c *gin.Context) map[string]string {
+	tags := map[string]string{}
+	for key, values := range c.Request.URL.Query() {
+		if name, ok := strings.CutPrefix(key, "tag."); ok && len(values) > 0 {
+			tags[name] = values[0]
+		}
+	}
+	return tags
+}
+
 // 🔹 Publish Event to Kafka
-func (api *API) publishEvent(eventType events.EventType, path string, size int64, metadata map[string]string) {
-	event := &events.StorageEvent{
-		Type:     eventType,
-		Path:     path,
-		Size:     size,
-		MetaData: metadata,
+func (api *API) publishEvent(c *gin.Context, eventType events.EventType, path string, size int64, metadata map[string]string) {
+	factory := api.Events
+	if factory == nil {
+		factory = defaultEvents
+	}
+	event := factory.New(eventType, path, storage.UserFromContext(c.Request.Context()))
+	event.Size = size
+	event.TenantID = storage.TenantFromContext(c.Request.Context())
+	event.MetaData = metadata
+	if id := logger.RequestIDFromContext(c.Request.Context()); id != "" {
+		if event.MetaData == nil {
+			event.MetaData = map[string]string{}
+		}
+		event.MetaData[events.MetaRequestID] = id
+	}
+	topic := api.EventsTopic
+	if topic == "" {
+		topic = defaultEventsTopic
+	}
+	if api.Outbox != nil {
+		err := api.Outbox.Enqueue(c.Request.Context(), topic, event)
+		if err == nil {
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to record event in outbox, publishing directly", "type", eventType, "path", path, "error", err)
+	}
+	if api.Kafka == nil {
+		return
 	}
 
-	if err := api.Kafka.Publish("storage-events", event); err != nil {
-		fmt.Printf("Failed to publish event %s: %v\n", eventType, err)
+	if err := api.Kafka.Publish(c.Request.Context(), topic, event); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to publish event", "type", eventType, "path", path, "error", err)
 	}
 }
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"io"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route and status.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 8), // 1ms to ~16s
+	}, []string{"method", "route", "status"})
+	httpBytesIn = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_request_bytes_total",
+		Help: "Request body bytes read by method, route and status.",
+	}, []string{"method", "route", "status"})
+	httpBytesOut = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_response_bytes_total",
+		Help: "Response body bytes written by method, route and status.",
+	}, []string{"method", "route", "status"})
+)
+
+// instrument records request counts, latency and body sizes. Routes are labeled with their
+// pattern (e.g. "/read/:path") so file names do not become label values.
+func (api *API) instrument(c *gin.Context) {
+	start := time.Now()
+	body := &countingReader{r: c.Request.Body}
+	if c.Request.Body != nil {
+		c.Request.Body = body
+	}
+
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	labels := []string{c.Request.Method, route, strconv.Itoa(c.Writer.Status())}
+	httpRequests.WithLabelValues(labels...).Inc()
+	httpDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	httpBytesIn.WithLabelValues(labels...).Add(float64(body.n.Load()))
+	if size := c.Writer.Size(); size > 0 {
+		httpBytesOut.WithLabelValues(labels...).Add(float64(size))
+	}
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	r io.ReadCloser
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func (c *countingReader) Close() error {
+	return c.r.Close()
+}
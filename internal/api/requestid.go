@@ -0,0 +1,68 @@
+package api
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"project-root/pkg/logger"
+)
+
+// RequestIDHeader carries the correlation ID of a request, in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds IDs accepted from clients.
+const maxRequestIDLength = 128
+
+// assignRequestID keeps the caller's X-Request-ID, or generates one, and puts it on the
+// request context and the response so logs, error bodies and events can be correlated.
+func (api *API) assignRequestID(c *gin.Context) {
+	id := c.GetHeader(RequestIDHeader)
+	if !validRequestID(id) {
+		id = uuid.NewString()
+	}
+	c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), id))
+	c.Header(RequestIDHeader, id)
+	c.Next()
+}
+
+// validRequestID accepts IDs that are safe to copy into logs and headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// logRequest writes an access log record for each request.
+func (api *API) logRequest(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	level := slog.LevelInfo
+	if c.Writer.Status() >= 500 {
+		level = slog.LevelError
+	}
+	slog.Log(c.Request.Context(), level, "Request handled",
+		"method", c.Request.Method,
+		"route", route,
+		"path", c.Request.URL.Path,
+		"status", c.Writer.Status(),
+		"bytes", c.Writer.Size(),
+		"duration", time.Since(start),
+		"client", c.ClientIP(),
+	)
+}
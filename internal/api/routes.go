@@ -2,20 +2,66 @@ package api
 
 import (
 	"github.com/gin-gonic/gin"
+
+	"project-root/internal/authz"
 )
 
 func SetupRoutes(api *API) *gin.Engine {
-	router := gin.Default()
+	router := gin.New()
+	// Forwarded headers are client-controlled unless a trusted proxy set them; callers
+	// behind a proxy opt in with SetTrustedProxies.
+	router.SetTrustedProxies(nil)
+	router.Use(api.assignRequestID, api.instrument, api.traceRequest, api.logRequest, gin.Recovery())
+
+	// Health probes and metrics are registered before the middleware so they skip limits and auth.
+	if api.Health != nil {
+		router.GET("/healthz", gin.WrapH(api.Health.LivenessHandler()))
+		router.GET("/readyz", gin.WrapH(api.Health.ReadinessHandler()))
+	}
+	if api.Metrics != nil {
+		router.GET("/metrics", gin.WrapH(api.Metrics))
+	}
+
+	router.Use(api.limitIP)
+	if api.Auth != nil {
+		router.Use(api.authenticate)
+	}
+	router.Use(api.limitIdentity)
+	if api.Tenants != nil {
+		router.Use(api.resolveTenant)
+	}
 
 	// File
-	router.POST("/upload/:path", api.uploadFile)
-	router.DELETE("/delete/:path", api.deleteFile)
-	router.GET("/read/:path", api.readFile)
+	router.POST("/upload/:path", api.authorize(authz.Write), api.limitUpload, api.uploadFile)
+	router.DELETE("/delete/:path", api.authorize(authz.Delete), api.deleteFile)
+	router.GET("/read/:path", api.authorize(authz.Read), api.readFile)
 
 	// Directory
-	router.POST("/directory/:path", api.createDirectory)
-	router.DELETE("/directory/:path", api.deleteDirectory)
-	router.GET("/list/:path", api.listFiles)
+	router.POST("/directory/:path", api.authorize(authz.Write), api.createDirectory)
+	router.DELETE("/directory/:path", api.authorize(authz.Delete), api.deleteDirectory)
+	router.GET("/list/:path", api.authorize(authz.List), api.listFiles)
+
+	// Search
+	router.GET("/search", api.authorize(authz.List), api.searchFiles)
+
+	// Retention
+	router.GET("/retention", api.authorize(authz.Admin), api.listRetentionRules)
+	// The target is in the request body, so these handlers authorize it themselves.
+	router.PUT("/retention/policy", api.setImmutabilityPolicy)
+	router.PUT("/retention/hold", api.setLegalHold)
+
+	// Deduplication
+	router.GET("/dedup/stats", api.authorize(authz.Admin), api.dedupStats)
+
+	// Outbox
+	router.GET("/outbox/stats", api.authorize(authz.Admin), api.outboxStats)
+	router.GET("/outbox/entries", api.authorize(authz.Admin), api.outboxEntries)
+
+	// Quotas
+	router.GET("/usage", api.authorize(authz.Admin), api.usage)
+
+	// Authorization
+	router.GET("/authz/explain", api.explainAccess)
 
 	return router
 }
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIKey is a static key. Only the SHA-256 of the key is configured, never the key itself.
+type APIKey struct {
+	Name   string
+	Hash   string // Hex-encoded SHA-256 of the key, see HashAPIKey
+	Tenant string
+	Roles  []string
+}
+
+// APIKeyAuthenticator accepts keys sent as "X-API-Key: <key>" or "Authorization: ApiKey <key>".
+type APIKeyAuthenticator struct {
+	keys map[[sha256.Size]byte]APIKey
+}
+
+// HashAPIKey returns the value to configure as APIKey.Hash for key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAPIKeyAuthenticator validates and indexes keys by hash.
+func NewAPIKeyAuthenticator(keys []APIKey) (*APIKeyAuthenticator, error) {
+	a := &APIKeyAuthenticator{keys: make(map[[sha256.Size]byte]APIKey, len(keys))}
+	for _, key := range keys {
+		if key.Name == "" {
+			return nil, fmt.Errorf("API key without a name")
+		}
+		decoded, err := hex.DecodeString(strings.ToLower(key.Hash))
+		if err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("API key %q: hash must be a hex-encoded SHA-256", key.Name)
+		}
+		var hash [sha256.Size]byte
+		copy(hash[:], decoded)
+		if _, exists := a.keys[hash]; exists {
+			return nil, fmt.Errorf("API key %q: duplicate hash", key.Name)
+		}
+		a.keys[hash] = key
+	}
+	return a, nil
+}
+
+// Authenticate implements Authenticator. Keys are looked up by their hash, so lookup
+// timing reveals nothing about the configured keys.
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	presented := r.Header.Get("X-API-Key")
+	if presented == "" {
+		scheme, credentials, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !strings.EqualFold(scheme, "ApiKey") {
+			return nil, ErrNoCredentials
+		}
+		presented = strings.TrimSpace(credentials)
+	}
+
+	key, ok := a.keys[sha256.Sum256([]byte(presented))]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+	}
+	return &Identity{Subject: "apikey:" + key.Name, Tenant: key.Tenant, Roles: key.Roles, Method: "apikey"}, nil
+}
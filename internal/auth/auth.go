@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var (
+	// ErrNoCredentials means the request carries no credentials this authenticator handles.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials means credentials were presented but rejected.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Identity is an authenticated caller.
+type Identity struct {
+	// Subject is prefixed with its source ("apikey:", "jwt:" or "cert:"), so callers
+	// authenticated in different ways never share a subject.
+	Subject string   `json:"subject"`
+	Tenant  string   `json:"tenant,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+	// Method names the authenticator that accepted the request, e.g. "apikey" or "jwt".
+	Method string `json:"method"`
+}
+
+// Authenticator identifies the caller of a request. It returns ErrNoCredentials when the
+// request carries none of the credentials it understands, so authenticators can be chained.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// Chain tries each authenticator in turn and returns the first identity or rejection.
+type Chain []Authenticator
+
+// Authenticate implements Authenticator.
+func (c Chain) Authenticate(r *http.Request) (*Identity, error) {
+	for _, authenticator := range c {
+		identity, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return identity, err
+	}
+	return nil, ErrNoCredentials
+}
+
+type identityContextKey struct{}
+
+// WithIdentity attaches an authenticated identity to ctx.
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// FromContext returns the identity attached with WithIdentity, or nil.
+func FromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityContextKey{}).(*Identity)
+	return identity
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ClientCert maps a client certificate subject to an identity. Subject is matched against
+// the certificate's full distinguished name as formatted by pkix.Name.String
+// (e.g. "CN=ingest,O=Acme"), or against its common name alone.
+type ClientCert struct {
+	Subject string
+	Name    string // Identity subject; defaults to the certificate's common name
+	Tenant  string
+	Roles   []string
+}
+
+// ClientCertAuthenticator accepts client certificates the TLS handshake has verified
+// against the configured CA bundle.
+type ClientCertAuthenticator struct {
+	subjects map[string]ClientCert
+}
+
+// NewClientCertAuthenticator indexes mappings by subject.
+func NewClientCertAuthenticator(certs []ClientCert) (*ClientCertAuthenticator, error) {
+	a := &ClientCertAuthenticator{subjects: make(map[string]ClientCert, len(certs))}
+	for _, cert := range certs {
+		if cert.Subject == "" {
+			return nil, fmt.Errorf("client certificate mapping without a subject")
+		}
+		if _, exists := a.subjects[cert.Subject]; exists {
+			return nil, fmt.Errorf("client certificate %q: duplicate subject", cert.Subject)
+		}
+		a.subjects[cert.Subject] = cert
+	}
+	return a, nil
+}
+
+// Authenticate implements Authenticator. Unverified certificates count as no credentials,
+// since the handshake only verifies them when client authentication is enabled.
+func (a *ClientCertAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+
+	cert, ok := a.subjects[subject.String()]
+	if !ok {
+		cert, ok = a.subjects[subject.CommonName]
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: client certificate %q is not mapped to an identity", ErrInvalidCredentials, subject.String())
+	}
+
+	name := cert.Name
+	if name == "" {
+		name = subject.CommonName
+	}
+	return &Identity{Subject: "cert:" + name, Tenant: cert.Tenant, Roles: cert.Roles, Method: "mtls"}, nil
+}
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTConfig controls JWTAuthenticator. At least one of HMACSecret and JWKSFile is required.
+type JWTConfig struct {
+	// HMACSecret verifies HS256/HS384/HS512 tokens.
+	HMACSecret []byte
+	// JWKSFile holds RSA and EC public keys that verify RS* and ES* tokens.
+	JWKSFile string
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string
+	Audience string
+	// Claims holding the subject, tenant and roles; default "sub", "tenant" and "roles".
+	SubjectClaim string
+	TenantClaim  string
+	RolesClaim   string
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+}
+
+const (
+	// minRSABits is the smallest RSA modulus accepted in a JWKS.
+	minRSABits = 2048
+	// minHMACSecretBytes matches the output size of HS256, the weakest HMAC algorithm.
+	minHMACSecretBytes = 32
+)
+
+// JWTAuthenticator accepts "Authorization: Bearer <token>" JWTs signed with the
+// configured HMAC secret or a key from the JWKS file.
+type JWTAuthenticator struct {
+	config JWTConfig
+	keys   map[string]crypto.PublicKey
+	// methods are the algorithms of the configured secret and keys.
+	methods []string
+	now     func() time.Time
+}
+
+// NewJWTAuthenticator loads the JWKS file, if any.
+func NewJWTAuthenticator(config JWTConfig) (*JWTAuthenticator, error) {
+	if len(config.HMACSecret) == 0 && config.JWKSFile == "" {
+		return nil, fmt.Errorf("JWT authentication needs an HMAC secret or a JWKS file")
+	}
+	if len(config.HMACSecret) > 0 && len(config.HMACSecret) < minHMACSecretBytes {
+		return nil, fmt.Errorf("JWT HMAC secret must be at least %d bytes", minHMACSecretBytes)
+	}
+	if config.SubjectClaim == "" {
+		config.SubjectClaim = "sub"
+	}
+	if config.TenantClaim == "" {
+		config.TenantClaim = "tenant"
+	}
+	if config.RolesClaim == "" {
+		config.RolesClaim = "roles"
+	}
+
+	a := &JWTAuthenticator{config: config, keys: map[string]crypto.PublicKey{}, now: time.Now}
+	if config.JWKSFile != "" {
+		data, err := os.ReadFile(config.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS file: %v", err)
+		}
+		if a.keys, err = parseJWKS(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(config.HMACSecret) > 0 {
+		a.methods = append(a.methods, "HS256", "HS384", "HS512")
+	}
+	for _, key := range a.keys {
+		for _, method := range keyMethods(key) {
+			if !contains(a.methods, method) {
+				a.methods = append(a.methods, method)
+			}
+		}
+	}
+	return a, nil
+}
+
+// Authenticate implements Authenticator.
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := a.verify(strings.TrimSpace(token))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	subject, _ := claims[a.config.SubjectClaim].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: token has no %q claim", ErrInvalidCredentials, a.config.SubjectClaim)
+	}
+	tenant, _ := claims[a.config.TenantClaim].(string)
+	return &Identity{Subject: "jwt:" + subject, Tenant: tenant, Roles: stringList(claims[a.config.RolesClaim]), Method: "jwt"}, nil
+}
+
+// verify checks the signature and registered claims and returns all claims. Only the
+// algorithms of configured keys are accepted, and each key only for its own algorithms,
+// so a public key can never be used as an HMAC secret.
+func (a *JWTAuthenticator) verify(token string) (map[string]any, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(a.methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(a.config.Leeway),
+		jwt.WithTimeFunc(a.now),
+	}
+	if a.config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(a.config.Issuer))
+	}
+	if a.config.Audience != "" {
+		options = append(options, jwt.WithAudience(a.config.Audience))
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, a.verificationKey, options...); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// verificationKey returns the key for a token's algorithm and kid.
+func (a *JWTAuthenticator) verificationKey(token *jwt.Token) (any, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if len(a.config.HMACSecret) == 0 {
+			return nil, fmt.Errorf("HMAC tokens are not accepted")
+		}
+		return a.config.HMACSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, err := a.key(kid)
+	if err != nil {
+		return nil, err
+	}
+	if !contains(keyMethods(key), token.Method.Alg()) {
+		return nil, fmt.Errorf("key %q does not sign %s tokens", kid, token.Method.Alg())
+	}
+	return key, nil
+}
+
+// key finds the JWKS key for kid; tokens without kid are accepted when there is a single key.
+func (a *JWTAuthenticator) key(kid string) (crypto.PublicKey, error) {
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// parseJWKS reads the RSA and EC keys of a JSON Web Key Set, indexed by kid.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				return nil, fmt.Errorf("invalid RSA key %q in JWKS", jwk.Kid)
+			}
+			key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			if key.N.BitLen() < minRSABits {
+				return nil, fmt.Errorf("RSA key %q in JWKS has %d bits, at least %d are required", jwk.Kid, key.N.BitLen(), minRSABits)
+			}
+			keys[jwk.Kid] = key
+		case "EC":
+			curve, ok := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[jwk.Crv]
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if !ok || errX != nil || errY != nil {
+				return nil, fmt.Errorf("invalid EC key %q in JWKS", jwk.Kid)
+			}
+			key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if !curve.IsOnCurve(key.X, key.Y) {
+				return nil, fmt.Errorf("invalid EC key %q in JWKS", jwk.Kid)
+			}
+			keys[jwk.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS contains no usable signing keys")
+	}
+	return keys, nil
+}
+
+// keyMethods lists the algorithms a JWKS key verifies: RS* for RSA keys and the ES
+// algorithm matching an EC key's curve.
+func keyMethods(key crypto.PublicKey) []string {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return []string{"RS256", "RS384", "RS512"}
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return []string{"ES256"}
+		case elliptic.P384():
+			return []string{"ES384"}
+		case elliptic.P521():
+			return []string{"ES512"}
+		}
+	}
+	return nil
+}
+
+// stringList reads a claim that is either a string (space-separated) or a list of strings.
+func stringList(claim any) []string {
+	switch v := claim.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Engine evaluates requests against a policy file and reloads it when it changes.
+type Engine struct {
+	file string
+
+	policy  *Policy
+	modTime time.Time
+	mu      sync.RWMutex
+}
+
+// NewEngine loads the policy file. An invalid policy is an error.
+func NewEngine(file string) (*Engine, error) {
+	e := &Engine{file: file}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Evaluate decides a request with the current policy.
+func (e *Engine) Evaluate(req Request) Decision {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.policy.Evaluate(req)
+}
+
+// Reload reads the policy file again. If it is invalid, the current policy stays in effect.
+func (e *Engine) Reload() error {
+	info, err := os.Stat(e.file)
+	if err != nil {
+		return fmt.Errorf("failed to read policy file: %v", err)
+	}
+	data, err := os.ReadFile(e.file)
+	if err != nil {
+		return fmt.Errorf("failed to read policy file: %v", err)
+	}
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.policy = policy
+	e.modTime = info.ModTime()
+	return nil
+}
+
+// Watch reloads the policy whenever the file's modification time changes, checking every
+// interval until ctx is done.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var failed time.Time // Modification time of the last version that failed to load
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(e.file)
+		if err != nil {
+			slog.Error("Failed to check policy file", "file", e.file, "error", err)
+			continue
+		}
+		e.mu.RLock()
+		changed := !info.ModTime().Equal(e.modTime)
+		e.mu.RUnlock()
+		if !changed || info.ModTime().Equal(failed) {
+			continue
+		}
+
+		if err := e.Reload(); err != nil {
+			failed = info.ModTime()
+			slog.Error("Keeping previous policy, reload failed", "file", e.file, "error", err)
+			continue
+		}
+		slog.Info("Reloaded authorization policy", "file", e.file)
+	}
+}
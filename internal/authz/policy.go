@@ -0,0 +1,208 @@
+package authz
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Action is an operation a policy rule grants or denies.
+type Action string
+
+const (
+	Read   Action = "read"
+	Write  Action = "write"
+	Delete Action = "delete"
+	List   Action = "list"
+	// Admin covers retention, usage and other operational endpoints.
+	Admin Action = "admin"
+	// Any matches every action in a rule.
+	Any Action = "*"
+)
+
+// Rule effects.
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+// Rule grants (or, with Effect "deny", forbids) Actions on paths matching any of Paths.
+// In patterns "*" matches within one path segment and "**" matches any number of segments.
+type Rule struct {
+	Effect  string   `yaml:"effect" json:"effect"`
+	Actions []Action `yaml:"actions" json:"actions"`
+	Paths   []string `yaml:"paths" json:"paths"`
+}
+
+// Policy maps roles to rules and subjects to roles.
+type Policy struct {
+	Roles map[string][]Rule `yaml:"roles"`
+	// Bindings grant roles to subjects in addition to the roles in their credentials.
+	Bindings map[string][]string `yaml:"bindings"`
+}
+
+// Request is an access decision to make.
+type Request struct {
+	Subject string   `json:"subject"`
+	Roles   []string `json:"roles"`
+	Action  Action   `json:"action"`
+	Path    string   `json:"path"`
+}
+
+// Decision explains the outcome of a Request.
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+	// Role, Rule and Pattern identify the deciding rule; Rule is its index within the role.
+	Role    string   `json:"role,omitempty"`
+	Rule    int      `json:"rule"`
+	Pattern string   `json:"pattern,omitempty"`
+	Roles   []string `json:"roles"`
+}
+
+// ParsePolicy reads and validates a YAML policy.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var policy Policy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %v", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Validate rejects unknown effects, actions and roles and malformed patterns.
+func (p *Policy) Validate() error {
+	for role, rules := range p.Roles {
+		for i, rule := range rules {
+			if rule.Effect != "" && rule.Effect != Allow && rule.Effect != Deny {
+				return fmt.Errorf("role %q rule %d: unknown effect %q", role, i, rule.Effect)
+			}
+			if len(rule.Actions) == 0 || len(rule.Paths) == 0 {
+				return fmt.Errorf("role %q rule %d: actions and paths are required", role, i)
+			}
+			for _, action := range rule.Actions {
+				switch action {
+				case Read, Write, Delete, List, Admin, Any:
+				default:
+					return fmt.Errorf("role %q rule %d: unknown action %q", role, i, action)
+				}
+			}
+			for _, pattern := range rule.Paths {
+				if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+					return fmt.Errorf("role %q rule %d: invalid pattern %q", role, i, pattern)
+				}
+			}
+		}
+	}
+	for subject, roles := range p.Bindings {
+		for _, role := range roles {
+			if _, ok := p.Roles[role]; !ok {
+				return fmt.Errorf("binding for %q: unknown role %q", subject, role)
+			}
+		}
+	}
+	return nil
+}
+
+// Evaluate decides a request. Access is denied unless a rule of one of the subject's roles
+// allows it, and a matching deny rule always wins over allow rules.
+func (p *Policy) Evaluate(req Request) Decision {
+	roles := p.rolesFor(req)
+	target := cleanPath(req.Path)
+
+	var allowed *Decision
+	for _, role := range roles {
+		for i, rule := range p.Roles[role] {
+			if !rule.covers(req.Action) {
+				continue
+			}
+			for _, pattern := range rule.Paths {
+				if !matchGlob(cleanPath(pattern), target) {
+					continue
+				}
+				decision := Decision{Role: role, Rule: i, Pattern: pattern, Roles: roles}
+				if rule.Effect == Deny {
+					decision.Reason = fmt.Sprintf("denied by role %q rule %d (%s)", role, i, pattern)
+					return decision
+				}
+				if allowed == nil {
+					decision.Allowed = true
+					decision.Reason = fmt.Sprintf("allowed by role %q rule %d (%s)", role, i, pattern)
+					allowed = &decision
+				}
+			}
+		}
+	}
+
+	if allowed != nil {
+		return *allowed
+	}
+	return Decision{Rule: -1, Roles: roles, Reason: fmt.Sprintf("no rule allows %s on %q", req.Action, target)}
+}
+
+// rolesFor combines the request's roles with the subject's bindings, sorted and deduplicated.
+func (p *Policy) rolesFor(req Request) []string {
+	seen := map[string]bool{}
+	roles := []string{}
+	for _, role := range append(append([]string{}, req.Roles...), p.Bindings[req.Subject]...) {
+		if _, defined := p.Roles[role]; defined && !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+func (r Rule) covers(action Action) bool {
+	for _, a := range r.Actions {
+		if a == Any || a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanPath normalizes a path to slash-separated segments without leading "/" or "./".
+// The root is "".
+func cleanPath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// matchGlob matches name against pattern segment by segment; "**" spans zero or more segments.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(split(pattern), split(name))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+func split(p string) []string {
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
@@ -0,0 +1,181 @@
+package bootstrap
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+
+	"project-root/config"
+	"project-root/internal/events"
+	"project-root/internal/kafka"
+	"project-root/internal/storage"
+	"project-root/pkg/logger"
+)
+
+// localDataPath holds files when no Azure credentials are configured.
+const localDataPath = "./local_data"
+
+// Stack is a backend wrapped with the configured encryption, compression and deduplication.
+// Encrypted and Dedup are nil when the feature is disabled.
+type Stack struct {
+	Adapter   storage.StorageAdapter
+	Encrypted *storage.EncryptedStorage
+	Dedup     *storage.DedupStorage
+}
+
+// NewBackend returns the primary backend: Azure when credentials are set, otherwise local
+// storage.
+func NewBackend(cfg *config.Config) (storage.StorageAdapter, error) {
+	if cfg.Azure.AccountName != "" && cfg.Azure.AccountKey != "" {
+		azureStorage, err := NewAzureStorage(cfg, cfg.Azure.ContainerName)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Using Azure Storage", "container", cfg.Azure.ContainerName)
+		return Instrumented(azureStorage, "azure"), nil
+	}
+	slog.Warn("Azure credentials missing, using local storage", "path", localDataPath)
+	return Instrumented(storage.NewLocalStorage(localDataPath), "local"), nil
+}
+
+// NewAzureStorage connects to containerName with the configured account.
+func NewAzureStorage(cfg *config.Config, containerName string) (*storage.AzureStorage, error) {
+	azureStorage, err := storage.NewAzureStorage(cfg.Azure.AccountName, cfg.Azure.AccountKey, containerName)
+	if err != nil {
+		return nil, err
+	}
+	azureStorage.NativeImmutability = cfg.Azure.NativeImmutability
+	return azureStorage, nil
+}
+
+// NewStack wraps backend with encryption, compression and deduplication as configured.
+func NewStack(cfg *config.Config, backend storage.StorageAdapter) (*Stack, error) {
+	stack := &Stack{Adapter: backend}
+
+	if cfg.Encryption.Enabled {
+		keys, err := storage.NewLocalKeyProvider(cfg.Encryption.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load encryption keys: %v", err)
+		}
+		stack.Encrypted = storage.NewEncryptedStorage(stack.Adapter, keys)
+		stack.Adapter = stack.Encrypted
+		slog.Info("Client-side encryption enabled", "keyFile", cfg.Encryption.KeyFile)
+	}
+
+	if cfg.Compression.Enabled {
+		compressed, err := storage.NewCompressedStorage(stack.Adapter, storage.CompressionConfig{
+			Algorithm:    cfg.Compression.Algorithm,
+			ContentTypes: cfg.Compression.ContentTypes,
+			SpoolDir:     cfg.Compression.SpoolDir,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize compression: %v", err)
+		}
+		stack.Adapter = compressed
+	}
+
+	if cfg.Dedup.Enabled {
+		dedup, err := dedupConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		stack.Dedup = storage.NewDedupStorage(stack.Adapter, dedup)
+		stack.Adapter = stack.Dedup
+	}
+
+	return stack, nil
+}
+
+// dedupConfig maps the dedup section to the decorator's settings. Encrypted content needs a
+// hash key, or blob names would reveal the plaintext's SHA-256.
+func dedupConfig(cfg *config.Config) (storage.DedupConfig, error) {
+	dedup := storage.DedupConfig{SpoolDir: cfg.Dedup.SpoolDir}
+	if cfg.Dedup.HashKey == "" {
+		if cfg.Encryption.Enabled {
+			return dedup, fmt.Errorf("dedup.hashKey is required when encryption is enabled")
+		}
+		return dedup, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(cfg.Dedup.HashKey)
+	if err != nil || len(key) < 32 {
+		return dedup, fmt.Errorf("dedup.hashKey must be at least 32 bytes of base64")
+	}
+	dedup.HashKey = key
+	return dedup, nil
+}
+
+// Instrumented wraps a backend with metrics and tracing labeled with name.
+func Instrumented(backend storage.StorageAdapter, name string) storage.StorageAdapter {
+	return storage.NewTracingStorage(storage.NewMetricsStorage(backend, name), name)
+}
+
+// LoggingConfig maps the logging section to the log pipeline's sinks.
+func LoggingConfig(cfg *config.Config) logger.Config {
+	return logger.Config{
+		Level:  cfg.Logging.Level,
+		Stdout: cfg.Logging.Stdout,
+		File: logger.FileConfig{
+			Path:       cfg.Logging.File.Path,
+			MaxBytes:   cfg.Logging.File.MaxBytes,
+			MaxBackups: cfg.Logging.File.MaxBackups,
+		},
+		Elasticsearch: logger.ElasticsearchConfig{
+			URL:           cfg.Logging.Elasticsearch.URL,
+			Index:         cfg.Logging.Elasticsearch.Index,
+			BatchSize:     cfg.Logging.Elasticsearch.BatchSize,
+			FlushInterval: cfg.Logging.Elasticsearch.FlushInterval,
+			BufferSize:    cfg.Logging.Elasticsearch.BufferSize,
+			MaxRetries:    cfg.Logging.Elasticsearch.MaxRetries,
+		},
+	}
+}
+
+// KafkaConfig maps the kafka section to the client's settings.
+func KafkaConfig(cfg *config.Config, groupID string) kafka.Config {
+	return kafka.Config{
+		Brokers:  cfg.Kafka.Brokers,
+		GroupID:  groupID,
+		ClientID: cfg.Kafka.ClientID,
+		Version:  cfg.Kafka.Version,
+		Producer: kafka.ProducerConfig{
+			RequiredAcks:    cfg.Kafka.Producer.RequiredAcks,
+			Compression:     cfg.Kafka.Producer.Compression,
+			Retries:         cfg.Kafka.Producer.Retries,
+			Idempotent:      cfg.Kafka.Producer.Idempotent,
+			Mode:            cfg.Kafka.Producer.Mode,
+			BatchSize:       cfg.Kafka.Producer.BatchSize,
+			Linger:          cfg.Kafka.Producer.Linger,
+			QueueSize:       cfg.Kafka.Producer.QueueSize,
+			DeadLetterTopic: cfg.Kafka.Producer.DeadLetterTopic,
+		},
+		Consumer: kafka.ConsumerConfig{
+			InitialOffset:     cfg.Kafka.Consumer.InitialOffset,
+			RebalanceStrategy: cfg.Kafka.Consumer.RebalanceStrategy,
+		},
+		TLS:  kafka.TLSConfig(cfg.Kafka.TLS),
+		SASL: kafka.SASLConfig(cfg.Kafka.SASL),
+	}
+}
+
+// ConfigureSerializers applies the per-topic event formats, using the configured schema
+// registry for Avro topics.
+func ConfigureSerializers(cfg *config.Config, kafkaClient *kafka.KafkaClient) error {
+	var registry events.SchemaRegistry
+	if cfg.Kafka.SchemaRegistry.URL != "" {
+		registry = events.NewConfluentRegistry(cfg.Kafka.SchemaRegistry.URL)
+	} else if cfg.Kafka.SchemaRegistry.File != "" {
+		registry = events.NewFileRegistry(cfg.Kafka.SchemaRegistry.File)
+	}
+	for topic, name := range cfg.Kafka.Formats {
+		format, err := events.ParseFormat(name)
+		if err != nil {
+			return fmt.Errorf("topic %s: %v", topic, err)
+		}
+		serializer, err := events.NewSerializer(format, topic, registry)
+		if err != nil {
+			return fmt.Errorf("topic %s: %v", topic, err)
+		}
+		kafkaClient.SetSerializer(topic, serializer)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package events
+
+import (
+	"context"
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hamba/avro/v2"
+)
+
+// AvroSchema is the Avro schema of StorageEvent written by this build. Changes must stay
+// backward compatible: the registry rejects a schema that cannot read the previous version.
+//
+//go:embed storage_event.avsc
+var AvroSchema string
+
+// wireMagic starts every message in the Confluent wire format, followed by the big-endian
+// 4-byte schema ID and the Avro binary data.
+const (
+	wireMagic      byte = 0
+	wireHeaderSize      = 5
+)
+
+// avroEvent is StorageEvent as laid out by AvroSchema.
+type avroEvent struct {
+	ID            string            `avro:"id"`
+	Type          string            `avro:"type"`
+	Path          string            `avro:"path"`
+	Size          int64             `avro:"size"`
+	Timestamp     time.Time         `avro:"timestamp"`
+	Source        string            `avro:"source"`
+	SchemaVersion int               `avro:"schemaVersion"`
+	UserID        string            `avro:"userId"`
+	TenantID      string            `avro:"tenantId"`
+	MetaData      map[string]string `avro:"metadata"`
+}
+
+// AvroSerializer writes events as Avro in the Confluent wire format, with AvroSchema
+// registered under the "<topic>-value" subject. It reads messages written with any
+// registered version of the schema, as well as the JSON formats.
+type AvroSerializer struct {
+	registry SchemaRegistry
+	subject  string
+	schema   avro.Schema
+
+	mu      sync.Mutex
+	id      int                 // ID of schema once registered
+	readers map[int]avro.Schema // schema resolving each writer schema ID into schema
+}
+
+// NewAvroSerializer returns a serializer for topic. The schema is registered on first use,
+// so a registry that is briefly unavailable does not stop startup.
+func NewAvroSerializer(registry SchemaRegistry, topic string) (*AvroSerializer, error) {
+	schema, err := parseSchema(AvroSchema)
+	if err != nil {
+		return nil, err
+	}
+	return &AvroSerializer{
+		registry: registry,
+		subject:  topic + "-value",
+		schema:   schema,
+		readers:  make(map[int]avro.Schema),
+	}, nil
+}
+
+func (s *AvroSerializer) Serialize(ctx context.Context, event *StorageEvent) ([]byte, map[string]string, error) {
+	id, err := s.schemaID(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := avro.Marshal(s.schema, avroEvent{
+		ID:            event.ID,
+		Type:          string(event.Type),
+		Path:          event.Path,
+		Size:          event.Size,
+		Timestamp:     event.Timestamp,
+		Source:        event.Source,
+		SchemaVersion: event.SchemaVersion,
+		UserID:        event.UserID,
+		TenantID:      event.TenantID,
+		MetaData:      event.MetaData,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode event as Avro: %v", err)
+	}
+
+	value := make([]byte, wireHeaderSize, wireHeaderSize+len(data))
+	value[0] = wireMagic
+	binary.BigEndian.PutUint32(value[1:wireHeaderSize], uint32(id))
+	return append(value, data...), nil, nil
+}
+
+func (s *AvroSerializer) Deserialize(ctx context.Context, value []byte, headers map[string]string) (*StorageEvent, error) {
+	// JSON never starts with a zero byte, so messages from before the switch are still read.
+	if len(value) == 0 || value[0] != wireMagic {
+		return Decode(value, headers)
+	}
+	if len(value) < wireHeaderSize {
+		return nil, fmt.Errorf("truncated Avro message of %d bytes", len(value))
+	}
+
+	reader, err := s.reader(ctx, int(binary.BigEndian.Uint32(value[1:wireHeaderSize])))
+	if err != nil {
+		return nil, err
+	}
+	var decoded avroEvent
+	if err := avro.Unmarshal(reader, value[wireHeaderSize:], &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode Avro event: %v", err)
+	}
+	if decoded.MetaData == nil {
+		decoded.MetaData = make(map[string]string)
+	}
+	return &StorageEvent{
+		ID:            decoded.ID,
+		Type:          EventType(decoded.Type),
+		Path:          decoded.Path,
+		Size:          decoded.Size,
+		Timestamp:     decoded.Timestamp.UTC(),
+		Source:        decoded.Source,
+		SchemaVersion: decoded.SchemaVersion,
+		UserID:        decoded.UserID,
+		TenantID:      decoded.TenantID,
+		MetaData:      decoded.MetaData,
+	}, nil
+}
+
+// schemaID registers the schema the first time it is needed.
+func (s *AvroSerializer) schemaID(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.id != 0 {
+		return s.id, nil
+	}
+	id, err := s.registry.Register(ctx, s.subject, AvroSchema)
+	if err != nil {
+		return 0, fmt.Errorf("failed to register schema for %s: %w", s.subject, err)
+	}
+	s.id = id
+	s.readers[id] = s.schema
+	return id, nil
+}
+
+// reader returns the schema that reads data written with schema id into avroEvent.
+func (s *AvroSerializer) reader(ctx context.Context, id int) (avro.Schema, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reader, ok := s.readers[id]; ok {
+		return reader, nil
+	}
+
+	text, err := s.registry.Schema(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch schema %d: %w", id, err)
+	}
+	writer, err := parseSchema(text)
+	if err != nil {
+		return nil, err
+	}
+	reader := s.schema
+	if writer.Fingerprint() != s.schema.Fingerprint() {
+		if reader, err = avro.NewSchemaCompatibility().Resolve(s.schema, writer); err != nil {
+			return nil, fmt.Errorf("%w: schema %d: %v", ErrIncompatibleSchema, id, err)
+		}
+	}
+	s.readers[id] = reader
+	return reader, nil
+}
@@ -0,0 +1,195 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is how an event is laid out in a message.
+type Format string
+
+const (
+	// FormatLegacy is the StorageEvent JSON written before CloudEvents support.
+	FormatLegacy Format = "legacy"
+	// FormatCloudEventsStructured puts the whole CloudEvent, attributes and data, in the value.
+	FormatCloudEventsStructured Format = "cloudevents-structured"
+	// FormatCloudEventsBinary puts the attributes in ce_ headers and only the data in the value.
+	FormatCloudEventsBinary Format = "cloudevents-binary"
+	// FormatAvro is Avro binary in the Confluent wire format; see AvroSerializer.
+	FormatAvro Format = "avro"
+)
+
+// ParseFormat parses a format name; empty means FormatLegacy.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case "":
+		return FormatLegacy, nil
+	case FormatLegacy, FormatCloudEventsStructured, FormatCloudEventsBinary, FormatAvro:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown event format %q", name)
+	}
+}
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	// cloudEventsTypePrefix namespaces StorageEvent types, e.g. "storage.FileUploaded".
+	cloudEventsTypePrefix = "storage."
+
+	// ContentTypeHeader is the message header naming the content type of the value.
+	ContentTypeHeader          = "content-type"
+	contentTypeJSON            = "application/json"
+	contentTypeCloudEventsJSON = "application/cloudevents+json"
+	cloudEventsHeaderPrefix    = "ce_"
+)
+
+// cloudEvent is a CloudEvents 1.0 event in the JSON format. SchemaVersion is carried as
+// the "schemaversion" extension attribute.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	SchemaVersion   int             `json:"schemaversion"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// cloudEventData is the data of a CloudEvent: the StorageEvent fields that are not attributes.
+type cloudEventData struct {
+	Path     string            `json:"path"`
+	Size     int64             `json:"size,omitempty"`
+	UserID   string            `json:"userId,omitempty"`
+	TenantID string            `json:"tenantId,omitempty"`
+	MetaData map[string]string `json:"metadata,omitempty"`
+}
+
+// Encode returns the message value and headers carrying event in one of the JSON formats.
+func Encode(event *StorageEvent, format Format) ([]byte, map[string]string, error) {
+	switch format {
+	case FormatLegacy, "":
+		value, err := json.Marshal(event)
+		return value, map[string]string{ContentTypeHeader: contentTypeJSON}, err
+	case FormatCloudEventsStructured:
+		ce, err := toCloudEvent(event)
+		if err != nil {
+			return nil, nil, err
+		}
+		value, err := json.Marshal(ce)
+		return value, map[string]string{ContentTypeHeader: contentTypeCloudEventsJSON}, err
+	case FormatCloudEventsBinary:
+		ce, err := toCloudEvent(event)
+		if err != nil {
+			return nil, nil, err
+		}
+		headers := map[string]string{
+			ContentTypeHeader:                         contentTypeJSON,
+			cloudEventsHeaderPrefix + "specversion":   ce.SpecVersion,
+			cloudEventsHeaderPrefix + "id":            ce.ID,
+			cloudEventsHeaderPrefix + "source":        ce.Source,
+			cloudEventsHeaderPrefix + "type":          ce.Type,
+			cloudEventsHeaderPrefix + "time":          ce.Time.Format(time.RFC3339Nano),
+			cloudEventsHeaderPrefix + "schemaversion": strconv.Itoa(ce.SchemaVersion),
+		}
+		if ce.Subject != "" {
+			headers[cloudEventsHeaderPrefix+"subject"] = ce.Subject
+		}
+		return ce.Data, headers, nil
+	case FormatAvro:
+		return nil, nil, fmt.Errorf("%s events are written by an AvroSerializer", FormatAvro)
+	default:
+		return nil, nil, fmt.Errorf("unknown event format %q", format)
+	}
+}
+
+// Decode reads an event in any supported format. Binary CloudEvents are recognized by their
+// ce_specversion header; JSON values are decoded by FromJSON.
+func Decode(value []byte, headers map[string]string) (*StorageEvent, error) {
+	if headers[cloudEventsHeaderPrefix+"specversion"] == "" {
+		return FromJSON(value)
+	}
+
+	ce := cloudEvent{
+		SpecVersion: headers[cloudEventsHeaderPrefix+"specversion"],
+		ID:          headers[cloudEventsHeaderPrefix+"id"],
+		Source:      headers[cloudEventsHeaderPrefix+"source"],
+		Type:        headers[cloudEventsHeaderPrefix+"type"],
+		Subject:     headers[cloudEventsHeaderPrefix+"subject"],
+		Data:        value,
+	}
+	if t := headers[cloudEventsHeaderPrefix+"time"]; t != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ce_time %q", t)
+		}
+		ce.Time = parsed
+	}
+	if v := headers[cloudEventsHeaderPrefix+"schemaversion"]; v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ce_schemaversion %q", v)
+		}
+		ce.SchemaVersion = version
+	}
+	return fromCloudEvent(&ce)
+}
+
+func toCloudEvent(event *StorageEvent) (*cloudEvent, error) {
+	data, err := json.Marshal(cloudEventData{
+		Path:     event.Path,
+		Size:     event.Size,
+		UserID:   event.UserID,
+		TenantID: event.TenantID,
+		MetaData: event.MetaData,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              event.ID,
+		Source:          event.Source,
+		Type:            cloudEventsTypePrefix + string(event.Type),
+		Subject:         event.Path,
+		Time:            event.Timestamp,
+		DataContentType: contentTypeJSON,
+		SchemaVersion:   event.SchemaVersion,
+		Data:            data,
+	}, nil
+}
+
+func fromCloudEvent(ce *cloudEvent) (*StorageEvent, error) {
+	if ce.SpecVersion != cloudEventsSpecVersion {
+		return nil, fmt.Errorf("unsupported CloudEvents specversion %q", ce.SpecVersion)
+	}
+	eventType, ok := strings.CutPrefix(ce.Type, cloudEventsTypePrefix)
+	if !ok {
+		return nil, fmt.Errorf("unexpected CloudEvents type %q", ce.Type)
+	}
+	var data cloudEventData
+	if len(ce.Data) > 0 {
+		if err := json.Unmarshal(ce.Data, &data); err != nil {
+			return nil, fmt.Errorf("invalid CloudEvents data: %v", err)
+		}
+	}
+	if data.MetaData == nil {
+		data.MetaData = make(map[string]string)
+	}
+	return &StorageEvent{
+		ID:            ce.ID,
+		Type:          EventType(eventType),
+		Path:          data.Path,
+		Size:          data.Size,
+		Timestamp:     ce.Time,
+		Source:        ce.Source,
+		SchemaVersion: ce.SchemaVersion,
+		UserID:        data.UserID,
+		TenantID:      data.TenantID,
+		MetaData:      data.MetaData,
+	}, nil
+}
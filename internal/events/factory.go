@@ -0,0 +1,94 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SchemaVersion is the version of the StorageEvent layout this build writes. Consumers
+// reject events with a newer version rather than misreading them.
+const SchemaVersion = 1
+
+// AnonymousActor is the actor of events caused by unauthenticated requests.
+const AnonymousActor = "anonymous"
+
+// Factory creates the events published by one service.
+type Factory struct {
+	// Source names the publishing service, e.g. "storage-server".
+	Source string
+}
+
+// NewFactory returns a factory for events published by source.
+func NewFactory(source string) *Factory {
+	return &Factory{Source: source}
+}
+
+// New returns an event with a unique, time-ordered ID, the current UTC time and the
+// factory's source. An empty actor is recorded as AnonymousActor.
+func (f *Factory) New(eventType EventType, path, actor string) *StorageEvent {
+	if actor == "" {
+		actor = AnonymousActor
+	}
+	return &StorageEvent{
+		ID:            uuid.Must(uuid.NewV7()).String(),
+		Type:          eventType,
+		Path:          path,
+		Timestamp:     time.Now().UTC(),
+		Source:        f.Source,
+		SchemaVersion: SchemaVersion,
+		UserID:        actor,
+	}
+}
+
+// knownTypes are the event types consumers understand.
+var knownTypes = map[EventType]bool{
+	FileUploaded:     true,
+	FileDeleted:      true,
+	FileAppended:     true,
+	FileMoved:        true,
+	DirectoryCreated: true,
+	DirectoryDeleted: true,
+}
+
+// ErrInvalidEvent is returned for events that are malformed or from a newer schema.
+var ErrInvalidEvent = errors.New("invalid event")
+
+// Validate reports every problem that makes e unsafe to publish or handle.
+func (e *StorageEvent) Validate() error {
+	var problems []string
+	if _, err := uuid.Parse(e.ID); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid id %q", e.ID))
+	}
+	if !knownTypes[e.Type] {
+		problems = append(problems, fmt.Sprintf("unknown type %q", e.Type))
+	}
+	if e.Path == "" {
+		problems = append(problems, "path is required")
+	}
+	if e.Size < 0 {
+		problems = append(problems, fmt.Sprintf("negative size %d", e.Size))
+	}
+	if e.Timestamp.IsZero() {
+		problems = append(problems, "timestamp is required")
+	}
+	if e.Source == "" {
+		problems = append(problems, "source is required")
+	}
+	if e.SchemaVersion < 1 || e.SchemaVersion > SchemaVersion {
+		problems = append(problems, fmt.Sprintf("unsupported schema version %d", e.SchemaVersion))
+	}
+	if e.UserID == "" {
+		problems = append(problems, "actor is required")
+	}
+	if e.Type == FileMoved && e.MetaData[MetaSourcePath] == "" {
+		problems = append(problems, fmt.Sprintf("%s metadata is required", MetaSourcePath))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidEvent, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hamba/avro/v2"
+)
+
+var (
+	// ErrIncompatibleSchema is returned when a schema cannot read data written with the
+	// subject's latest schema.
+	ErrIncompatibleSchema = errors.New("incompatible schema")
+	// ErrSchemaNotFound is returned for unknown schema IDs.
+	ErrSchemaNotFound = errors.New("schema not found")
+)
+
+// SchemaRegistry stores the schemas of message values by subject and identifies them by ID.
+type SchemaRegistry interface {
+	// Register adds schema as the latest version of subject and returns its ID. Registering
+	// a schema the subject already has returns its existing ID. A schema that cannot read
+	// data written with the subject's latest version fails with ErrIncompatibleSchema.
+	Register(ctx context.Context, subject, schema string) (int, error)
+	// Schema returns the schema with id.
+	Schema(ctx context.Context, id int) (string, error)
+}
+
+// CheckCompatibility reports whether data written with writer can be read with reader,
+// i.e. whether reader is a backward-compatible evolution of writer.
+func CheckCompatibility(reader, writer string) error {
+	readerSchema, err := parseSchema(reader)
+	if err != nil {
+		return err
+	}
+	writerSchema, err := parseSchema(writer)
+	if err != nil {
+		return err
+	}
+	if err := avro.NewSchemaCompatibility().Compatible(readerSchema, writerSchema); err != nil {
+		return fmt.Errorf("%w: %v", ErrIncompatibleSchema, err)
+	}
+	return nil
+}
+
+// parseSchema parses schema on its own, so versions of the same record do not collide in
+// the package-wide schema cache.
+func parseSchema(schema string) (avro.Schema, error) {
+	parsed, err := avro.ParseWithCache(schema, "", &avro.SchemaCache{})
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro schema: %v", err)
+	}
+	return parsed, nil
+}
+
+// registeredSchema is one version of a subject in a FileRegistry.
+type registeredSchema struct {
+	ID      int    `json:"id"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+	Schema  string `json:"schema"`
+}
+
+// FileRegistry keeps schemas in a local JSON file. It is meant for tests and single-host
+// setups; processes sharing the file should not register concurrently.
+type FileRegistry struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileRegistry returns a registry stored at path, which is created on first Register.
+func NewFileRegistry(path string) *FileRegistry {
+	return &FileRegistry{path: path}
+}
+
+func (r *FileRegistry) Register(_ context.Context, subject, schema string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	parsed, err := parseSchema(schema)
+	if err != nil {
+		return 0, err
+	}
+	schemas, err := r.load()
+	if err != nil {
+		return 0, err
+	}
+
+	var latest *registeredSchema
+	maxID := 0
+	for i := range schemas {
+		maxID = max(maxID, schemas[i].ID)
+		if schemas[i].Subject != subject {
+			continue
+		}
+		if existing, err := parseSchema(schemas[i].Schema); err == nil && existing.Fingerprint() == parsed.Fingerprint() {
+			return schemas[i].ID, nil
+		}
+		if latest == nil || schemas[i].Version > latest.Version {
+			latest = &schemas[i]
+		}
+	}
+
+	version := 1
+	if latest != nil {
+		if err := CheckCompatibility(schema, latest.Schema); err != nil {
+			return 0, fmt.Errorf("subject %s version %d: %w", subject, latest.Version, err)
+		}
+		version = latest.Version + 1
+	}
+	schemas = append(schemas, registeredSchema{ID: maxID + 1, Subject: subject, Version: version, Schema: schema})
+	if err := r.save(schemas); err != nil {
+		return 0, err
+	}
+	return maxID + 1, nil
+}
+
+func (r *FileRegistry) Schema(_ context.Context, id int) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	schemas, err := r.load()
+	if err != nil {
+		return "", err
+	}
+	for _, s := range schemas {
+		if s.ID == id {
+			return s.Schema, nil
+		}
+	}
+	return "", fmt.Errorf("%w: id %d", ErrSchemaNotFound, id)
+}
+
+func (r *FileRegistry) load() ([]registeredSchema, error) {
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema registry: %v", err)
+	}
+	var file struct {
+		Schemas []registeredSchema `json:"schemas"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse schema registry: %v", err)
+	}
+	return file.Schemas, nil
+}
+
+// save replaces the file atomically so readers never see a partial write.
+func (r *FileRegistry) save(schemas []registeredSchema) error {
+	data, err := json.MarshalIndent(map[string]any{"schemas": schemas}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), ".schemas-*")
+	if err != nil {
+		return fmt.Errorf("failed to write schema registry: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write schema registry: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write schema registry: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return fmt.Errorf("failed to write schema registry: %v", err)
+	}
+	return nil
+}
+
+// ConfluentRegistry is a client for a Confluent-compatible schema registry, which checks
+// compatibility itself according to the subject's configured level.
+type ConfluentRegistry struct {
+	url    string
+	client *http.Client
+}
+
+// NewConfluentRegistry returns a client for the registry at baseURL.
+func NewConfluentRegistry(baseURL string) *ConfluentRegistry {
+	return &ConfluentRegistry{url: strings.TrimSuffix(baseURL, "/"), client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (r *ConfluentRegistry) Register(ctx context.Context, subject, schema string) (int, error) {
+	body, _ := json.Marshal(map[string]string{"schema": schema})
+	var result struct {
+		ID int `json:"id"`
+	}
+	err := r.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", body, &result)
+	return result.ID, err
+}
+
+func (r *ConfluentRegistry) Schema(ctx context.Context, id int) (string, error) {
+	var result struct {
+		Schema string `json:"schema"`
+	}
+	err := r.do(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &result)
+	return result.Schema, err
+}
+
+func (r *ConfluentRegistry) do(ctx context.Context, method, path string, body []byte, result any) error {
+	req, err := http.NewRequestWithContext(ctx, method, r.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("schema registry request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		switch resp.StatusCode {
+		case http.StatusConflict:
+			return fmt.Errorf("%w: %s", ErrIncompatibleSchema, message)
+		case http.StatusNotFound:
+			return fmt.Errorf("%w: %s", ErrSchemaNotFound, message)
+		}
+		return fmt.Errorf("schema registry returned %s: %s", resp.Status, message)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
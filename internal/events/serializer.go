@@ -0,0 +1,43 @@
+package events
+
+import (
+	"context"
+	"fmt"
+)
+
+// Serializer converts events to and from the value and headers of messages on one topic.
+type Serializer interface {
+	Serialize(ctx context.Context, event *StorageEvent) ([]byte, map[string]string, error)
+	// Deserialize reads a message written in any format the serializer understands, so
+	// consumers keep working while a topic migrates between formats.
+	Deserialize(ctx context.Context, value []byte, headers map[string]string) (*StorageEvent, error)
+}
+
+// JSONSerializer writes events in one of the JSON formats and reads all of them.
+type JSONSerializer struct {
+	Format Format
+}
+
+func (s JSONSerializer) Serialize(_ context.Context, event *StorageEvent) ([]byte, map[string]string, error) {
+	return Encode(event, s.Format)
+}
+
+func (s JSONSerializer) Deserialize(_ context.Context, value []byte, headers map[string]string) (*StorageEvent, error) {
+	return Decode(value, headers)
+}
+
+// NewSerializer returns the serializer for format on topic. registry is only used, and
+// then required, for FormatAvro.
+func NewSerializer(format Format, topic string, registry SchemaRegistry) (Serializer, error) {
+	switch format {
+	case FormatAvro:
+		if registry == nil {
+			return nil, fmt.Errorf("%s events need a schema registry", FormatAvro)
+		}
+		return NewAvroSerializer(registry, topic)
+	case FormatLegacy, FormatCloudEventsStructured, FormatCloudEventsBinary:
+		return JSONSerializer{Format: format}, nil
+	default:
+		return nil, fmt.Errorf("unknown event format %q", format)
+	}
+}
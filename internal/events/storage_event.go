@@ -1,6 +1,7 @@
 package events
 
 import (
+	"context"
 	"encoding/json"
 	"time"
 )
@@ -12,19 +13,31 @@ const (
 	FileUploaded     EventType = "FileUploaded"
 	FileDeleted      EventType = "FileDeleted"
 	FileAppended     EventType = "FileAppended"
+	FileMoved        EventType = "FileMoved"
 	DirectoryCreated EventType = "DirectoryCreated"
 	DirectoryDeleted EventType = "DirectoryDeleted"
 )
 
-// StorageEvent
+// MetaSourcePath is the metadata key holding the previous path of a FileMoved event.
+const MetaSourcePath = "sourcePath"
+
+// MetaRequestID is the metadata key holding the ID of the request that caused the event.
+const MetaRequestID = "requestId"
+
+// StorageEvent describes a change to a file or directory. Create events with a Factory so
+// the envelope (ID, Timestamp, Source, SchemaVersion and actor) is always filled in.
 type StorageEvent struct {
-	ID        string            `json:"id"`
-	Type      EventType         `json:"type"`
-	Path      string            `json:"path"`
-	Size      int64             `json:"size,omitempty"`
-	Timestamp time.Time         `json:"timestamp"`
-	UserID    string            `json:"userId,omitempty"`
-	MetaData  map[string]string `json:"metadata,omitempty"`
+	ID            string    `json:"id"`
+	Type          EventType `json:"type"`
+	Path          string    `json:"path"`
+	Size          int64     `json:"size,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+	Source        string    `json:"source"`
+	SchemaVersion int       `json:"schemaVersion"`
+	// UserID is the actor that caused the event, or AnonymousActor.
+	UserID   string            `json:"userId,omitempty"`
+	TenantID string            `json:"tenantId,omitempty"`
+	MetaData map[string]string `json:"metadata,omitempty"`
 }
 
 // 🔹 Convert
@@ -32,8 +45,22 @@ func (e *StorageEvent) ToJSON() ([]byte, error) {
 	return json.Marshal(e)
 }
 
-// 🔹 Parse JSON
+// 🔹 Parse JSON, either the legacy StorageEvent layout or a structured CloudEvent
 func FromJSON(data []byte) (*StorageEvent, error) {
+	var probe struct {
+		SpecVersion string `json:"specversion"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+	if probe.SpecVersion != "" {
+		var ce cloudEvent
+		if err := json.Unmarshal(data, &ce); err != nil {
+			return nil, err
+		}
+		return fromCloudEvent(&ce)
+	}
+
 	var event StorageEvent
 	if err := json.Unmarshal(data, &event); err != nil {
 		return nil, err
@@ -53,6 +80,6 @@ type EventListener interface {
 
 // EventPublisher
 type EventPublisher interface {
-	Publish(topic string, event *StorageEvent) error
+	Publish(ctx context.Context, topic string, event *StorageEvent) error
 	Close()
 }
@@ -0,0 +1,150 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Status values in reports.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// DefaultTimeout bounds a probe when the checker sets no timeout for it.
+const DefaultTimeout = 2 * time.Second
+
+// Check is a dependency probe.
+type Check struct {
+	Name  string
+	Probe func(ctx context.Context) error
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Report is the outcome of all checks; Status is ok only when every check passed.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Checker runs dependency checks for the liveness and readiness endpoints.
+type Checker struct {
+	// Timeout bounds each probe; zero means DefaultTimeout.
+	Timeout time.Duration
+	// Timeouts overrides Timeout by check name.
+	Timeouts map[string]time.Duration
+
+	checks []Check
+	mu     sync.RWMutex
+}
+
+// NewChecker returns a checker without checks.
+func NewChecker(timeout time.Duration, timeouts map[string]time.Duration) *Checker {
+	return &Checker{Timeout: timeout, Timeouts: timeouts}
+}
+
+// Add registers a dependency check for readiness.
+func (c *Checker) Add(check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check)
+}
+
+// Ready runs all checks concurrently, each bounded by its timeout.
+func (c *Checker) Ready(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := append([]Check(nil), c.checks...)
+	c.mu.RUnlock()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	for i, check := range checks {
+		report.Checks[check.Name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	timeout := c.Timeouts[check.Name]
+	if timeout <= 0 {
+		timeout = c.Timeout
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check.Probe(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// Probes that ignore ctx are left to finish in the background.
+		err = ctx.Err()
+	}
+
+	result := Result{Status: StatusOK, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = StatusUnavailable
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// LivenessHandler reports that the process is up and serving; it does not probe dependencies,
+// so a broken dependency makes the instance unready rather than restarting it.
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, Report{Status: StatusOK})
+	})
+}
+
+// ReadinessHandler runs the checks and answers 503 when any of them fails.
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, c.Ready(r.Context()))
+	})
+}
+
+// Handler serves /healthz and /readyz, for binaries without an API router.
+func (c *Checker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /healthz", c.LivenessHandler())
+	mux.Handle("GET /readyz", c.ReadinessHandler())
+	return mux
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,166 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"project-root/internal/events"
+)
+
+var (
+	// ErrQueueFull is returned by Publish in async mode when QueueSize messages are waiting.
+	ErrQueueFull = errors.New("kafka producer queue is full")
+	// ErrClosed is returned by Publish once Close has begun.
+	ErrClosed = errors.New("kafka client is closed")
+)
+
+// Headers added to messages sent to the dead-letter topic.
+const (
+	OriginalTopicHeader = "x-original-topic"
+	DeliveryErrorHeader = "x-delivery-error"
+)
+
+// FailureHandler takes an async message that failed delivery, e.g. to record it for
+// redelivery. When it returns an error the message goes to the dead-letter topic.
+type FailureHandler func(ctx context.Context, topic string, event *events.StorageEvent, err error) error
+
+// delivery follows an async message to its delivery report.
+type delivery struct {
+	ctx        context.Context
+	span       trace.Span
+	event      *events.StorageEvent
+	deadLetter bool
+}
+
+// SetFailureHandler sets the handler for async messages that failed delivery.
+func (k *KafkaClient) SetFailureHandler(handler FailureHandler) {
+	k.inputMu.Lock()
+	defer k.inputMu.Unlock()
+	k.onFailure = handler
+}
+
+// enqueue hands msg to the async producer; its span ends with the delivery report.
+func (k *KafkaClient) enqueue(ctx context.Context, span trace.Span, msg *sarama.ProducerMessage, event *events.StorageEvent) error {
+	k.inputMu.RLock()
+	defer k.inputMu.RUnlock()
+
+	err := ErrClosed
+	if !k.closing {
+		err = ErrQueueFull
+		if k.queued.Add(1) <= k.queueSize {
+			// The report may come after the request that published the event has finished.
+			msg.Metadata = &delivery{ctx: context.WithoutCancel(ctx), span: span, event: event}
+			select {
+			case k.async.Input() <- msg:
+				producerQueue.Set(float64(k.queued.Load()))
+				return nil
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		}
+		k.queued.Add(-1)
+	}
+
+	publishedMessages.WithLabelValues(msg.Topic, "failure").Inc()
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	span.End()
+	slog.ErrorContext(ctx, "Failed to queue message for Kafka", "topic", msg.Topic, "error", err)
+	return err
+}
+
+// reportDeliveries handles delivery reports until the async producer is closed.
+func (k *KafkaClient) reportDeliveries() {
+	k.deliveries.Add(2)
+	go func() {
+		defer k.deliveries.Done()
+		for msg := range k.async.Successes() {
+			k.delivered(msg)
+		}
+	}()
+	go func() {
+		defer k.deliveries.Done()
+		for failure := range k.async.Errors() {
+			k.deliveryFailed(failure.Msg, failure.Err)
+		}
+	}()
+}
+
+func (k *KafkaClient) delivered(msg *sarama.ProducerMessage) {
+	producerQueue.Set(float64(k.queued.Add(-1)))
+	publishedMessages.WithLabelValues(msg.Topic, "success").Inc()
+	d := msg.Metadata.(*delivery)
+	d.span.End()
+	slog.InfoContext(d.ctx, "Message published to Kafka", "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset)
+}
+
+// deliveryFailed passes a failed message to the failure handler, then to the dead-letter
+// topic, and drops it when neither takes it.
+func (k *KafkaClient) deliveryFailed(msg *sarama.ProducerMessage, err error) {
+	producerQueue.Set(float64(k.queued.Add(-1)))
+	publishedMessages.WithLabelValues(msg.Topic, "failure").Inc()
+	d := msg.Metadata.(*delivery)
+	d.span.RecordError(err)
+	d.span.SetStatus(codes.Error, err.Error())
+	d.span.End()
+	slog.ErrorContext(d.ctx, "Failed to publish message to Kafka", "topic", msg.Topic, "error", err)
+
+	topic := msg.Topic
+	if d.deadLetter {
+		topic = producerHeaders{msg}.Get(OriginalTopicHeader)
+	} else {
+		k.inputMu.RLock()
+		handler := k.onFailure
+		k.inputMu.RUnlock()
+		if handler != nil {
+			handlerErr := handler(d.ctx, msg.Topic, d.event, err)
+			if handlerErr == nil {
+				undeliverableMessages.WithLabelValues(topic, "requeued").Inc()
+				return
+			}
+			slog.ErrorContext(d.ctx, "Kafka failure handler failed", "topic", msg.Topic, "error", handlerErr)
+		}
+		if k.deadLetterTopic != "" && k.sendDeadLetter(d, msg, err) {
+			undeliverableMessages.WithLabelValues(topic, "dead_letter").Inc()
+			return
+		}
+	}
+	undeliverableMessages.WithLabelValues(topic, "dropped").Inc()
+	slog.ErrorContext(d.ctx, "Dropped undeliverable event", "topic", topic, "id", d.event.ID, "type", d.event.Type, "path", d.event.Path)
+}
+
+// sendDeadLetter queues msg for the dead-letter topic without blocking the delivery reports,
+// which the producer may be waiting on. It reports whether the message was queued; once
+// Close has begun the producer takes no new messages, so only the failure handler remains.
+func (k *KafkaClient) sendDeadLetter(d *delivery, msg *sarama.ProducerMessage, cause error) bool {
+	ctx, span := tracer.Start(d.ctx, "publish "+k.deadLetterTopic, trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("messaging.destination.name", k.deadLetterTopic), attribute.String("event.type", string(d.event.Type))))
+	deadLetter := &sarama.ProducerMessage{
+		Topic:    k.deadLetterTopic,
+		Value:    msg.Value,
+		Headers:  append([]sarama.RecordHeader(nil), msg.Headers...),
+		Metadata: &delivery{ctx: ctx, span: span, event: d.event, deadLetter: true},
+	}
+	producerHeaders{deadLetter}.Set(OriginalTopicHeader, msg.Topic)
+	producerHeaders{deadLetter}.Set(DeliveryErrorHeader, cause.Error())
+
+	k.inputMu.RLock()
+	defer k.inputMu.RUnlock()
+	if !k.closing {
+		k.queued.Add(1)
+		select {
+		case k.async.Input() <- deadLetter:
+			return true
+		default:
+			k.queued.Add(-1)
+		}
+	}
+	span.End()
+	return false
+}
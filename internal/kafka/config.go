@@ -0,0 +1,274 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/xdg-go/scram"
+)
+
+// Config describes the brokers and the producer and consumer settings of a KafkaClient.
+type Config struct {
+	Brokers []string
+	GroupID string
+	// ClientID identifies the client in broker logs and quotas; empty uses sarama's default.
+	ClientID string
+	// Version is the Kafka protocol version, e.g. "3.6.0"; empty uses sarama's default.
+	Version  string
+	Producer ProducerConfig
+	Consumer ConsumerConfig
+	TLS      TLSConfig
+	SASL     SASLConfig
+}
+
+// ProducerConfig controls delivery guarantees of published events.
+type ProducerConfig struct {
+	// RequiredAcks is -1 (all in-sync replicas), 1 (leader) or 0 (none); nil waits for
+	// all in-sync replicas, so an acknowledged event survives the loss of the leader.
+	RequiredAcks *int
+	// Compression is none, gzip, snappy, lz4 or zstd; empty is none.
+	Compression string
+	// Retries is how often a failed send is retried; nil uses sarama's default of 3.
+	Retries *int
+	// Idempotent makes retries exactly-once per partition; it needs RequiredAcks -1.
+	Idempotent bool
+	// Mode is ProducerSync (default), where Publish waits for the brokers to acknowledge each
+	// message, or ProducerAsync, where it queues the message and returns.
+	Mode string
+	// BatchSize and Linger send an async batch once it holds this many messages or has waited
+	// this long, so Close may wait up to Linger. QueueSize bounds the async messages queued
+	// or in flight.
+	BatchSize int
+	Linger    time.Duration
+	QueueSize int
+	// DeadLetterTopic receives async messages that failed delivery and were not taken by the
+	// failure handler; empty drops them.
+	DeadLetterTopic string
+}
+
+// Producer modes.
+const (
+	ProducerSync  = "sync"
+	ProducerAsync = "async"
+)
+
+// DefaultQueueSize bounds the async producer queue when QueueSize is not set.
+const DefaultQueueSize = 10000
+
+// ConsumerConfig controls where consumer groups start and how partitions are assigned.
+type ConsumerConfig struct {
+	// InitialOffset is newest (default) or oldest, used when the group has no committed offset.
+	InitialOffset string
+	// RebalanceStrategy is roundrobin (default), range or sticky.
+	RebalanceStrategy string
+}
+
+// TLSConfig encrypts broker connections when Enabled. CAFile verifies the brokers instead of
+// the system roots; CertFile and KeyFile present a client certificate.
+type TLSConfig struct {
+	Enabled            bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// SASL mechanisms.
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// SASLConfig authenticates to the brokers; an empty Mechanism disables SASL.
+type SASLConfig struct {
+	Mechanism string
+	Username  string
+	Password  string
+}
+
+// saramaConfig translates config into sarama's settings and validates them.
+func saramaConfig(config Config) (*sarama.Config, error) {
+	sc := sarama.NewConfig()
+	if config.ClientID != "" {
+		sc.ClientID = config.ClientID
+	}
+	if config.Version != "" {
+		version, err := sarama.ParseKafkaVersion(config.Version)
+		if err != nil {
+			return nil, err
+		}
+		sc.Version = version
+	}
+
+	sc.Producer.RequiredAcks = sarama.WaitForAll
+	if config.Producer.RequiredAcks != nil {
+		switch acks := sarama.RequiredAcks(*config.Producer.RequiredAcks); acks {
+		case sarama.WaitForAll, sarama.WaitForLocal, sarama.NoResponse:
+			sc.Producer.RequiredAcks = acks
+		default:
+			return nil, fmt.Errorf("invalid producer requiredAcks %d", acks)
+		}
+	}
+	codec, err := compressionCodec(config.Producer.Compression)
+	if err != nil {
+		return nil, err
+	}
+	sc.Producer.Compression = codec
+	if config.Producer.Retries != nil {
+		if *config.Producer.Retries < 0 {
+			return nil, fmt.Errorf("invalid producer retries %d", *config.Producer.Retries)
+		}
+		sc.Producer.Retry.Max = *config.Producer.Retries
+	}
+	sc.Producer.Return.Successes = true
+	switch config.Producer.Mode {
+	case "", ProducerSync:
+	case ProducerAsync:
+		// Sarama only sends a partial batch when the linger time is up, also when closing.
+		if config.Producer.BatchSize > 0 && config.Producer.Linger <= 0 {
+			return nil, fmt.Errorf("producer batchSize %d needs a linger time", config.Producer.BatchSize)
+		}
+		sc.Producer.Flush.Messages = config.Producer.BatchSize
+		sc.Producer.Flush.Frequency = config.Producer.Linger
+		sc.Producer.Return.Errors = true
+	default:
+		return nil, fmt.Errorf("invalid producer mode %q", config.Producer.Mode)
+	}
+	if config.Producer.Idempotent {
+		sc.Producer.Idempotent = true
+		// Sarama only keeps ordering, and so idempotence, with one request in flight.
+		sc.Net.MaxOpenRequests = 1
+	}
+
+	switch config.Consumer.InitialOffset {
+	case "", "newest":
+		sc.Consumer.Offsets.Initial = sarama.OffsetNewest
+	case "oldest":
+		sc.Consumer.Offsets.Initial = sarama.OffsetOldest
+	default:
+		return nil, fmt.Errorf("invalid consumer initialOffset %q", config.Consumer.InitialOffset)
+	}
+	switch config.Consumer.RebalanceStrategy {
+	case "", "roundrobin":
+		sc.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
+	case "range":
+		sc.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRange()}
+	case "sticky":
+		sc.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategySticky()}
+	default:
+		return nil, fmt.Errorf("invalid consumer rebalanceStrategy %q", config.Consumer.RebalanceStrategy)
+	}
+
+	if config.TLS.Enabled {
+		tlsConfig, err := clientTLSConfig(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		sc.Net.TLS.Enable = true
+		sc.Net.TLS.Config = tlsConfig
+	}
+	if err := configureSASL(sc, config.SASL); err != nil {
+		return nil, err
+	}
+
+	if err := sc.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid Kafka configuration: %v", err)
+	}
+	return sc, nil
+}
+
+// compressionCodec parses a codec name, or its number (0=none, 1=gzip, 2=snappy, 3=lz4,
+// 4=zstd) as older configuration files have it.
+func compressionCodec(name string) (sarama.CompressionCodec, error) {
+	codec := sarama.CompressionNone
+	if name == "" {
+		return codec, nil
+	}
+	if n, err := strconv.Atoi(name); err == nil && n >= int(sarama.CompressionNone) && n <= int(sarama.CompressionZSTD) {
+		return sarama.CompressionCodec(n), nil
+	}
+	if err := codec.UnmarshalText([]byte(strings.ToLower(name))); err != nil {
+		return codec, fmt.Errorf("invalid producer compression %q", name)
+	}
+	return codec, nil
+}
+
+func clientTLSConfig(config TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Kafka CA file: %v", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in Kafka CA file %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Kafka client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func configureSASL(sc *sarama.Config, config SASLConfig) error {
+	if config.Mechanism == "" {
+		return nil
+	}
+	sc.Net.SASL.Enable = true
+	sc.Net.SASL.User = config.Username
+	sc.Net.SASL.Password = config.Password
+	switch strings.ToUpper(config.Mechanism) {
+	case SASLPlain:
+		sc.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case SASLScramSHA256:
+		sc.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		sc.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: scram.SHA256} }
+	case SASLScramSHA512:
+		sc.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		sc.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: scram.SHA512} }
+	default:
+		return fmt.Errorf("unsupported SASL mechanism %q", config.Mechanism)
+	}
+	return nil
+}
+
+// scramClient runs one SCRAM conversation for sarama.
+type scramClient struct {
+	hash         scram.HashGeneratorFcn
+	conversation *scram.ClientConversation
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hash.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
@@ -2,83 +2,192 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"project-root/internal/events"
+	"project-root/pkg/logger"
 )
 
+// Handler processes a consumed event. ctx carries the trace started by the publisher; a
+// returned error is logged and recorded on the event's span.
+type Handler func(ctx context.Context, event *events.StorageEvent) error
+
 // Kafka producer and consumer.
 type KafkaClient struct {
+	client        sarama.Client
 	producer      sarama.SyncProducer
+	async         sarama.AsyncProducer // set instead of producer in async mode
 	consumerGroup sarama.ConsumerGroup
-	handlers      map[events.EventType]func(event *events.StorageEvent)
+	handlers      map[events.EventType]Handler
 	handlersMutex sync.RWMutex
+	serializers   map[string]events.Serializer
+	serializersMu sync.RWMutex
 	cancel        context.CancelFunc
 	wg            sync.WaitGroup
+	closeOnce     sync.Once
+
+	// Async mode: queued counts messages awaiting a delivery report, up to queueSize.
+	queueSize       int64
+	queued          atomic.Int64
+	deadLetterTopic string
+	onFailure       FailureHandler
+	deliveries      sync.WaitGroup
+	// inputMu guards closing and onFailure; sends to the async producer hold it for reading.
+	inputMu sync.RWMutex
+	closing bool
 }
 
-// NewKafkaClient
-func NewKafkaClient(brokers []string, groupID string) (*KafkaClient, error) {
-	config := sarama.NewConfig()
-	config.Producer.RequiredAcks = sarama.WaitForAll
-	config.Producer.Retry.Max = 5
-	config.Producer.Return.Successes = true
-	config.Consumer.Offsets.Initial = sarama.OffsetNewest
-	config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin
+// NewKafkaClient connects to config.Brokers and joins config.GroupID when consuming.
+func NewKafkaClient(config Config) (*KafkaClient, error) {
+	saramaConfig, err := saramaConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// The producer shares its client with Ping, so health checks see the producer's brokers.
+	client, err := sarama.NewClient(config.Brokers, saramaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Kafka: %v", err)
+	}
+
+	k := &KafkaClient{
+		client:          client,
+		handlers:        make(map[events.EventType]Handler),
+		serializers:     make(map[string]events.Serializer),
+		queueSize:       int64(config.Producer.QueueSize),
+		deadLetterTopic: config.Producer.DeadLetterTopic,
+	}
+	if k.queueSize <= 0 {
+		k.queueSize = DefaultQueueSize
+	}
 
 	// Create producer
-	producer, err := sarama.NewSyncProducer(brokers, config)
+	if config.Producer.Mode == ProducerAsync {
+		k.async, err = sarama.NewAsyncProducerFromClient(client)
+	} else {
+		k.producer, err = sarama.NewSyncProducerFromClient(client)
+	}
 	if err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to create Kafka producer: %v", err)
 	}
+	if k.async != nil {
+		k.reportDeliveries()
+	}
 
 	// Create
-	consumerGroup, err := sarama.NewConsumerGroup(brokers, groupID, config)
+	k.consumerGroup, err = sarama.NewConsumerGroup(config.Brokers, config.GroupID, saramaConfig)
 	if err != nil {
-		producer.Close()
+		k.closeProducer()
+		client.Close()
 		return nil, fmt.Errorf("failed to create Kafka consumer group: %v", err)
 	}
-
-	return &KafkaClient{
-		producer:      producer,
-		consumerGroup: consumerGroup,
-		handlers:      make(map[events.EventType]func(event *events.StorageEvent)),
-	}, nil
+	return k, nil
 }
 
-// Publish
-func (k *KafkaClient) Publish(topic string, event *events.StorageEvent) error {
-	message, err := json.Marshal(event)
+// Publish sends event to topic, with ctx's trace context and request ID in the message headers.
+// In async mode it returns once the message is queued; delivery failures then go to the
+// failure handler or the dead-letter topic.
+func (k *KafkaClient) Publish(ctx context.Context, topic string, event *events.StorageEvent) error {
+	if err := event.Validate(); err != nil {
+		publishedMessages.WithLabelValues(topic, "failure").Inc()
+		return err
+	}
+	value, headers, err := k.serializer(topic).Serialize(ctx, event)
 	if err != nil {
 		return fmt.Errorf("failed to serialize event: %v", err)
 	}
 
+	ctx, span := tracer.Start(ctx, "publish "+topic, trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("messaging.destination.name", topic), attribute.String("event.type", string(event.Type))))
+
 	msg := &sarama.ProducerMessage{
 		Topic: topic,
-		Value: sarama.ByteEncoder(message),
+		Value: sarama.ByteEncoder(value),
+	}
+	for key, header := range headers {
+		producerHeaders{msg}.Set(key, header)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, producerHeaders{msg})
+	if id := logger.RequestIDFromContext(ctx); id != "" {
+		producerHeaders{msg}.Set(RequestIDHeader, id)
+	}
+
+	if k.async != nil {
+		return k.enqueue(ctx, span, msg, event)
+	}
+	defer span.End()
+	k.inputMu.RLock()
+	closing := k.closing
+	k.inputMu.RUnlock()
+	if closing {
+		publishedMessages.WithLabelValues(topic, "failure").Inc()
+		return ErrClosed
 	}
 
 	partition, offset, err := k.producer.SendMessage(msg)
 	if err != nil {
-		log.Printf("❌ Failed to publish message to Kafka: %v", err)
+		publishedMessages.WithLabelValues(topic, "failure").Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		slog.ErrorContext(ctx, "Failed to publish message to Kafka", "topic", topic, "error", err)
 		return err
 	}
+	publishedMessages.WithLabelValues(topic, "success").Inc()
 
-	log.Printf("✅ Message published to Kafka [Topic: %s, Partition: %d, Offset: %d]", topic, partition, offset)
+	slog.InfoContext(ctx, "Message published to Kafka", "topic", topic, "partition", partition, "offset", offset)
 	return nil
 }
 
+// Ping refreshes cluster metadata to check that the brokers are reachable.
+func (k *KafkaClient) Ping(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() { done <- k.client.RefreshMetadata() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("brokers are not reachable: %v", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetSerializer selects how events on topic are encoded and decoded; the default writes
+// events.FormatLegacy and reads every JSON format.
+func (k *KafkaClient) SetSerializer(topic string, serializer events.Serializer) {
+	k.serializersMu.Lock()
+	defer k.serializersMu.Unlock()
+	k.serializers[topic] = serializer
+}
+
+func (k *KafkaClient) serializer(topic string) events.Serializer {
+	k.serializersMu.RLock()
+	defer k.serializersMu.RUnlock()
+	if serializer, ok := k.serializers[topic]; ok {
+		return serializer
+	}
+	return events.JSONSerializer{Format: events.FormatLegacy}
+}
+
 // RegisterHandler
-func (k *KafkaClient) RegisterHandler(eventType events.EventType, handler func(event *events.StorageEvent)) {
+func (k *KafkaClient) RegisterHandler(eventType events.EventType, handler Handler) {
 	k.handlersMutex.Lock()
 	defer k.handlersMutex.Unlock()
 	k.handlers[eventType] = handler
-	log.Printf("✅ Registered handler for event type: %s", eventType)
+	slog.Info("Registered Kafka handler", "type", eventType)
 }
 
 // StartConsumers begins consuming messages from Kafka topics.
@@ -92,7 +201,7 @@ func (k *KafkaClient) StartConsumers(ctx context.Context, topics []string) error
 		defer k.wg.Done()
 		for {
 			if err := k.consumerGroup.Consume(ctx, topics, k); err != nil {
-				log.Printf("❌ Error during Kafka consumption: %v", err)
+				slog.Error("Error during Kafka consumption", "error", err)
 			}
 
 			// Check if context is done
@@ -105,43 +214,84 @@ func (k *KafkaClient) StartConsumers(ctx context.Context, topics []string) error
 	return nil
 }
 
-// Close shuts down the Kafka producer, consumer, and any active goroutines.
+// Close stops consuming once in-flight handlers return, commits their offsets and shuts
+// down the producer after it has flushed, including queued async messages. Calling it
+// again does nothing.
 func (k *KafkaClient) Close() {
-	if k.cancel != nil {
-		k.cancel()
-	}
-	k.wg.Wait()
-	k.producer.Close()
-	k.consumerGroup.Close()
-	log.Println("✅ Kafka client closed")
+	k.closeOnce.Do(func() {
+		k.inputMu.Lock()
+		k.closing = true
+		k.inputMu.Unlock()
+		if k.cancel != nil {
+			k.cancel()
+		}
+		k.wg.Wait()
+		if err := k.consumerGroup.Close(); err != nil {
+			slog.Error("Failed to close Kafka consumer group", "error", err)
+		}
+		k.closeProducer()
+		if err := k.client.Close(); err != nil {
+			slog.Error("Failed to close Kafka client", "error", err)
+		}
+		slog.Info("Kafka client closed")
+	})
 }
 
 // ConsumeClaim processes Kafka messages from a specific topic/partition.
 func (k *KafkaClient) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	for message := range claim.Messages() {
-		var event events.StorageEvent
-		if err := json.Unmarshal(message.Value, &event); err != nil {
-			log.Printf("❌ Failed to parse Kafka message: %v", err)
-			continue
+	for {
+		// Stop at the end of the session, which may come before the channel is closed.
+		var message *sarama.ConsumerMessage
+		select {
+		case <-sess.Context().Done():
+			return nil
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			message = msg
 		}
+		lag := claim.HighWaterMarkOffset() - message.Offset - 1
+		consumerLag.WithLabelValues(message.Topic, strconv.Itoa(int(message.Partition))).Set(float64(max(lag, 0)))
 
-		log.Printf("📩 Received event from Kafka: %+v", event)
+		event, err := k.serializer(message.Topic).Deserialize(sess.Context(), message.Value, consumerHeaders{message}.Map())
+		if err == nil {
+			err = event.Validate()
+		}
+		if err != nil {
+			slog.Error("Rejected Kafka message", "topic", message.Topic, "partition", message.Partition, "offset", message.Offset, "error", err)
+			continue
+		}
 
 		// Find and execute the handler for the event type
 		k.handlersMutex.RLock()
 		handler, exists := k.handlers[event.Type]
 		k.handlersMutex.RUnlock()
 		if exists {
-			handler(&event)
+			// Continue the publisher's trace so handler spans link back to the request. The
+			// handler may outlive the session at shutdown, so it gets no cancellation.
+			ctx := otel.GetTextMapPropagator().Extract(sess.Context(), consumerHeaders{message})
+			if id := requestID(message, event); id != "" {
+				ctx = logger.WithRequestID(ctx, id)
+			}
+			ctx, span := tracer.Start(ctx, "process "+string(event.Type), trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(attribute.String("messaging.destination.name", message.Topic), attribute.String("file.path", event.Path)))
+			slog.InfoContext(ctx, "Received event from Kafka", "type", event.Type, "path", event.Path, "offset", message.Offset)
+			start := time.Now()
+			if err := handler(context.WithoutCancel(ctx), event); err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				slog.ErrorContext(ctx, "Kafka handler failed", "type", event.Type, "path", event.Path, "error", err)
+			}
+			handlerDuration.WithLabelValues(string(event.Type)).Observe(time.Since(start).Seconds())
+			span.End()
 		} else {
-			log.Printf("⚠️ No handler registered for event type: %s", event.Type)
+			slog.Warn("No handler registered for event type", "type", event.Type)
 		}
 
 		// Mark the message as processed
 		sess.MarkMessage(message, "")
 	}
-
-	return nil
 }
 
 // Setup is called once when the consumer group session begins.
@@ -149,7 +299,22 @@ func (k *KafkaClient) Setup(sarama.ConsumerGroupSession) error {
 	return nil
 }
 
-// Cleanup is called once when the consumer group session ends.
-func (k *KafkaClient) Cleanup(sarama.ConsumerGroupSession) error {
+// Cleanup is called once when the consumer group session ends, after all claims have
+// returned. It commits the marked offsets so a restart does not replay handled events.
+func (k *KafkaClient) Cleanup(sess sarama.ConsumerGroupSession) error {
+	sess.Commit()
 	return nil
 }
+
+// closeProducer flushes the producer. Async delivery reports are handled until the last
+// queued message has been reported.
+func (k *KafkaClient) closeProducer() {
+	if k.async != nil {
+		k.async.AsyncClose()
+		k.deliveries.Wait()
+		return
+	}
+	if err := k.producer.Close(); err != nil {
+		slog.Error("Failed to close Kafka producer", "error", err)
+	}
+}
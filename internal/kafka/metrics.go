@@ -0,0 +1,30 @@
+package kafka
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	publishedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_published_messages_total",
+		Help: "Messages published by topic and result (success or failure).",
+	}, []string{"topic", "result"})
+	producerQueue = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kafka_producer_queue_depth",
+		Help: "Async producer messages queued or awaiting a delivery report.",
+	})
+	undeliverableMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_undeliverable_messages_total",
+		Help: "Async messages that failed delivery by topic and outcome (requeued, dead_letter or dropped).",
+	}, []string{"topic", "outcome"})
+	consumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kafka_consumer_lag",
+		Help: "Messages behind the partition's high water mark after the last consumed message.",
+	}, []string{"topic", "partition"})
+	handlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kafka_handler_duration_seconds",
+		Help:    "Event handler latency by event type.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 8), // 1ms to ~16s
+	}, []string{"event_type"})
+)
@@ -0,0 +1,84 @@
+package kafka
+
+import (
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel"
+
+	"project-root/internal/events"
+)
+
+var tracer = otel.Tracer("project-root/internal/kafka")
+
+// RequestIDHeader carries the ID of the request that published a message.
+const RequestIDHeader = "X-Request-ID"
+
+// requestID returns the correlation ID of a consumed event: the message header, or the
+// event metadata for messages from publishers that do not set it.
+func requestID(msg *sarama.ConsumerMessage, event *events.StorageEvent) string {
+	if id := (consumerHeaders{msg}).Get(RequestIDHeader); id != "" {
+		return id
+	}
+	return event.MetaData[events.MetaRequestID]
+}
+
+// producerHeaders carries trace context into the headers of an outgoing message.
+type producerHeaders struct{ msg *sarama.ProducerMessage }
+
+func (h producerHeaders) Get(key string) string {
+	for _, header := range h.msg.Headers {
+		if string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// Set replaces the header with key, so a message never carries two values for it.
+func (h producerHeaders) Set(key, value string) {
+	for i, header := range h.msg.Headers {
+		if string(header.Key) == key {
+			h.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	h.msg.Headers = append(h.msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (h producerHeaders) Keys() []string {
+	keys := make([]string, 0, len(h.msg.Headers))
+	for _, header := range h.msg.Headers {
+		keys = append(keys, string(header.Key))
+	}
+	return keys
+}
+
+// consumerHeaders reads trace context from the headers of a received message.
+type consumerHeaders struct{ msg *sarama.ConsumerMessage }
+
+func (h consumerHeaders) Get(key string) string {
+	for _, header := range h.msg.Headers {
+		if string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (h consumerHeaders) Set(string, string) {}
+
+func (h consumerHeaders) Keys() []string {
+	keys := make([]string, 0, len(h.msg.Headers))
+	for _, header := range h.msg.Headers {
+		keys = append(keys, string(header.Key))
+	}
+	return keys
+}
+
+// Map returns the headers by key.
+func (h consumerHeaders) Map() map[string]string {
+	headers := make(map[string]string, len(h.msg.Headers))
+	for _, header := range h.msg.Headers {
+		headers[string(header.Key)] = string(header.Value)
+	}
+	return headers
+}
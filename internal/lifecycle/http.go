@@ -0,0 +1,47 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+// HTTPServer listens on server.Addr when started, serving TLS when server.TLSConfig is set.
+// Stopping it refuses new connections and waits for in-flight requests to finish. Errors
+// while serving are reported to m.Fail.
+func HTTPServer(m *Manager, server *http.Server) Component {
+	return Component{
+		Name: "http server",
+		Start: func(context.Context) error {
+			listener, err := net.Listen("tcp", server.Addr)
+			if err != nil {
+				return err
+			}
+
+			serve := func() error { return server.Serve(listener) }
+			scheme := "http"
+			if server.TLSConfig != nil {
+				serve = func() error { return server.ServeTLS(listener, "", "") }
+				scheme = "https"
+			}
+			go func() {
+				if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					m.Fail(fmt.Errorf("http server: %w", err))
+				}
+			}()
+			slog.Info("Starting server", "address", scheme+"://"+listener.Addr().String())
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			err := server.Shutdown(ctx)
+			if errors.Is(err, context.DeadlineExceeded) {
+				// Cut off the requests that did not finish in time.
+				server.Close()
+			}
+			return err
+		},
+	}
+}
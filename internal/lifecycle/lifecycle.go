@@ -0,0 +1,175 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultShutdownTimeout bounds Stop when no timeout is configured.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// stopGrace is how long a component may take to stop once the shutdown deadline has passed.
+const stopGrace = 100 * time.Millisecond
+
+// Component is a subsystem with a start and stop step. Start must not block: long-running
+// work belongs in goroutines that Stop ends. Either step may be nil.
+type Component struct {
+	Name  string
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+}
+
+// Manager starts components in the order they were added and stops them in reverse, so a
+// component may depend on everything added before it.
+type Manager struct {
+	components []Component
+	started    int
+	failures   chan error
+	mu         sync.Mutex
+}
+
+// New returns an empty manager.
+func New() *Manager {
+	return &Manager{failures: make(chan error, 1)}
+}
+
+// Add appends a component after its dependencies.
+func (m *Manager) Add(component Component) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.components = append(m.components, component)
+}
+
+// Fail reports that a running component broke, making Run shut everything down.
+func (m *Manager) Fail(err error) {
+	select {
+	case m.failures <- err:
+	default: // A shutdown is already pending
+	}
+}
+
+// Start starts the components in order. If one fails, those already started are stopped.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	components := m.components
+	m.mu.Unlock()
+
+	for i, component := range components {
+		if component.Start != nil {
+			if err := component.Start(ctx); err != nil {
+				stopCtx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+				m.Stop(stopCtx)
+				cancel()
+				return fmt.Errorf("failed to start %s: %w", component.Name, err)
+			}
+		}
+		m.mu.Lock()
+		m.started = i + 1
+		m.mu.Unlock()
+		slog.Info("Started component", "component", component.Name)
+	}
+	return nil
+}
+
+// Stop stops the started components in reverse order. A component that does not stop
+// before ctx is done is abandoned so the rest still get their turn.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	components := m.components[:m.started]
+	m.started = 0
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(components) - 1; i >= 0; i-- {
+		component := components[i]
+		if component.Stop == nil {
+			continue
+		}
+
+		if err := stop(ctx, component); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		slog.Info("Stopped component", "component", component.Name)
+	}
+	return errors.Join(errs...)
+}
+
+// stop runs component.Stop until ctx is done. Past the deadline a component still gets
+// stopGrace to return, so quick ones behind a stuck one are not abandoned.
+func stop(ctx context.Context, component Component) error {
+	done := make(chan error, 1)
+	go func() { done <- component.Stop(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		select {
+		case err = <-done:
+		case <-time.After(stopGrace):
+			return fmt.Errorf("gave up stopping %s: %w", component.Name, ctx.Err())
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stop %s: %w", component.Name, err)
+	}
+	return nil
+}
+
+// Run starts the components, waits for SIGINT, SIGTERM, a Fail or ctx to end, and then
+// stops them within timeout.
+func (m *Manager) Run(ctx context.Context, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, stopSignals := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	if err := m.Start(ctx); err != nil {
+		return err
+	}
+
+	var failure error
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down", "timeout", timeout)
+	case failure = <-m.failures:
+		slog.Error("Shutting down after failure", "error", failure)
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return errors.Join(failure, m.Stop(stopCtx))
+}
+
+// Background runs fn in a goroutine from Start until Stop, which cancels its context and
+// waits for it to return.
+func Background(name string, fn func(ctx context.Context)) Component {
+	var cancel context.CancelFunc
+	done := make(chan struct{})
+	return Component{
+		Name: name,
+		Start: func(context.Context) error {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			go func() {
+				defer close(done)
+				fn(ctx)
+			}()
+			return nil
+		},
+		Stop: func(context.Context) error {
+			cancel()
+			<-done
+			return nil
+		},
+	}
+}
@@ -0,0 +1,21 @@
+package outbox
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	pendingEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "outbox_pending_events",
+		Help: "Events recorded in the outbox and not yet delivered.",
+	})
+	oldestAge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "outbox_oldest_pending_seconds",
+		Help: "Age of the oldest undelivered event at the last delivery pass.",
+	})
+	deliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "outbox_deliveries_total",
+		Help: "Outbox delivery attempts by result (success, failure or dropped).",
+	}, []string{"result"})
+)
@@ -0,0 +1,365 @@
+package outbox
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"project-root/internal/events"
+	"project-root/pkg/logger"
+)
+
+const (
+	DefaultRetryBackoff = time.Second
+	DefaultMaxBackoff   = time.Minute
+)
+
+var entriesBucket = []byte("entries")
+
+// Publisher delivers events; *kafka.KafkaClient implements it.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, event *events.StorageEvent) error
+}
+
+// Config locates the outbox and paces retries.
+type Config struct {
+	// Path is the database file, created if missing.
+	Path string
+	// RetryBackoff is the delay after an entry's first failed delivery, doubled after each
+	// further failure up to MaxBackoff.
+	RetryBackoff time.Duration
+	MaxBackoff   time.Duration
+}
+
+// Entry is an event waiting to be delivered.
+type Entry struct {
+	Seq   uint64               `json:"seq"`
+	Topic string               `json:"topic"`
+	Event *events.StorageEvent `json:"event"`
+	// Carrier holds the trace context of the request that recorded the event.
+	Carrier     map[string]string `json:"carrier,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	Attempts    int               `json:"attempts"`
+	LastError   string            `json:"lastError,omitempty"`
+	NextAttempt time.Time         `json:"nextAttempt,omitempty"`
+}
+
+// Stats summarizes the entries waiting for delivery.
+type Stats struct {
+	Pending int `json:"pending"`
+	// Failing counts entries whose last delivery attempt failed.
+	Failing int        `json:"failing"`
+	Oldest  *time.Time `json:"oldest,omitempty"`
+}
+
+// Outbox records events on local disk before they are published, so events of stored files
+// survive a Kafka outage or a restart. Run delivers them in the order they were recorded.
+type Outbox struct {
+	db     *bolt.DB
+	config Config
+	wake   chan struct{}
+
+	// mu serializes delivery passes between Run and Flush.
+	mu sync.Mutex
+}
+
+// Open opens or creates the outbox database at config.Path.
+func Open(config Config) (*Outbox, error) {
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = DefaultRetryBackoff
+	}
+	if config.MaxBackoff < config.RetryBackoff {
+		config.MaxBackoff = max(DefaultMaxBackoff, config.RetryBackoff)
+	}
+	db, err := bolt.Open(config.Path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox %s: %v", config.Path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(entriesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize outbox: %v", err)
+	}
+
+	o := &Outbox{db: db, config: config, wake: make(chan struct{}, 1)}
+	if stats, err := o.Stats(); err == nil {
+		pendingEntries.Set(float64(stats.Pending))
+		if stats.Pending > 0 {
+			slog.Info("Outbox has undelivered events", "pending", stats.Pending)
+		}
+	}
+	return o, nil
+}
+
+// Enqueue records event for delivery to topic, with ctx's trace context.
+func (o *Outbox) Enqueue(ctx context.Context, topic string, event *events.StorageEvent) error {
+	return o.record(ctx, Entry{Topic: topic, Event: event})
+}
+
+// Requeue records an event whose delivery failed after it left the outbox, such as an
+// asynchronously published message, to be retried after the retry backoff.
+func (o *Outbox) Requeue(ctx context.Context, topic string, event *events.StorageEvent, cause error) error {
+	return o.record(ctx, Entry{
+		Topic:       topic,
+		Event:       event,
+		Attempts:    1,
+		LastError:   cause.Error(),
+		NextAttempt: time.Now().Add(o.config.RetryBackoff),
+	})
+}
+
+func (o *Outbox) record(ctx context.Context, entry Entry) error {
+	entry.Carrier = map[string]string{}
+	entry.CreatedAt = time.Now().UTC()
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(entry.Carrier))
+
+	err := o.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(entriesBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		entry.Seq = seq
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key(seq), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record event in outbox: %v", err)
+	}
+	pendingEntries.Inc()
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run delivers entries to publisher until ctx is done, as soon as they are recorded and
+// again when failed entries are due for a retry.
+func (o *Outbox) Run(ctx context.Context, publisher Publisher) {
+	for {
+		next := o.Flush(ctx, publisher)
+		var retry <-chan time.Time
+		var timer *time.Timer
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			retry = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-o.wake:
+		case <-retry:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Flush makes one delivery pass over the entries in the order they were recorded and returns
+// when the earliest failed entry is due again, or zero if none failed. An entry is not
+// delivered while an earlier one for the same path is pending, so consumers see each path's
+// events in order.
+func (o *Outbox) Flush(ctx context.Context, publisher Publisher) time.Time {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries, err := o.Entries(0)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to read outbox", "error", err)
+		return time.Now().Add(o.config.RetryBackoff)
+	}
+
+	var next time.Time
+	blocked := make(map[string]bool)
+	now := time.Now()
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		paths := entryPaths(entry.Event)
+		if anyBlocked(blocked, paths) {
+			continue
+		}
+		if entry.NextAttempt.After(now) {
+			block(blocked, paths)
+			if next.IsZero() || entry.NextAttempt.Before(next) {
+				next = entry.NextAttempt
+			}
+			continue
+		}
+
+		err := publisher.Publish(entryContext(ctx, entry), entry.Topic, entry.Event)
+		switch {
+		case err == nil:
+			o.remove(entry.Seq)
+			deliveries.WithLabelValues("success").Inc()
+		case errors.Is(err, events.ErrInvalidEvent):
+			// It can never be published; keeping it would hold back its path forever.
+			slog.ErrorContext(ctx, "Dropped invalid event from outbox", "id", entry.Event.ID, "topic", entry.Topic, "error", err)
+			o.remove(entry.Seq)
+			deliveries.WithLabelValues("dropped").Inc()
+		default:
+			block(blocked, paths)
+			due := o.retryLater(entry, err)
+			if next.IsZero() || due.Before(next) {
+				next = due
+			}
+			deliveries.WithLabelValues("failure").Inc()
+			slog.WarnContext(ctx, "Outbox delivery failed", "id", entry.Event.ID, "topic", entry.Topic, "attempts", entry.Attempts+1, "retry_at", due, "error", err)
+		}
+	}
+	o.observe()
+	return next
+}
+
+// Entries returns up to limit pending entries, oldest first; limit 0 returns all.
+func (o *Outbox) Entries(limit int) ([]Entry, error) {
+	var entries []Entry
+	err := o.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(entriesBucket).Cursor()
+		for k, v := cursor.First(); k != nil && (limit <= 0 || len(entries) < limit); k, v = cursor.Next() {
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("corrupt outbox entry %d: %v", binary.BigEndian.Uint64(k), err)
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Stats counts the pending entries.
+func (o *Outbox) Stats() (Stats, error) {
+	var stats Stats
+	err := o.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).ForEach(func(_, v []byte) error {
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			stats.Pending++
+			if entry.Attempts > 0 {
+				stats.Failing++
+			}
+			if stats.Oldest == nil {
+				stats.Oldest = &entry.CreatedAt
+			}
+			return nil
+		})
+	})
+	return stats, err
+}
+
+// Close closes the database; undelivered entries are kept for the next Open.
+func (o *Outbox) Close() error {
+	return o.db.Close()
+}
+
+// retryLater records a failed attempt and returns when the entry is due again.
+func (o *Outbox) retryLater(entry Entry, cause error) time.Time {
+	backoff := o.config.RetryBackoff
+	for i := 0; i < entry.Attempts && backoff < o.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	entry.Attempts++
+	entry.LastError = cause.Error()
+	entry.NextAttempt = time.Now().Add(min(backoff, o.config.MaxBackoff))
+
+	err := o.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(entriesBucket).Put(key(entry.Seq), data)
+	})
+	if err != nil {
+		slog.Error("Failed to update outbox entry", "seq", entry.Seq, "error", err)
+	}
+	return entry.NextAttempt
+}
+
+func (o *Outbox) remove(seq uint64) {
+	err := o.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).Delete(key(seq))
+	})
+	if err != nil {
+		// The entry is delivered again on the next pass; consumers must tolerate duplicates.
+		slog.Error("Failed to remove delivered outbox entry", "seq", seq, "error", err)
+		return
+	}
+	pendingEntries.Dec()
+}
+
+// observe refreshes the gauges from the database.
+func (o *Outbox) observe() {
+	stats, err := o.Stats()
+	if err != nil {
+		return
+	}
+	pendingEntries.Set(float64(stats.Pending))
+	oldestAge.Set(0)
+	if stats.Oldest != nil {
+		oldestAge.Set(time.Since(*stats.Oldest).Seconds())
+	}
+}
+
+// entryContext restores the trace context and request ID of the request that recorded entry.
+func entryContext(ctx context.Context, entry Entry) context.Context {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(entry.Carrier))
+	if id := entry.Event.MetaData[events.MetaRequestID]; id != "" {
+		ctx = logger.WithRequestID(ctx, id)
+	}
+	return ctx
+}
+
+// entryPaths are the paths whose order an event must keep: its path, and the source of a move.
+func entryPaths(event *events.StorageEvent) []string {
+	paths := []string{event.Path}
+	if source := event.MetaData[events.MetaSourcePath]; source != "" {
+		paths = append(paths, source)
+	}
+	return paths
+}
+
+func anyBlocked(blocked map[string]bool, paths []string) bool {
+	for _, path := range paths {
+		if blocked[path] {
+			return true
+		}
+	}
+	return false
+}
+
+func block(blocked map[string]bool, paths []string) {
+	for _, path := range paths {
+		blocked[path] = true
+	}
+}
+
+// key orders entries by sequence in the bucket.
+func key(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
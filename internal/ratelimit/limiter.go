@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// idleAfter is how long a full bucket is kept before it is dropped.
+const idleAfter = 10 * time.Minute
+
+// bucket holds the tokens of one key. Tokens may go negative when a WaitN reserves
+// more than is available; the debt is paid back before the next caller proceeds.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps a token bucket per key, refilled at a fixed rate up to a burst size.
+// A nil *Limiter allows everything, so optional limits need no nil checks at call sites.
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+// New returns a limiter refilling rate tokens per second up to burst, or nil (unlimited)
+// when rate is not positive. A burst below rate is raised to rate.
+func New(rate float64, burst int) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(burst)
+	if b < rate {
+		b = rate
+	}
+	return &Limiter{rate: rate, burst: b, buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow takes one token for key. When none is available it returns false and how long
+// until one will be.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, l.delay(1 - b.tokens)
+}
+
+// WaitN takes n tokens for key, blocking until the bucket has paid them back or ctx is done.
+func (l *Limiter) WaitN(ctx context.Context, key string, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	b := l.bucket(key)
+	b.tokens -= float64(n)
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = l.delay(-b.tokens)
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Reader throttles reads from r to the limiter's rate in bytes per second for key.
+func (l *Limiter) Reader(ctx context.Context, key string, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, limiter: l, key: key}
+}
+
+// bucket refills and returns key's bucket, sweeping idle buckets now and then; callers must hold mu.
+func (l *Limiter) bucket(key string) *bucket {
+	now := l.now()
+	if now.Sub(l.lastSweep) > idleAfter {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > idleAfter {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+		return b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	return b
+}
+
+func (l *Limiter) delay(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *Limiter
+	key     string
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if waitErr := t.limiter.WaitN(t.ctx, t.key, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,21 @@
+package replication
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	replicatedEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "replication_events_total",
+		Help: "Storage events applied to the secondary by replicator and result (success or failure).",
+	}, []string{"replicator", "result"})
+	replicationLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "replication_lag_seconds",
+		Help: "Time between the last replicated event and its replication.",
+	}, []string{"replicator"})
+	replicationMaxLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "replication_max_lag_seconds",
+		Help: "Largest replication lag seen since the worker started.",
+	}, []string{"replicator"})
+)
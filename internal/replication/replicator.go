@@ -0,0 +1,273 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"project-root/internal/events"
+	"project-root/internal/storage"
+)
+
+// metaSourceETag records which primary version a replica was copied from.
+const metaSourceETag = "replica_source_etag"
+
+// Stats reports replication progress.
+type Stats struct {
+	Replicated    int64         `json:"replicated"`
+	Failed        int64         `json:"failed"`
+	LastLag       time.Duration `json:"lastLag"`
+	MaxLag        time.Duration `json:"maxLag"`
+	LastEventTime time.Time     `json:"lastEventTime"`
+}
+
+// ReconcileResult reports what a reconciliation scan repaired.
+type ReconcileResult struct {
+	Scanned int `json:"scanned"`
+	Copied  int `json:"copied"`
+	Deleted int `json:"deleted"`
+	Failed  int `json:"failed"`
+}
+
+// Replicator mirrors files from a primary to a secondary StorageAdapter. Both should be
+// raw backends without encryption, compression or deduplication decorators: files are
+// copied as stored, with their stored metadata, so replicas decode with the same keys
+// and content blobs are copied along with the files that reference them.
+type Replicator struct {
+	// Name labels the replicator's metrics.
+	Name         string
+	Primary      storage.StorageAdapter
+	Secondary    storage.StorageAdapter
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// Excluded lists secondary path prefixes replicated from other primaries, such as
+	// tenants with dedicated containers. Reconcile never deletes under them.
+	Excluded []string
+
+	stats Stats
+	mu    sync.Mutex
+}
+
+// NewReplicator creates a replicator with retry settings.
+func NewReplicator(primary, secondary storage.StorageAdapter, maxRetries int, retryBackoff time.Duration) *Replicator {
+	return &Replicator{
+		Primary:      primary,
+		Secondary:    secondary,
+		MaxRetries:   maxRetries,
+		RetryBackoff: retryBackoff,
+	}
+}
+
+// HandleEvent applies a storage event to the secondary, retrying with backoff.
+func (r *Replicator) HandleEvent(ctx context.Context, event *events.StorageEvent) error {
+	err := r.retry(ctx, func() error {
+		switch event.Type {
+		case events.FileUploaded:
+			return r.copyFile(ctx, event.Path)
+		case events.FileDeleted, events.DirectoryDeleted:
+			return r.deleteFile(ctx, event.Path)
+		case events.FileMoved:
+			source := event.MetaData[events.MetaSourcePath]
+			if source == "" {
+				return fmt.Errorf("move event for %s has no source path", event.Path)
+			}
+			if err := r.copyFile(ctx, event.Path); err != nil {
+				return err
+			}
+			return r.deleteFile(ctx, source)
+		default:
+			return nil
+		}
+	})
+	r.record(event, err)
+	return err
+}
+
+// Reconcile compares primary and secondary under dirPath and repairs drift: missing
+// or outdated replicas are copied and replicas without a primary are deleted. A replica
+// is only deleted if the primary still has no file there, since it may have been
+// uploaded after the primary was listed. Reconciling the root also deletes content blobs
+// the primary no longer has, which listings leave out.
+func (r *Replicator) Reconcile(ctx context.Context, dirPath string) (*ReconcileResult, error) {
+	primaryFiles, err := r.Primary.ListFiles(ctx, dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list primary: %v", err)
+	}
+	secondaryFiles, err := r.Secondary.ListFiles(ctx, dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secondary: %v", err)
+	}
+
+	result := &ReconcileResult{}
+	inPrimary := make(map[string]bool, len(primaryFiles))
+	for _, path := range primaryFiles {
+		inPrimary[path] = true
+		result.Scanned++
+
+		if r.inSync(ctx, path) {
+			continue
+		}
+		if err := r.retry(ctx, func() error { return r.copyFile(ctx, path) }); err != nil {
+			slog.ErrorContext(ctx, "Reconcile failed to copy file", "path", path, "error", err)
+			result.Failed++
+			continue
+		}
+		result.Copied++
+	}
+
+	r.deleteOrphans(ctx, secondaryFiles, inPrimary, result)
+
+	if root := strings.Trim(path.Clean("/"+dirPath), "/"); root == "" {
+		blobs, err := r.Secondary.ListFiles(ctx, storage.DedupBlobDir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return result, fmt.Errorf("failed to list secondary content blobs: %v", err)
+		}
+		r.deleteOrphans(ctx, blobs, nil, result)
+	}
+	return result, nil
+}
+
+// deleteOrphans deletes the replicas in secondaryFiles whose primary is gone.
+func (r *Replicator) deleteOrphans(ctx context.Context, secondaryFiles []string, inPrimary map[string]bool, result *ReconcileResult) {
+	for _, path := range secondaryFiles {
+		if inPrimary[path] || r.excluded(path) {
+			continue
+		}
+		if _, err := r.Primary.Stat(ctx, path); err == nil {
+			continue
+		}
+		if err := r.retry(ctx, func() error { return r.deleteFile(ctx, path) }); err != nil {
+			slog.ErrorContext(ctx, "Reconcile failed to delete replica", "path", path, "error", err)
+			result.Failed++
+			continue
+		}
+		result.Deleted++
+	}
+}
+
+// Stats returns a snapshot of replication progress.
+func (r *Replicator) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// inSync reports whether the replica was copied from the primary's current version and,
+// for a deduplicated file, its content blob is on the secondary too.
+func (r *Replicator) inSync(ctx context.Context, path string) bool {
+	primary, err := r.Primary.Stat(ctx, path)
+	if err != nil {
+		return true // Gone since listing; nothing to copy.
+	}
+	replica, err := r.Secondary.Stat(ctx, path)
+	if err != nil || replica.Metadata[metaSourceETag] != primary.ETag {
+		return false
+	}
+	if blob := storage.ReferencedBlob(primary.Metadata); blob != "" {
+		if _, err := r.Secondary.Stat(ctx, blob); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// excluded reports whether path belongs to another primary's replicas.
+func (r *Replicator) excluded(path string) bool {
+	for _, prefix := range r.Excluded {
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// copyFile streams the primary's content, metadata and tags to the secondary, along with
+// the content blob of a deduplicated file.
+func (r *Replicator) copyFile(ctx context.Context, path string) error {
+	info, err := r.Primary.Stat(ctx, path)
+	if err != nil {
+		// Deleted since the event was published; the delete event will follow.
+		slog.WarnContext(ctx, "Skipping replication of missing file", "path", path, "error", err)
+		return nil
+	}
+
+	// The blob goes first so a replicated reference never points at missing content.
+	// Blobs are named by their content, so one already on the secondary is current.
+	if blob := storage.ReferencedBlob(info.Metadata); blob != "" {
+		if _, err := r.Secondary.Stat(ctx, blob); err != nil {
+			if err := r.copyFile(ctx, blob); err != nil {
+				return fmt.Errorf("failed to replicate content of %s: %w", path, err)
+			}
+		}
+	}
+
+	content, err := r.Primary.OpenFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	metadata := make(map[string]string, len(info.Metadata)+1)
+	for k, v := range info.Metadata {
+		metadata[k] = v
+	}
+	metadata[metaSourceETag] = info.ETag
+
+	// Tags are written with the replica, so tags removed on the primary are removed too.
+	tags, _ := r.Primary.GetTags(ctx, path)
+	return r.Secondary.WriteStream(ctx, path, content, storage.WriteOptions{Overwrite: true, Metadata: metadata, Tags: tags})
+}
+
+// deleteFile removes a replica; a replica that is already gone counts as success.
+func (r *Replicator) deleteFile(ctx context.Context, path string) error {
+	if _, err := r.Secondary.Stat(ctx, path); err != nil {
+		return nil
+	}
+	return r.Secondary.DeleteFile(ctx, path)
+}
+
+// retry runs op until it succeeds, MaxRetries is exhausted or ctx is done.
+func (r *Replicator) retry(ctx context.Context, op func() error) error {
+	backoff := r.RetryBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = op(); err == nil || attempt >= r.MaxRetries {
+			return err
+		}
+		slog.WarnContext(ctx, "Replication attempt failed, retrying", "attempt", attempt+1, "backoff", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (r *Replicator) record(event *events.StorageEvent, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.stats.Failed++
+		replicatedEvents.WithLabelValues(r.Name, "failure").Inc()
+		return
+	}
+	r.stats.Replicated++
+	replicatedEvents.WithLabelValues(r.Name, "success").Inc()
+	if !event.Timestamp.IsZero() {
+		r.stats.LastEventTime = event.Timestamp
+		r.stats.LastLag = time.Since(event.Timestamp)
+		if r.stats.LastLag > r.stats.MaxLag {
+			r.stats.MaxLag = r.stats.LastLag
+		}
+		replicationLag.WithLabelValues(r.Name).Set(r.stats.LastLag.Seconds())
+		replicationMaxLag.WithLabelValues(r.Name).Set(r.stats.MaxLag.Seconds())
+	}
+}
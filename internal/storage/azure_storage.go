@@ -3,19 +3,37 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 )
 
+// retentionBlobName stores prefix and file retention rules inside the container.
+const retentionBlobName = indexDirName + "/retention.json"
+
 type AzureStorage struct {
 	AccountName   string
 	AccountKey    string
 	ContainerName string
-	client        *azblob.Client
+	// NativeImmutability also applies file rules with the blob immutability and
+	// legal hold APIs; the container must have version-level immutability enabled.
+	NativeImmutability bool
+	client             *azblob.Client
+
+	retentionOnce sync.Once
+	retention     *retentionStore
 }
 
 var _ StorageAdapter = (*AzureStorage)(nil)
@@ -50,9 +68,38 @@ func (s *AzureStorage) UploadFile(ctx context.Context, filePath string, data []b
 
 // WriteFile
 func (s *AzureStorage) WriteFile(ctx context.Context, path string, content []byte, overwrite bool) error {
+	return s.WriteStream(ctx, path, bytes.NewReader(content), WriteOptions{Overwrite: overwrite})
+}
+
+// WriteStream uploads a blob in blocks without buffering the whole body.
+func (s *AzureStorage) WriteStream(ctx context.Context, path string, r io.Reader, opts WriteOptions) error {
+	if err := ValidateTags(opts.Tags); err != nil {
+		return err
+	}
 	blobClient := s.client.ServiceClient().NewContainerClient(s.ContainerName).NewBlockBlobClient(path)
 
-	_, err := blobClient.UploadStream(ctx, bytes.NewReader(content), &blockblob.UploadStreamOptions{})
+	// Tags are part of the upload, so an overwrite never keeps the previous blob's tags.
+	uploadOpts := &blockblob.UploadStreamOptions{Tags: opts.Tags}
+	if len(opts.Metadata) > 0 {
+		uploadOpts.Metadata = make(map[string]*string, len(opts.Metadata))
+		for k, v := range opts.Metadata {
+			value := v
+			uploadOpts.Metadata[k] = &value
+		}
+	}
+	if !opts.Overwrite {
+		etagAny := azcore.ETagAny
+		uploadOpts.AccessConditions = &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfNoneMatch: &etagAny},
+		}
+	} else if err := s.checkRetention(ctx, path); err != nil {
+		return err
+	}
+
+	_, err := blobClient.UploadStream(ctx, r, uploadOpts)
+	if bloberror.HasCode(err, bloberror.BlobAlreadyExists, bloberror.ConditionNotMet) {
+		return fmt.Errorf("file already exists and overwrite is disabled: %s", path)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to upload file to Azure Storage: %v", err)
 	}
@@ -77,8 +124,72 @@ func (s *AzureStorage) ReadFile(ctx context.Context, filePath string) ([]byte, e
 	return data, nil
 }
 
+// OpenFile streams a blob's content.
+func (s *AzureStorage) OpenFile(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	blobClient := s.client.ServiceClient().NewContainerClient(s.ContainerName).NewBlobClient(filePath)
+
+	response, err := blobClient.DownloadStream(ctx, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return nil, fmt.Errorf("file not found: %s", filePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file from Azure Storage: %v", err)
+	}
+	return response.Body, nil
+}
+
+// Stat returns blob properties and metadata.
+func (s *AzureStorage) Stat(ctx context.Context, filePath string) (*FileInfo, error) {
+	blobClient := s.client.ServiceClient().NewContainerClient(s.ContainerName).NewBlobClient(filePath)
+
+	props, err := blobClient.GetProperties(ctx, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return nil, fmt.Errorf("file not found: %s", filePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob properties: %v", err)
+	}
+
+	info := &FileInfo{Path: filePath, Metadata: map[string]string{}}
+	if props.ContentLength != nil {
+		info.Size = *props.ContentLength
+	}
+	if props.ETag != nil {
+		info.ETag = string(*props.ETag)
+	}
+	if props.LastModified != nil {
+		info.ModTime = *props.LastModified
+	}
+	for k, v := range props.Metadata {
+		// Metadata keys come back with canonicalized header casing.
+		if v != nil {
+			info.Metadata[strings.ToLower(k)] = *v
+		}
+	}
+	return info, nil
+}
+
+// SetMetadata replaces a blob's metadata.
+func (s *AzureStorage) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	blobClient := s.client.ServiceClient().NewContainerClient(s.ContainerName).NewBlobClient(filePath)
+
+	md := make(map[string]*string, len(metadata))
+	for k, v := range metadata {
+		value := v
+		md[k] = &value
+	}
+	if _, err := blobClient.SetMetadata(ctx, md, nil); err != nil {
+		return fmt.Errorf("failed to set blob metadata: %v", err)
+	}
+	return nil
+}
+
 // DeleteFile
 func (s *AzureStorage) DeleteFile(ctx context.Context, filePath string) error {
+	if err := s.checkRetention(ctx, filePath); err != nil {
+		return err
+	}
+
 	blobClient := s.client.ServiceClient().NewContainerClient(s.ContainerName).NewBlobClient(filePath)
 	_, err := blobClient.Delete(ctx, nil)
 	if err != nil {
@@ -91,7 +202,12 @@ func (s *AzureStorage) DeleteFile(ctx context.Context, filePath string) error {
 func (s *AzureStorage) ListFiles(ctx context.Context, dirPath string) ([]string, error) {
 	containerClient := s.client.ServiceClient().NewContainerClient(s.ContainerName)
 
-	pager := containerClient.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{})
+	prefix := listPrefix(dirPath)
+	opts := &container.ListBlobsFlatOptions{}
+	if prefix != "" {
+		opts.Prefix = &prefix
+	}
+	pager := containerClient.NewListBlobsFlatPager(opts)
 
 	files := []string{}
 	for pager.More() {
@@ -101,8 +217,218 @@ func (s *AzureStorage) ListFiles(ctx context.Context, dirPath string) ([]string,
 		}
 
 		for _, blob := range resp.Segment.BlobItems {
-			files = append(files, *blob.Name)
+			if listed(*blob.Name, prefix) {
+				files = append(files, *blob.Name)
+			}
 		}
 	}
 	return files, nil
 }
+
+// SetTags replaces the blob index tags of a blob.
+func (s *AzureStorage) SetTags(ctx context.Context, filePath string, tags map[string]string) error {
+	if err := ValidateTags(tags); err != nil {
+		return err
+	}
+	blobClient := s.client.ServiceClient().NewContainerClient(s.ContainerName).NewBlobClient(filePath)
+	if _, err := blobClient.SetTags(ctx, tags, nil); err != nil {
+		return fmt.Errorf("failed to set blob tags: %v", err)
+	}
+	return nil
+}
+
+// GetTags returns the blob index tags of a blob.
+func (s *AzureStorage) GetTags(ctx context.Context, filePath string) (map[string]string, error) {
+	blobClient := s.client.ServiceClient().NewContainerClient(s.ContainerName).NewBlobClient(filePath)
+	resp, err := blobClient.GetTags(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob tags: %v", err)
+	}
+
+	tags := make(map[string]string, len(resp.BlobTagSet))
+	for _, tag := range resp.BlobTagSet {
+		if tag.Key != nil && tag.Value != nil {
+			tags[*tag.Key] = *tag.Value
+		}
+	}
+	return tags, nil
+}
+
+// FindFilesByTags searches the container with the Find Blobs by Tags API.
+func (s *AzureStorage) FindFilesByTags(ctx context.Context, query TagQuery) (*TagSearchResult, error) {
+	if len(query.Tags) == 0 {
+		return nil, fmt.Errorf("at least one tag is required")
+	}
+	if err := ValidateTags(query.Tags); err != nil {
+		return nil, err
+	}
+
+	opts := &container.FilterBlobsOptions{}
+	if query.Marker != "" {
+		opts.Marker = &query.Marker
+	}
+	limit := query.MaxResults
+	if limit <= 0 {
+		limit = DefaultTagPageSize
+	}
+	maxResults := int32(limit)
+	opts.MaxResults = &maxResults
+
+	containerClient := s.client.ServiceClient().NewContainerClient(s.ContainerName)
+	resp, err := containerClient.FilterBlobs(ctx, tagFilterExpression(query.Tags), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search blobs by tags: %v", err)
+	}
+
+	result := &TagSearchResult{Files: []TaggedFile{}}
+	for _, blob := range resp.Blobs {
+		// The tag filter cannot express a prefix, so pages may come back short.
+		if blob.Name == nil || !strings.HasPrefix(*blob.Name, query.Prefix) {
+			continue
+		}
+		file := TaggedFile{Path: *blob.Name, Tags: map[string]string{}}
+		if blob.Tags != nil {
+			for _, tag := range blob.Tags.BlobTagSet {
+				if tag.Key != nil && tag.Value != nil {
+					file.Tags[*tag.Key] = *tag.Value
+				}
+			}
+		}
+		result.Files = append(result.Files, file)
+	}
+	if resp.NextMarker != nil {
+		result.NextMarker = *resp.NextMarker
+	}
+	return result, nil
+}
+
+// tagFilterExpression builds a where clause such as "class"='legal' AND "customer"='acme'.
+func tagFilterExpression(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	clauses := make([]string, 0, len(keys))
+	for _, key := range keys {
+		clauses = append(clauses, fmt.Sprintf("\"%s\"='%s'", key, tags[key]))
+	}
+	return strings.Join(clauses, " AND ")
+}
+
+// SetImmutabilityPolicy retains a blob or prefix until retainUntil. With NativeImmutability the
+// blob policy is set before the rule is saved, so a failed call leaves the rules unchanged.
+func (s *AzureStorage) SetImmutabilityPolicy(ctx context.Context, target string, retainUntil time.Time) error {
+	var apply func() error
+	if s.NativeImmutability && !strings.HasSuffix(target, "/") {
+		apply = func() error {
+			// Unlocked so account administrators can still correct mistakes;
+			// the rule store already refused to shorten retention.
+			mode := blob.ImmutabilityPolicySettingUnlocked
+			blobClient := s.client.ServiceClient().NewContainerClient(s.ContainerName).NewBlobClient(target)
+			if _, err := blobClient.SetImmutabilityPolicy(ctx, retainUntil, &blob.SetImmutabilityPolicyOptions{Mode: &mode}); err != nil {
+				return fmt.Errorf("failed to set blob immutability policy: %v", err)
+			}
+			return nil
+		}
+	}
+	return s.retentionRules().setPolicy(ctx, target, retainUntil, apply)
+}
+
+// SetLegalHold places or clears a legal hold on a blob or prefix. With NativeImmutability the
+// blob hold is changed before the rule is saved.
+func (s *AzureStorage) SetLegalHold(ctx context.Context, target string, hold bool) error {
+	var apply func() error
+	if s.NativeImmutability && !strings.HasSuffix(target, "/") {
+		apply = func() error {
+			blobClient := s.client.ServiceClient().NewContainerClient(s.ContainerName).NewBlobClient(target)
+			if _, err := blobClient.SetLegalHold(ctx, hold, nil); err != nil {
+				return fmt.Errorf("failed to set blob legal hold: %v", err)
+			}
+			return nil
+		}
+	}
+	return s.retentionRules().setLegalHold(ctx, target, hold, apply)
+}
+
+// ListRetentionRules returns all active retention rules.
+func (s *AzureStorage) ListRetentionRules(ctx context.Context) ([]RetentionRule, error) {
+	return s.retentionRules().list(ctx)
+}
+
+// HealthCheck verifies that the container exists and the credentials can read it.
+func (s *AzureStorage) HealthCheck(ctx context.Context) error {
+	if _, err := s.client.ServiceClient().NewContainerClient(s.ContainerName).GetProperties(ctx, nil); err != nil {
+		return fmt.Errorf("container %s is not reachable: %v", s.ContainerName, err)
+	}
+	return nil
+}
+
+func (s *AzureStorage) checkRetention(ctx context.Context, path string) error {
+	if err := s.retentionRules().check(ctx, path); err != nil {
+		// Rules only protect data that exists; writing a new file under a retained prefix is allowed.
+		blobClient := s.client.ServiceClient().NewContainerClient(s.ContainerName).NewBlobClient(path)
+		if _, propErr := blobClient.GetProperties(ctx, nil); bloberror.HasCode(propErr, bloberror.BlobNotFound) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// retentionRules returns the store for the retention rules blob, which is read and written
+// with ETag conditions so that instances sharing the container never lose each other's rules.
+func (s *AzureStorage) retentionRules() *retentionStore {
+	s.retentionOnce.Do(func() {
+		blobClient := s.client.ServiceClient().NewContainerClient(s.ContainerName).NewBlockBlobClient(retentionBlobName)
+		load := func(ctx context.Context, version string) ([]byte, string, error) {
+			var opts *blob.DownloadStreamOptions
+			if version != "" {
+				etag := azcore.ETag(version)
+				opts = &blob.DownloadStreamOptions{AccessConditions: &blob.AccessConditions{
+					ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfNoneMatch: &etag},
+				}}
+			}
+			resp, err := blobClient.DownloadStream(ctx, opts)
+			var respErr *azcore.ResponseError
+			if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotModified {
+				return nil, version, errRulesNotModified
+			}
+			if bloberror.HasCode(err, bloberror.BlobNotFound) {
+				return nil, "", nil
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			defer resp.Body.Close()
+			data, err := io.ReadAll(resp.Body)
+			if err != nil || resp.ETag == nil {
+				return nil, "", err
+			}
+			return data, string(*resp.ETag), nil
+		}
+		save := func(ctx context.Context, data []byte, version string) (string, error) {
+			conditions := &blob.ModifiedAccessConditions{}
+			if version == "" {
+				etagAny := azcore.ETagAny
+				conditions.IfNoneMatch = &etagAny
+			} else {
+				etag := azcore.ETag(version)
+				conditions.IfMatch = &etag
+			}
+			resp, err := blobClient.UploadStream(ctx, bytes.NewReader(data), &blockblob.UploadStreamOptions{
+				AccessConditions: &blob.AccessConditions{ModifiedAccessConditions: conditions},
+			})
+			if bloberror.HasCode(err, bloberror.ConditionNotMet, bloberror.BlobAlreadyExists) {
+				return "", errRulesConflict
+			}
+			if err != nil || resp.ETag == nil {
+				return "", err
+			}
+			return string(*resp.ETag), nil
+		}
+		s.retention = newRetentionStore(load, save)
+	})
+	return s.retention
+}
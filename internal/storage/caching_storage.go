@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheConfig controls CachingStorage.
+type CacheConfig struct {
+	// Dir holds cached files. It is emptied when the cache is created.
+	Dir string
+	// MaxBytes bounds the total size of cached files; larger files are never cached.
+	MaxBytes int64
+	// RevalidateAfter skips the ETag check for entries validated more recently than this.
+	// Zero validates on every read.
+	RevalidateAfter time.Duration
+}
+
+// cacheEntry is a file cached on local disk.
+type cacheEntry struct {
+	path      string
+	file      string
+	etag      string
+	size      int64
+	validated time.Time
+}
+
+// CachingStorage is a read-through StorageAdapter decorator that keeps recently read
+// files on local disk in a size-bounded LRU. Cached copies are validated against the
+// backend's ETag, dropped on local writes and deletes, and can be invalidated from
+// outside (e.g. by storage events from other instances) with Invalidate.
+//
+// Cached copies hold what the wrapped adapter returns, so above EncryptedStorage they are
+// plaintext. Cache files are only readable by the process owner.
+type CachingStorage struct {
+	StorageAdapter
+	config CacheConfig
+
+	entries map[string]*list.Element
+	lru     *list.List
+	size    int64
+	mu      sync.Mutex
+}
+
+var _ StorageAdapter = (*CachingStorage)(nil)
+
+// NewCachingStorage wraps inner with a local disk cache.
+func NewCachingStorage(inner StorageAdapter, config CacheConfig) (*CachingStorage, error) {
+	if config.Dir == "" {
+		return nil, fmt.Errorf("cache directory is required")
+	}
+	if config.MaxBytes <= 0 {
+		return nil, fmt.Errorf("cache size must be positive")
+	}
+	if err := os.RemoveAll(config.Dir); err != nil {
+		return nil, fmt.Errorf("failed to clear cache directory: %v", err)
+	}
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %v", err)
+	}
+
+	return &CachingStorage{
+		StorageAdapter: inner,
+		config:         config,
+		entries:        make(map[string]*list.Element),
+		lru:            list.New(),
+	}, nil
+}
+
+// UploadFile writes through and invalidates the cached copy.
+func (s *CachingStorage) UploadFile(ctx context.Context, filePath string, data []byte) error {
+	defer s.Invalidate(filePath)
+	return s.StorageAdapter.UploadFile(ctx, filePath, data)
+}
+
+// WriteFile writes through and invalidates the cached copy.
+func (s *CachingStorage) WriteFile(ctx context.Context, path string, content []byte, overwrite bool) error {
+	defer s.Invalidate(path)
+	return s.StorageAdapter.WriteFile(ctx, path, content, overwrite)
+}
+
+// WriteStream writes through and invalidates the cached copy.
+func (s *CachingStorage) WriteStream(ctx context.Context, path string, r io.Reader, opts WriteOptions) error {
+	defer s.Invalidate(path)
+	return s.StorageAdapter.WriteStream(ctx, path, r, opts)
+}
+
+// DeleteFile deletes through and invalidates the cached copy.
+func (s *CachingStorage) DeleteFile(ctx context.Context, filePath string) error {
+	defer s.Invalidate(filePath)
+	return s.StorageAdapter.DeleteFile(ctx, filePath)
+}
+
+// SetMetadata updates through and invalidates the cached copy, since the ETag changes.
+func (s *CachingStorage) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	defer s.Invalidate(filePath)
+	return s.StorageAdapter.SetMetadata(ctx, filePath, metadata)
+}
+
+// ReadFile reads a file through the cache.
+func (s *CachingStorage) ReadFile(ctx context.Context, filePath string) ([]byte, error) {
+	rc, err := s.OpenFile(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	return data, nil
+}
+
+// OpenFile serves a fresh cached copy or fetches the file into the cache.
+func (s *CachingStorage) OpenFile(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	// Encoded reads return a different representation; don't mix them into the cache.
+	if EncodedContent(ctx) {
+		return s.StorageAdapter.OpenFile(ctx, filePath)
+	}
+
+	if rc := s.cachedWithinRevalidation(filePath); rc != nil {
+		return rc, nil
+	}
+
+	info, err := s.StorageAdapter.Stat(ctx, filePath)
+	if err != nil {
+		s.Invalidate(filePath)
+		return nil, err
+	}
+	if rc := s.cachedWithETag(filePath, info.ETag); rc != nil {
+		return rc, nil
+	}
+
+	if info.Size < 0 || info.Size > s.config.MaxBytes {
+		return s.StorageAdapter.OpenFile(ctx, filePath)
+	}
+	if err := s.fetch(ctx, filePath, info.ETag); err != nil {
+		return nil, err
+	}
+	if rc := s.cachedWithETag(filePath, info.ETag); rc != nil {
+		return rc, nil
+	}
+	return s.StorageAdapter.OpenFile(ctx, filePath)
+}
+
+// Invalidate drops the cached copy of filePath and, when it names a directory, of every
+// file under it.
+func (s *CachingStorage) Invalidate(filePath string) {
+	filePath = strings.TrimSuffix(filePath, "/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.entries[filePath]; ok {
+		s.removeElement(elem)
+	}
+	prefix := filePath + "/"
+	if filePath == "" || filePath == "." {
+		prefix = ""
+	}
+	for path, elem := range s.entries {
+		if strings.HasPrefix(path, prefix) {
+			s.removeElement(elem)
+		}
+	}
+}
+
+// cachedWithinRevalidation opens an entry validated within RevalidateAfter.
+func (s *CachingStorage) cachedWithinRevalidation(filePath string) io.ReadCloser {
+	if s.config.RevalidateAfter <= 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.entries[filePath]
+	if !ok || time.Since(elem.Value.(*cacheEntry).validated) > s.config.RevalidateAfter {
+		return nil
+	}
+	return s.openElement(elem)
+}
+
+// cachedWithETag opens an entry whose ETag matches the backend's.
+func (s *CachingStorage) cachedWithETag(filePath, etag string) io.ReadCloser {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.entries[filePath]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*cacheEntry)
+	if etag == "" || entry.etag != etag {
+		s.removeElement(elem)
+		return nil
+	}
+	entry.validated = time.Now()
+	return s.openElement(elem)
+}
+
+// openElement opens a cached file and marks it recently used; callers must hold mu.
+func (s *CachingStorage) openElement(elem *list.Element) io.ReadCloser {
+	file, err := os.Open(elem.Value.(*cacheEntry).file)
+	if err != nil {
+		s.removeElement(elem)
+		return nil
+	}
+	s.lru.MoveToFront(elem)
+	return file
+}
+
+// fetch downloads filePath into the cache and evicts old entries to make room. The copy is
+// only kept if the file still has etag after the download, so it is known to be that version.
+func (s *CachingStorage) fetch(ctx context.Context, filePath, etag string) error {
+	rc, err := s.StorageAdapter.OpenFile(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp(s.config.Dir, "fetch-*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, io.LimitReader(rc, s.config.MaxBytes+1))
+	tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read file: %v", err)
+	}
+	if size > s.config.MaxBytes {
+		return nil
+	}
+	if info, err := s.StorageAdapter.Stat(ctx, filePath); err != nil || info.ETag != etag {
+		// Changed while it was downloaded; the caller reads it from the backend.
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(filePath))
+	cacheFile := filepath.Join(s.config.Dir, hex.EncodeToString(sum[:])+"-"+hex.EncodeToString([]byte(etag)))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.entries[filePath]; ok {
+		s.removeElement(elem)
+	}
+	for s.size+size > s.config.MaxBytes && s.lru.Len() > 0 {
+		s.removeElement(s.lru.Back())
+	}
+	if err := os.Rename(tmp.Name(), cacheFile); err != nil {
+		return fmt.Errorf("failed to store cache file: %v", err)
+	}
+
+	entry := &cacheEntry{path: filePath, file: cacheFile, etag: etag, size: size, validated: time.Now()}
+	s.entries[filePath] = s.lru.PushFront(entry)
+	s.size += size
+	return nil
+}
+
+// removeElement evicts an entry; callers must hold mu. Open readers keep their file handle.
+func (s *CachingStorage) removeElement(elem *list.Element) {
+	entry := s.lru.Remove(elem).(*cacheEntry)
+	delete(s.entries, entry.path)
+	s.size -= entry.size
+	os.Remove(entry.file)
+}
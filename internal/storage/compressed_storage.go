@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Metadata keys shared with the API layer.
+const (
+	MetaContentType     = "content_type"
+	MetaContentEncoding = "content_encoding"
+
+	metaUncompressedSize = "uncompressed_size"
+)
+
+// Supported compression encodings, named as in HTTP Content-Encoding.
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+type encodedContentKey struct{}
+
+// WithEncodedContent asks CompressedStorage.OpenFile to return stored bytes without
+// decompressing them, so they can be served with a Content-Encoding header. Writes with
+// it store the content as given, without compressing it.
+func WithEncodedContent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, encodedContentKey{}, true)
+}
+
+// EncodedContent reports whether ctx was created by WithEncodedContent.
+func EncodedContent(ctx context.Context) bool {
+	encoded, _ := ctx.Value(encodedContentKey{}).(bool)
+	return encoded
+}
+
+// CompressionConfig selects which files are compressed and how.
+type CompressionConfig struct {
+	// Algorithm is EncodingGzip or EncodingZstd.
+	Algorithm string
+	// ContentTypes are content type prefixes to compress, e.g. "text/" or "application/json".
+	ContentTypes []string
+	// SpoolDir holds compressed uploads until they are stored; the OS temp dir when empty.
+	SpoolDir string
+}
+
+// CompressedStorage is a StorageAdapter decorator that compresses matching files on
+// write and decompresses on read. The encoding is recorded in metadata, so files
+// written before compression was enabled are still read as-is.
+type CompressedStorage struct {
+	StorageAdapter
+	config CompressionConfig
+}
+
+var _ StorageAdapter = (*CompressedStorage)(nil)
+
+// NewCompressedStorage wraps inner with transparent compression.
+func NewCompressedStorage(inner StorageAdapter, config CompressionConfig) (*CompressedStorage, error) {
+	if config.Algorithm != EncodingGzip && config.Algorithm != EncodingZstd {
+		return nil, fmt.Errorf("unsupported compression algorithm: %q", config.Algorithm)
+	}
+	return &CompressedStorage{StorageAdapter: inner, config: config}, nil
+}
+
+// UploadFile compresses and writes a new file.
+func (s *CompressedStorage) UploadFile(ctx context.Context, filePath string, data []byte) error {
+	return s.WriteFile(ctx, filePath, data, false)
+}
+
+// WriteFile compresses and writes a file.
+func (s *CompressedStorage) WriteFile(ctx context.Context, path string, content []byte, overwrite bool) error {
+	return s.WriteStream(ctx, path, bytes.NewReader(content), WriteOptions{Overwrite: overwrite})
+}
+
+// WriteStream compresses r when the content type matches, unless ctx carries WithEncodedContent. The compressed content is spooled
+// to SpoolDir first, so the uncompressed size is stored with it in a single write.
+func (s *CompressedStorage) WriteStream(ctx context.Context, path string, r io.Reader, opts WriteOptions) error {
+	if EncodedContent(ctx) || !s.shouldCompress(path, opts.Metadata) {
+		return s.StorageAdapter.WriteStream(ctx, path, r, opts)
+	}
+
+	spool, err := os.CreateTemp(s.config.SpoolDir, "compress-*")
+	if err != nil {
+		return fmt.Errorf("failed to create spool file: %v", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	counter := &countingReader{r: r}
+	if err := s.compress(spool, counter); err != nil {
+		return fmt.Errorf("failed to compress upload: %w", err)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind spool file: %v", err)
+	}
+
+	metadata := copyMap(opts.Metadata)
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	metadata[MetaContentEncoding] = s.config.Algorithm
+	metadata[metaUncompressedSize] = strconv.FormatInt(counter.n, 10)
+	opts.Metadata = metadata
+	return s.StorageAdapter.WriteStream(ctx, path, spool, opts)
+}
+
+// ReadFile reads and decompresses a file.
+func (s *CompressedStorage) ReadFile(ctx context.Context, filePath string) ([]byte, error) {
+	rc, err := s.OpenFile(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	return data, nil
+}
+
+// OpenFile returns a decompressing reader, or the stored bytes when ctx carries WithEncodedContent.
+func (s *CompressedStorage) OpenFile(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	info, err := s.StorageAdapter.Stat(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	encoding := info.Metadata[MetaContentEncoding]
+	if encoding == "" || EncodedContent(ctx) {
+		return s.StorageAdapter.OpenFile(ctx, filePath)
+	}
+
+	rc, err := s.StorageAdapter.OpenFile(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := decompress(rc, encoding)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to decompress %s: %v", filePath, err)
+	}
+	return decoded, nil
+}
+
+// Stat describes what OpenFile returns for the same ctx: the uncompressed size, or -1 if it
+// was never recorded, without the content encoding; or with WithEncodedContent, the stored
+// size and encoding.
+func (s *CompressedStorage) Stat(ctx context.Context, filePath string) (*FileInfo, error) {
+	info, err := s.StorageAdapter.Stat(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if info.Metadata[MetaContentEncoding] == "" {
+		return info, nil
+	}
+
+	recorded := info.Metadata[metaUncompressedSize]
+	delete(info.Metadata, metaUncompressedSize)
+	if EncodedContent(ctx) {
+		return info, nil
+	}
+	delete(info.Metadata, MetaContentEncoding)
+	info.Size = -1
+	if size, err := strconv.ParseInt(recorded, 10, 64); err == nil {
+		info.Size = size
+	}
+	return info, nil
+}
+
+// SetMetadata replaces user metadata while keeping the compression markers.
+func (s *CompressedStorage) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	info, err := s.StorageAdapter.Stat(ctx, filePath)
+	if err != nil {
+		return err
+	}
+
+	merged := copyMap(metadata)
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	for _, key := range []string{MetaContentEncoding, metaUncompressedSize} {
+		if v, ok := info.Metadata[key]; ok {
+			merged[key] = v
+		} else {
+			delete(merged, key)
+		}
+	}
+	return s.StorageAdapter.SetMetadata(ctx, filePath, merged)
+}
+
+// shouldCompress matches the content type from metadata, falling back to the file extension.
+func (s *CompressedStorage) shouldCompress(path string, metadata map[string]string) bool {
+	contentType := metadata[MetaContentType]
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(path))
+	}
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range s.config.ContentTypes {
+		if prefix != "" && strings.HasPrefix(contentType, strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *CompressedStorage) compress(w io.Writer, r io.Reader) error {
+	var enc io.WriteCloser
+	switch s.config.Algorithm {
+	case EncodingZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		enc = zw
+	default:
+		enc = gzip.NewWriter(w)
+	}
+
+	if _, err := io.Copy(enc, r); err != nil {
+		enc.Close()
+		return err
+	}
+	return enc.Close()
+}
+
+// decompress wraps rc with a decoder for encoding; closing the result closes rc.
+func decompress(rc io.ReadCloser, encoding string) (io.ReadCloser, error) {
+	switch encoding {
+	case EncodingGzip:
+		zr, err := gzip.NewReader(rc)
+		if err != nil {
+			return nil, err
+		}
+		return &decodingReader{Reader: zr, close: func() { zr.Close() }, src: rc}, nil
+	case EncodingZstd:
+		zr, err := zstd.NewReader(rc)
+		if err != nil {
+			return nil, err
+		}
+		return &decodingReader{Reader: zr, close: zr.Close, src: rc}, nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+type decodingReader struct {
+	io.Reader
+	close func()
+	src   io.Closer
+}
+
+func (r *decodingReader) Close() error {
+	r.close()
+	return r.src.Close()
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,405 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metadata keys and locations used by DedupStorage.
+const (
+	// metaDedupHash names the content blob: its SHA-256, or HMAC-SHA256 with a hash key.
+	metaDedupHash      = "dedup_sha256"
+	metaDedupSize      = "dedup_size"
+	metaDedupNamespace = "dedup_ns"
+	// metaDedupUsedAt records when a blob was last written or referenced.
+	metaDedupUsedAt = "dedup_used_at"
+
+	// DedupBlobDir holds the content blobs. Listings leave it out unless it is listed itself.
+	DedupBlobDir    = indexDirName + "/cas"
+	dedupBlobPrefix = DedupBlobDir + "/"
+	// dedupSharedNamespace holds blobs written without a tenant; it is not a valid tenant ID.
+	dedupSharedNamespace = "_shared"
+)
+
+// DedupStats summarizes how much space deduplication saves.
+type DedupStats struct {
+	Files        int   `json:"files"`
+	Blobs        int   `json:"blobs"`
+	LogicalBytes int64 `json:"logicalBytes"`
+	StoredBytes  int64 `json:"storedBytes"`
+	BytesSaved   int64 `json:"bytesSaved"`
+}
+
+// GCResult reports what a garbage collection pass removed.
+type GCResult struct {
+	Scanned    int   `json:"scanned"`
+	Deleted    int   `json:"deleted"`
+	FreedBytes int64 `json:"freedBytes"`
+}
+
+// DedupConfig controls DedupStorage.
+type DedupConfig struct {
+	// SpoolDir holds uploads while they are hashed; the OS temp dir when empty.
+	SpoolDir string
+	// HashKey, when set, names blobs by HMAC-SHA256 instead of SHA-256, so blob names do not
+	// reveal which content is stored. Set it when content is encrypted.
+	HashKey []byte
+}
+
+// DedupStorage is a StorageAdapter decorator that stores each distinct content once in the
+// wrapped backend, named by its hash, in a namespace per tenant. The logical path holds an
+// empty reference object whose metadata names the blob, so listing, tags and retention keep
+// working on logical paths. The reference objects are the only record of which blobs are in
+// use: deleting a file only removes its reference, and CollectGarbage scans them to find
+// blobs nothing references.
+type DedupStorage struct {
+	StorageAdapter
+	config DedupConfig
+
+	// pending counts writes that have reserved a blob but not committed their reference yet.
+	pending map[string]int
+	mu      sync.Mutex
+}
+
+var _ StorageAdapter = (*DedupStorage)(nil)
+
+// NewDedupStorage wraps inner with content-addressable deduplication.
+func NewDedupStorage(inner StorageAdapter, config DedupConfig) *DedupStorage {
+	return &DedupStorage{
+		StorageAdapter: inner,
+		config:         config,
+		pending:        make(map[string]int),
+	}
+}
+
+// UploadFile writes a new deduplicated file.
+func (s *DedupStorage) UploadFile(ctx context.Context, filePath string, data []byte) error {
+	return s.WriteFile(ctx, filePath, data, false)
+}
+
+// WriteFile writes a deduplicated file.
+func (s *DedupStorage) WriteFile(ctx context.Context, path string, content []byte, overwrite bool) error {
+	return s.WriteStream(ctx, path, bytes.NewReader(content), WriteOptions{Overwrite: overwrite})
+}
+
+// WriteStream hashes r, stores the content blob if it is new and points path at it.
+func (s *DedupStorage) WriteStream(ctx context.Context, path string, r io.Reader, opts WriteOptions) error {
+	spool, err := os.CreateTemp(s.config.SpoolDir, "dedup-*")
+	if err != nil {
+		return fmt.Errorf("failed to create spool file: %v", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	hasher := sha256.New()
+	if s.config.HashKey != nil {
+		hasher = hmac.New(sha256.New, s.config.HashKey)
+	}
+	size, err := io.Copy(io.MultiWriter(spool, hasher), r)
+	if err != nil {
+		return fmt.Errorf("failed to spool upload: %v", err)
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	namespace := TenantFromContext(ctx)
+	if namespace == "" {
+		namespace = dedupSharedNamespace
+	}
+	blob := dedupBlobPath(namespace, hash)
+
+	if _, err := s.StorageAdapter.Stat(ctx, path); err == nil && !opts.Overwrite {
+		return fmt.Errorf("file already exists and overwrite is disabled: %s", path)
+	}
+
+	// Reserve the blob so garbage collection in this process cannot remove it mid-write;
+	// other processes see its refreshed use time.
+	s.mu.Lock()
+	s.pending[blob]++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if s.pending[blob]--; s.pending[blob] == 0 {
+			delete(s.pending, blob)
+		}
+		s.mu.Unlock()
+	}()
+
+	// The blob carries the content type, so layers below (e.g. compression) treat it
+	// like the file itself.
+	contentType := opts.Metadata[MetaContentType]
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(path))
+	}
+	if err := s.storeBlob(ctx, blob, contentType, spool); err != nil {
+		return err
+	}
+
+	metadata := copyMap(opts.Metadata)
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	metadata[metaDedupHash] = hash
+	metadata[metaDedupSize] = strconv.FormatInt(size, 10)
+	metadata[metaDedupNamespace] = namespace
+	// The reference is stored as is: encoding it would only describe the empty reference.
+	refCtx := WithEncodedContent(ctx)
+	if err := s.StorageAdapter.WriteStream(refCtx, path, bytes.NewReader(nil), WriteOptions{Overwrite: opts.Overwrite, Metadata: metadata, Tags: opts.Tags}); err != nil {
+		return err
+	}
+
+	// A collector that checked the blob just before it was reused may have removed it.
+	if _, err := s.StorageAdapter.Stat(ctx, blob); err != nil {
+		return s.writeBlob(ctx, blob, contentType, spool)
+	}
+	return nil
+}
+
+// ReadFile reads a file through its content reference.
+func (s *DedupStorage) ReadFile(ctx context.Context, filePath string) ([]byte, error) {
+	rc, err := s.OpenFile(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	return data, nil
+}
+
+// OpenFile opens the content blob a logical path points at. Files written before
+// deduplication was enabled are read directly.
+func (s *DedupStorage) OpenFile(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	info, err := s.StorageAdapter.Stat(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	blob := ReferencedBlob(info.Metadata)
+	if blob == "" {
+		return s.StorageAdapter.OpenFile(ctx, filePath)
+	}
+	return s.StorageAdapter.OpenFile(ctx, blob)
+}
+
+// Stat reports the logical size and uses the content hash as ETag. With
+// WithEncodedContent, size and encoding are those of the stored content blob.
+func (s *DedupStorage) Stat(ctx context.Context, filePath string) (*FileInfo, error) {
+	info, err := s.StorageAdapter.Stat(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	hash := info.Metadata[metaDedupHash]
+	if hash == "" {
+		return info, nil
+	}
+
+	if size, err := strconv.ParseInt(info.Metadata[metaDedupSize], 10, 64); err == nil {
+		info.Size = size
+	}
+	delete(info.Metadata, MetaContentEncoding)
+	if EncodedContent(ctx) {
+		content, err := s.StorageAdapter.Stat(ctx, ReferencedBlob(info.Metadata))
+		if err != nil {
+			return nil, err
+		}
+		info.Size = content.Size
+		if encoding := content.Metadata[MetaContentEncoding]; encoding != "" {
+			info.Metadata[MetaContentEncoding] = encoding
+		}
+	}
+	info.ETag = fmt.Sprintf("\"%s\"", hash)
+	for _, key := range []string{metaDedupHash, metaDedupSize, metaDedupNamespace} {
+		delete(info.Metadata, key)
+	}
+	return info, nil
+}
+
+// SetMetadata replaces user metadata while keeping the content reference.
+func (s *DedupStorage) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	info, err := s.StorageAdapter.Stat(ctx, filePath)
+	if err != nil {
+		return err
+	}
+
+	merged := copyMap(metadata)
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	for _, key := range []string{metaDedupHash, metaDedupSize, metaDedupNamespace} {
+		if v, ok := info.Metadata[key]; ok {
+			merged[key] = v
+		} else {
+			delete(merged, key)
+		}
+	}
+	return s.StorageAdapter.SetMetadata(ctx, filePath, merged)
+}
+
+// Stats scans the reference objects for deduplication savings.
+func (s *DedupStorage) Stats(ctx context.Context) (*DedupStats, error) {
+	refs, err := s.references(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &DedupStats{}
+	for _, ref := range refs {
+		stats.Files += ref.refs
+		stats.Blobs++
+		stats.LogicalBytes += int64(ref.refs) * ref.size
+		stats.StoredBytes += ref.size
+	}
+	stats.BytesSaved = stats.LogicalBytes - stats.StoredBytes
+	return stats, nil
+}
+
+// CollectGarbage deletes content blobs that no logical file references. It scans the
+// reference objects right before deciding, and keeps blobs written or referenced within
+// gracePeriod of the scan: writers refresh a blob's use time before they reference it, so a
+// reference written after the scan always points at a blob the pass keeps. The grace period
+// must exceed the time an upload takes from storing its blob to writing its reference.
+func (s *DedupStorage) CollectGarbage(ctx context.Context, gracePeriod time.Duration) (*GCResult, error) {
+	cutoff := time.Now().Add(-gracePeriod)
+	live, err := s.references(ctx)
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := s.StorageAdapter.ListFiles(ctx, dedupBlobPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GCResult{}
+	for _, blob := range blobs {
+		blob = strings.TrimPrefix(blob, "./")
+		if !strings.HasPrefix(blob, dedupBlobPrefix) {
+			continue
+		}
+		result.Scanned++
+		if live[blob] != nil {
+			continue
+		}
+
+		info, err := s.StorageAdapter.Stat(ctx, blob)
+		if err != nil || lastUsed(info).After(cutoff) {
+			continue
+		}
+
+		s.mu.Lock()
+		if s.pending[blob] > 0 {
+			s.mu.Unlock()
+			continue
+		}
+		err = s.StorageAdapter.DeleteFile(ctx, blob)
+		s.mu.Unlock()
+		if err != nil {
+			return result, fmt.Errorf("failed to delete blob %s: %v", blob, err)
+		}
+		result.Deleted++
+		result.FreedBytes += info.Size
+	}
+	return result, nil
+}
+
+// blobRefs counts the logical files that point at a content blob.
+type blobRefs struct {
+	refs int
+	size int64
+}
+
+// references scans every logical file and returns the blobs they point at.
+func (s *DedupStorage) references(ctx context.Context) (map[string]*blobRefs, error) {
+	files, err := s.StorageAdapter.ListFiles(ctx, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make(map[string]*blobRefs)
+	for _, file := range files {
+		info, err := s.StorageAdapter.Stat(ctx, file)
+		if err != nil {
+			// Deleted since it was listed.
+			continue
+		}
+		blob := ReferencedBlob(info.Metadata)
+		if blob == "" {
+			continue
+		}
+		ref := refs[blob]
+		if ref == nil {
+			ref = &blobRefs{}
+			ref.size, _ = strconv.ParseInt(info.Metadata[metaDedupSize], 10, 64)
+			refs[blob] = ref
+		}
+		ref.refs++
+	}
+	return refs, nil
+}
+
+// storeBlob makes sure blob holds the spooled content and marks it as just used.
+func (s *DedupStorage) storeBlob(ctx context.Context, blob, contentType string, spool *os.File) error {
+	if info, err := s.StorageAdapter.Stat(ctx, blob); err == nil {
+		metadata := copyMap(info.Metadata)
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		metadata[metaDedupUsedAt] = time.Now().UTC().Format(time.RFC3339Nano)
+		if err := s.StorageAdapter.SetMetadata(ctx, blob, metadata); err == nil {
+			return nil
+		}
+		// Removed since the check; store it again.
+	}
+	return s.writeBlob(ctx, blob, contentType, spool)
+}
+
+func (s *DedupStorage) writeBlob(ctx context.Context, blob, contentType string, spool *os.File) error {
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind spool file: %v", err)
+	}
+	metadata := map[string]string{metaDedupUsedAt: time.Now().UTC().Format(time.RFC3339Nano)}
+	if contentType != "" {
+		metadata[MetaContentType] = contentType
+	}
+	return s.StorageAdapter.WriteStream(ctx, blob, spool, WriteOptions{Overwrite: true, Metadata: metadata})
+}
+
+// lastUsed is the later of a blob's modification time and its recorded use time.
+func lastUsed(info *FileInfo) time.Time {
+	used, err := time.Parse(time.RFC3339Nano, info.Metadata[metaDedupUsedAt])
+	if err != nil || used.Before(info.ModTime) {
+		return info.ModTime
+	}
+	return used
+}
+
+// ReferencedBlob returns the blob a reference object's stored metadata points at, or "" for a
+// file stored directly.
+func ReferencedBlob(metadata map[string]string) string {
+	hash := metadata[metaDedupHash]
+	if len(hash) < 2 {
+		return ""
+	}
+	namespace := metadata[metaDedupNamespace]
+	if namespace == "" {
+		// Written before blobs had namespaces.
+		return dedupBlobPrefix + hash[:2] + "/" + hash
+	}
+	return dedupBlobPath(namespace, hash)
+}
+
+func dedupBlobPath(namespace, hash string) string {
+	return dedupBlobPrefix + namespace + "/" + hash[:2] + "/" + hash
+}
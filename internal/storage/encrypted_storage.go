@@ -0,0 +1,524 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Metadata keys written by EncryptedStorage.
+const (
+	metaEncAlgorithm  = "enc_alg"
+	metaEncChunkSize  = "enc_chunk_size"
+	metaEncHeaderSize = "enc_header_size"
+	// Set by RotateKeys: a re-wrapped data key and the object it belongs to.
+	metaEncObjectID   = "enc_object_id"
+	metaEncKeyID      = "enc_kek_id"
+	metaEncWrappedKey = "enc_wrapped_key"
+
+	encAlgorithm        = "AES256-GCM-CHUNKED-v2"
+	encLegacyAlgorithm  = "AES256-GCM-CHUNKED-v1"
+	encDefaultChunkSize = 64 * 1024
+	encTagSize          = 16
+	encObjectIDSize     = 16
+
+	// encMagic starts the header of every encrypted object.
+	encMagic = "\x89ENC\r\n\x1a\x02"
+)
+
+// EncryptedStorage is a StorageAdapter decorator that encrypts content before it
+// reaches the wrapped backend. Each object gets a random AES-256 data key, wrapped
+// by the KeyProvider and stored in a header at the start of the object, so the key
+// can never be paired with another version's content. Content is sealed in
+// fixed-size AES-GCM chunks so reads and writes stream.
+//
+// Objects without encryption metadata are returned as-is, so existing plaintext
+// data stays readable, and objects written before the header was introduced are
+// decrypted with the key in their metadata.
+type EncryptedStorage struct {
+	StorageAdapter
+	keys      KeyProvider
+	chunkSize int
+}
+
+var _ StorageAdapter = (*EncryptedStorage)(nil)
+
+// NewEncryptedStorage wraps inner with client-side envelope encryption.
+func NewEncryptedStorage(inner StorageAdapter, keys KeyProvider) *EncryptedStorage {
+	return &EncryptedStorage{StorageAdapter: inner, keys: keys, chunkSize: encDefaultChunkSize}
+}
+
+// UploadFile encrypts and writes a new file.
+func (s *EncryptedStorage) UploadFile(ctx context.Context, filePath string, data []byte) error {
+	return s.WriteFile(ctx, filePath, data, false)
+}
+
+// WriteFile encrypts and writes a file.
+func (s *EncryptedStorage) WriteFile(ctx context.Context, path string, content []byte, overwrite bool) error {
+	return s.WriteStream(ctx, path, bytes.NewReader(content), WriteOptions{Overwrite: overwrite})
+}
+
+// WriteStream encrypts r chunk by chunk while it is written to the wrapped backend.
+func (s *EncryptedStorage) WriteStream(ctx context.Context, path string, r io.Reader, opts WriteOptions) error {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return fmt.Errorf("failed to generate data key: %v", err)
+	}
+	objectID := make([]byte, encObjectIDSize)
+	if _, err := rand.Read(objectID); err != nil {
+		return fmt.Errorf("failed to generate object ID: %v", err)
+	}
+	aead, err := newChunkAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	keyID := s.keys.CurrentKeyID()
+	wrapped, err := s.keys.WrapKey(ctx, keyID, dataKey)
+	if err != nil {
+		return fmt.Errorf("failed to wrap data key: %v", err)
+	}
+	header, err := encodeHeader(objectID, s.chunkSize, keyID, wrapped)
+	if err != nil {
+		return err
+	}
+
+	metadata := userMetadata(opts.Metadata)
+	metadata[metaEncAlgorithm] = encAlgorithm
+	metadata[metaEncChunkSize] = strconv.Itoa(s.chunkSize)
+	metadata[metaEncHeaderSize] = strconv.Itoa(len(header))
+	opts.Metadata = metadata
+
+	content := io.MultiReader(bytes.NewReader(header), newEncryptReader(r, aead, s.chunkSize))
+	return s.StorageAdapter.WriteStream(ctx, path, content, opts)
+}
+
+// ReadFile reads and decrypts a file.
+func (s *EncryptedStorage) ReadFile(ctx context.Context, filePath string) ([]byte, error) {
+	rc, err := s.OpenFile(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	return data, nil
+}
+
+// OpenFile returns a reader that decrypts the file as it is read.
+func (s *EncryptedStorage) OpenFile(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	rc, err := s.StorageAdapter.OpenFile(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	src := bufio.NewReader(rc)
+
+	env, err := s.envelope(ctx, filePath, src)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to decrypt %s: %w", filePath, err)
+	}
+	if env == nil {
+		return struct {
+			io.Reader
+			io.Closer
+		}{src, rc}, nil
+	}
+
+	dataKey, err := s.keys.UnwrapKey(ctx, env.keyID, env.wrapped)
+	if err == nil {
+		var aead cipher.AEAD
+		if aead, err = newChunkAEAD(dataKey); err == nil {
+			return &decryptReader{
+				src:    src,
+				closer: rc,
+				aead:   aead,
+				sealed: make([]byte, env.chunkSize+encTagSize),
+			}, nil
+		}
+	}
+	rc.Close()
+	return nil, fmt.Errorf("failed to decrypt %s: %v", filePath, err)
+}
+
+// Stat reports the plaintext size and hides encryption metadata.
+func (s *EncryptedStorage) Stat(ctx context.Context, filePath string) (*FileInfo, error) {
+	info, err := s.StorageAdapter.Stat(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	alg := info.Metadata[metaEncAlgorithm]
+	if alg == "" {
+		return info, nil
+	}
+
+	chunkSize, err := strconv.Atoi(info.Metadata[metaEncChunkSize])
+	if err != nil || chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid encryption chunk size on %s", filePath)
+	}
+	headerSize := 0
+	if alg == encAlgorithm {
+		if headerSize, err = strconv.Atoi(info.Metadata[metaEncHeaderSize]); err != nil || headerSize < 0 {
+			return nil, fmt.Errorf("invalid encryption header size on %s", filePath)
+		}
+	}
+	info.Size = plaintextSize(info.Size-int64(headerSize), chunkSize)
+	info.Metadata = userMetadata(info.Metadata)
+	return info, nil
+}
+
+// SetMetadata replaces user metadata while keeping the encryption envelope.
+func (s *EncryptedStorage) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	info, err := s.StorageAdapter.Stat(ctx, filePath)
+	if err != nil {
+		return err
+	}
+
+	merged := copyMap(metadata)
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	for k, v := range info.Metadata {
+		if strings.HasPrefix(k, "enc_") {
+			merged[k] = v
+		}
+	}
+	return s.StorageAdapter.SetMetadata(ctx, filePath, merged)
+}
+
+// RotateKeys re-wraps the data keys of every file under dirPath with the current
+// key-encryption key. Content is not re-encrypted: the re-wrapped key is recorded in
+// metadata together with the ID from the object's header, and is only used while the
+// content still has that ID. Rotating the root also covers the deduplicated content
+// blobs under the index directory, which listings leave out.
+// It returns the number of files updated.
+func (s *EncryptedStorage) RotateKeys(ctx context.Context, dirPath string) (int, error) {
+	files, err := s.StorageAdapter.ListFiles(ctx, dirPath)
+	if err != nil {
+		return 0, err
+	}
+	if root := strings.Trim(path.Clean("/"+dirPath), "/"); root == "" {
+		blobs, err := s.StorageAdapter.ListFiles(ctx, DedupBlobDir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return 0, err
+		}
+		files = append(files, blobs...)
+	}
+
+	current := s.keys.CurrentKeyID()
+	rotated := 0
+	for _, file := range files {
+		env, err := s.openEnvelope(ctx, file)
+		if err != nil {
+			return rotated, err
+		}
+		if env == nil || env.keyID == current {
+			continue
+		}
+
+		dataKey, err := s.keys.UnwrapKey(ctx, env.keyID, env.wrapped)
+		if err != nil {
+			return rotated, fmt.Errorf("failed to unwrap key for %s: %v", file, err)
+		}
+		rewrapped, err := s.keys.WrapKey(ctx, current, dataKey)
+		if err != nil {
+			return rotated, fmt.Errorf("failed to re-wrap key for %s: %v", file, err)
+		}
+
+		metadata := env.info.Metadata
+		if env.objectID != "" {
+			metadata[metaEncObjectID] = env.objectID
+		}
+		metadata[metaEncKeyID] = current
+		metadata[metaEncWrappedKey] = base64.StdEncoding.EncodeToString(rewrapped)
+		if err := s.StorageAdapter.SetMetadata(ctx, file, metadata); err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
+
+// envelope describes how an object's content was encrypted.
+type envelope struct {
+	info      *FileInfo
+	objectID  string // "" for objects without a header
+	keyID     string
+	wrapped   []byte
+	chunkSize int
+}
+
+// openEnvelope reads the envelope of filePath, or nil if it is not encrypted.
+func (s *EncryptedStorage) openEnvelope(ctx context.Context, filePath string) (*envelope, error) {
+	rc, err := s.StorageAdapter.OpenFile(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	env, err := s.envelope(ctx, filePath, bufio.NewReader(rc))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption envelope of %s: %w", filePath, err)
+	}
+	return env, nil
+}
+
+// envelope consumes the header from src, the opened content of filePath, and returns the
+// key to decrypt the rest with, or nil if the content is not encrypted. The metadata is read
+// after the content was opened; a re-wrapped key in it only applies to the same object.
+func (s *EncryptedStorage) envelope(ctx context.Context, filePath string, src *bufio.Reader) (*envelope, error) {
+	magic, err := src.Peek(len(encMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	var env *envelope
+	if string(magic) == encMagic {
+		if env, err = decodeHeader(src); err != nil {
+			return nil, fmt.Errorf("invalid encryption header: %v", err)
+		}
+	}
+
+	info, err := s.StorageAdapter.Stat(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	metadata := info.Metadata
+	switch alg := metadata[metaEncAlgorithm]; {
+	case env != nil:
+		if metadata[metaEncObjectID] != env.objectID {
+			break
+		}
+		env.keyID = metadata[metaEncKeyID]
+		if env.wrapped, err = base64.StdEncoding.DecodeString(metadata[metaEncWrappedKey]); err != nil {
+			return nil, fmt.Errorf("invalid wrapped key: %v", err)
+		}
+	case alg == "":
+		return nil, nil
+	case alg == encLegacyAlgorithm:
+		chunkSize, err := strconv.Atoi(metadata[metaEncChunkSize])
+		if err != nil || chunkSize <= 0 {
+			return nil, fmt.Errorf("invalid chunk size %q", metadata[metaEncChunkSize])
+		}
+		wrapped, err := base64.StdEncoding.DecodeString(metadata[metaEncWrappedKey])
+		if err != nil {
+			return nil, fmt.Errorf("invalid wrapped key: %v", err)
+		}
+		env = &envelope{keyID: metadata[metaEncKeyID], wrapped: wrapped, chunkSize: chunkSize}
+	case alg == encAlgorithm:
+		return nil, fmt.Errorf("encryption header is missing")
+	default:
+		return nil, fmt.Errorf("unsupported encryption algorithm %q", alg)
+	}
+	env.info = info
+	return env, nil
+}
+
+// encodeHeader lays out the object header: the magic, the object ID, the chunk size and
+// the length-prefixed key ID and wrapped key.
+func encodeHeader(objectID []byte, chunkSize int, keyID string, wrapped []byte) ([]byte, error) {
+	if len(keyID) > 0xffff || len(wrapped) > 0xffff {
+		return nil, fmt.Errorf("wrapped data key is too large")
+	}
+	var header bytes.Buffer
+	header.WriteString(encMagic)
+	header.Write(objectID)
+	binary.Write(&header, binary.BigEndian, uint32(chunkSize))
+	binary.Write(&header, binary.BigEndian, uint16(len(keyID)))
+	header.WriteString(keyID)
+	binary.Write(&header, binary.BigEndian, uint16(len(wrapped)))
+	header.Write(wrapped)
+	return header.Bytes(), nil
+}
+
+// decodeHeader reads a header written by encodeHeader.
+func decodeHeader(r io.Reader) (*envelope, error) {
+	fixed := make([]byte, len(encMagic)+encObjectIDSize+4+2)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+	fields := fixed[len(encMagic):]
+	env := &envelope{
+		objectID:  hex.EncodeToString(fields[:encObjectIDSize]),
+		chunkSize: int(binary.BigEndian.Uint32(fields[encObjectIDSize:])),
+	}
+	if env.chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d", env.chunkSize)
+	}
+
+	keyID := make([]byte, binary.BigEndian.Uint16(fields[encObjectIDSize+4:]))
+	if _, err := io.ReadFull(r, keyID); err != nil {
+		return nil, err
+	}
+	var size uint16
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	env.keyID = string(keyID)
+	env.wrapped = make([]byte, size)
+	if _, err := io.ReadFull(r, env.wrapped); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+func newChunkAEAD(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce derives a chunk nonce from its index. The last byte marks the final
+// chunk so truncation at a chunk boundary fails authentication. Data keys are never
+// reused across objects, so counter nonces are safe.
+func chunkNonce(counter uint64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, counter)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// plaintextSize derives the plaintext length from the sealed length.
+func plaintextSize(sealedSize int64, chunkSize int) int64 {
+	sealedChunk := int64(chunkSize + encTagSize)
+	chunks := sealedSize / sealedChunk
+	if sealedSize%sealedChunk != 0 {
+		chunks++
+	}
+	return sealedSize - chunks*encTagSize
+}
+
+// userMetadata strips the encryption envelope from metadata.
+func userMetadata(metadata map[string]string) map[string]string {
+	out := map[string]string{}
+	for k, v := range metadata {
+		if !strings.HasPrefix(k, "enc_") {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// encryptReader seals plaintext from src into chunks as it is read.
+type encryptReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	plain   []byte
+	out     []byte
+	counter uint64
+	done    bool
+}
+
+func newEncryptReader(src io.Reader, aead cipher.AEAD, chunkSize int) *encryptReader {
+	return &encryptReader{
+		src:   bufio.NewReader(src),
+		aead:  aead,
+		plain: make([]byte, chunkSize),
+	}
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.sealNext(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *encryptReader) sealNext() error {
+	n, err := io.ReadFull(r.src, r.plain)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	final := n < len(r.plain)
+	if !final {
+		if _, err := r.src.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	r.out = r.aead.Seal(r.out[:0], chunkNonce(r.counter, final), r.plain[:n], nil)
+	r.counter++
+	r.done = final
+	return nil
+}
+
+// decryptReader opens sealed chunks from src as they are read.
+type decryptReader struct {
+	src     *bufio.Reader
+	closer  io.Closer
+	aead    cipher.AEAD
+	sealed  []byte
+	out     []byte
+	counter uint64
+	done    bool
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.openNext(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *decryptReader) openNext() error {
+	n, err := io.ReadFull(r.src, r.sealed)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	final := n < len(r.sealed)
+	if !final {
+		if _, err := r.src.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	plain, err := r.aead.Open(r.out[:0], chunkNonce(r.counter, final), r.sealed[:n], nil)
+	if err != nil {
+		return fmt.Errorf("encrypted content failed authentication at chunk %d", r.counter)
+	}
+	r.out = plain
+	r.counter++
+	r.done = final
+	return nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.closer.Close()
+}
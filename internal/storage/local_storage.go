@@ -1,16 +1,31 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 )
 
+// indexDirName holds LocalStorage bookkeeping files and is hidden from listings.
+const indexDirName = ".index"
+
 // LocalStorage is a local file system storage adapter.
 type LocalStorage struct {
 	BasePath string
+
+	indexOnce sync.Once
+	index     *tagIndex
+	indexErr  error
+
+	retentionOnce sync.Once
+	retention     *retentionStore
 }
 
 // Ensure LocalStorage satisfies StorageAdapter.
@@ -28,27 +43,75 @@ func (s *LocalStorage) UploadFile(ctx context.Context, filePath string, data []b
 
 // WriteFile writes data to a file with an overwrite option.
 func (s *LocalStorage) WriteFile(ctx context.Context, path string, content []byte, overwrite bool) error {
+	return s.WriteStream(ctx, path, bytes.NewReader(content), WriteOptions{Overwrite: overwrite})
+}
+
+// WriteStream streams data into a file, replacing it atomically once fully written.
+func (s *LocalStorage) WriteStream(ctx context.Context, path string, r io.Reader, opts WriteOptions) error {
+	if err := ValidateTags(opts.Tags); err != nil {
+		return err
+	}
 	fullPath := filepath.Join(s.BasePath, path)
 
-	// Ensure the directory exists.
+	// Ensure the directories exist.
 	dir := filepath.Dir(fullPath)
-	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create directories: %v", err)
+	tmpDir := filepath.Join(s.BasePath, indexDirName, "tmp")
+	for _, d := range []string{dir, tmpDir} {
+		if err := os.MkdirAll(d, os.ModePerm); err != nil {
+			return fmt.Errorf("failed to create directories: %v", err)
+		}
 	}
 
-	// Prevent overwrite if not allowed.
-	if !overwrite {
-		if _, err := os.Stat(fullPath); err == nil {
+	// Prevent overwrite if not allowed or the file is retained.
+	if _, err := os.Stat(fullPath); err == nil {
+		if !opts.Overwrite {
 			return fmt.Errorf("file already exists and overwrite is disabled: %s", path)
 		}
+		if err := s.retentionRules().check(ctx, path); err != nil {
+			return err
+		}
 	}
 
-	// Write the file.
-	if err := os.WriteFile(fullPath, content, 0644); err != nil {
+	// Write to a temporary file so readers never see partial content.
+	tmp, err := os.CreateTemp(tmpDir, "upload-*")
+	if err != nil {
 		return fmt.Errorf("failed to save file: %v", err)
 	}
+	defer os.Remove(tmp.Name())
 
-	return nil
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save file: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to save file: %v", err)
+	}
+
+	// Metadata goes first: content without its metadata could hold ciphertext whose
+	// encryption envelope is missing, which readers would serve as plaintext.
+	previous, err := s.readMetadata(path)
+	if err != nil {
+		return err
+	}
+	if err := s.writeMetadata(path, opts.Metadata); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), fullPath); err != nil {
+		if _, statErr := os.Stat(fullPath); statErr == nil {
+			s.writeMetadata(path, previous)
+		}
+		return fmt.Errorf("failed to save file: %v", err)
+	}
+
+	// The new file replaces the previous one's tags, even with none of its own.
+	index, err := s.tags()
+	if err != nil {
+		return err
+	}
+	return index.set(path, opts.Tags)
 }
 
 // ReadFile retrieves the content of a file.
@@ -69,6 +132,50 @@ func (s *LocalStorage) ReadFile(ctx context.Context, filePath string) ([]byte, e
 	return data, nil
 }
 
+// OpenFile opens a file for streaming reads.
+func (s *LocalStorage) OpenFile(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(s.BasePath, filePath))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("file not found: %s", filePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	return file, nil
+}
+
+// Stat returns size, ETag and metadata of a file.
+func (s *LocalStorage) Stat(ctx context.Context, filePath string) (*FileInfo, error) {
+	info, err := os.Stat(filepath.Join(s.BasePath, filePath))
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		return nil, fmt.Errorf("file not found: %s", filePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %v", err)
+	}
+
+	metadata, err := s.readMetadata(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileInfo{
+		Path:     filePath,
+		Size:     info.Size(),
+		ETag:     fmt.Sprintf("\"%x-%x\"", info.ModTime().UnixNano(), info.Size()),
+		ModTime:  info.ModTime(),
+		Metadata: metadata,
+	}, nil
+}
+
+// SetMetadata replaces the metadata of a file.
+func (s *LocalStorage) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	if _, err := os.Stat(filepath.Join(s.BasePath, filePath)); os.IsNotExist(err) {
+		return fmt.Errorf("file not found: %s", filePath)
+	}
+	return s.writeMetadata(filePath, metadata)
+}
+
 // DeleteFile removes a file from local storage.
 func (s *LocalStorage) DeleteFile(ctx context.Context, filePath string) error {
 	fullPath := filepath.Join(s.BasePath, filePath)
@@ -77,13 +184,24 @@ func (s *LocalStorage) DeleteFile(ctx context.Context, filePath string) error {
 	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
 		return fmt.Errorf("file not found: %s", filePath)
 	}
+	if err := s.retentionRules().check(ctx, filePath); err != nil {
+		return err
+	}
 
 	// Delete the file.
 	if err := os.Remove(fullPath); err != nil {
 		return fmt.Errorf("failed to delete file: %v", err)
 	}
 
-	return nil
+	// Drop metadata and index tags for the file.
+	if err := s.writeMetadata(filePath, nil); err != nil {
+		return err
+	}
+	index, err := s.tags()
+	if err != nil {
+		return err
+	}
+	return index.remove(filePath)
 }
 
 // ListFiles lists all files in a directory.
@@ -95,6 +213,9 @@ func (s *LocalStorage) ListFiles(ctx context.Context, dirPath string) ([]string,
 		if err != nil {
 			return err
 		}
+		if info.IsDir() && info.Name() == indexDirName {
+			return filepath.SkipDir
+		}
 		if !info.IsDir() {
 			relPath, _ := filepath.Rel(s.BasePath, path)
 			files = append(files, relPath)
@@ -103,8 +224,160 @@ func (s *LocalStorage) ListFiles(ctx context.Context, dirPath string) ([]string,
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to list files: %v", err)
+		return nil, fmt.Errorf("failed to list files: %w", err)
 	}
 
 	return files, nil
 }
+
+// SetTags replaces the index tags of a file.
+func (s *LocalStorage) SetTags(ctx context.Context, filePath string, tags map[string]string) error {
+	if err := ValidateTags(tags); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(s.BasePath, filePath)); os.IsNotExist(err) {
+		return fmt.Errorf("file not found: %s", filePath)
+	}
+
+	index, err := s.tags()
+	if err != nil {
+		return err
+	}
+	return index.set(filePath, tags)
+}
+
+// GetTags returns the index tags of a file.
+func (s *LocalStorage) GetTags(ctx context.Context, filePath string) (map[string]string, error) {
+	if _, err := os.Stat(filepath.Join(s.BasePath, filePath)); os.IsNotExist(err) {
+		return nil, fmt.Errorf("file not found: %s", filePath)
+	}
+
+	index, err := s.tags()
+	if err != nil {
+		return nil, err
+	}
+	tags := index.get(filePath)
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	return tags, nil
+}
+
+// FindFilesByTags searches the embedded tag index.
+func (s *LocalStorage) FindFilesByTags(ctx context.Context, query TagQuery) (*TagSearchResult, error) {
+	index, err := s.tags()
+	if err != nil {
+		return nil, err
+	}
+	return index.find(query), nil
+}
+
+// tags lazily loads the tag index stored under BasePath.
+func (s *LocalStorage) tags() (*tagIndex, error) {
+	s.indexOnce.Do(func() {
+		s.index, s.indexErr = newTagIndex(filepath.Join(s.BasePath, indexDirName, "tags.json"))
+	})
+	return s.index, s.indexErr
+}
+
+// SetImmutabilityPolicy retains a file or prefix until retainUntil.
+func (s *LocalStorage) SetImmutabilityPolicy(ctx context.Context, target string, retainUntil time.Time) error {
+	return s.retentionRules().setPolicy(ctx, target, retainUntil, nil)
+}
+
+// SetLegalHold places or clears a legal hold on a file or prefix.
+func (s *LocalStorage) SetLegalHold(ctx context.Context, target string, hold bool) error {
+	return s.retentionRules().setLegalHold(ctx, target, hold, nil)
+}
+
+// ListRetentionRules returns all active retention rules.
+func (s *LocalStorage) ListRetentionRules(ctx context.Context) ([]RetentionRule, error) {
+	return s.retentionRules().list(ctx)
+}
+
+// HealthCheck verifies that a file can be created under BasePath.
+func (s *LocalStorage) HealthCheck(ctx context.Context) error {
+	tmpDir := filepath.Join(s.BasePath, indexDirName, "tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return fmt.Errorf("base path is not writable: %v", err)
+	}
+	probe, err := os.CreateTemp(tmpDir, "health-*")
+	if err != nil {
+		return fmt.Errorf("base path is not writable: %v", err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// retentionRules returns the store for the retention rules kept under BasePath.
+func (s *LocalStorage) retentionRules() *retentionStore {
+	s.retentionOnce.Do(func() {
+		s.retention = fileRetentionStore(filepath.Join(s.BasePath, indexDirName, "retention.json"))
+	})
+	return s.retention
+}
+
+// metadataPath is the sidecar file holding a file's metadata.
+func (s *LocalStorage) metadataPath(filePath string) string {
+	return filepath.Join(s.BasePath, indexDirName, "meta", filePath+".json")
+}
+
+func (s *LocalStorage) readMetadata(filePath string) (map[string]string, error) {
+	data, err := os.ReadFile(s.metadataPath(filePath))
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %v", err)
+	}
+
+	metadata := map[string]string{}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata: %v", err)
+	}
+	return metadata, nil
+}
+
+// writeMetadata stores metadata in a sidecar file; empty metadata removes it.
+func (s *LocalStorage) writeMetadata(filePath string, metadata map[string]string) error {
+	metaPath := s.metadataPath(filePath)
+	if len(metadata) == 0 {
+		if err := os.Remove(metaPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove metadata: %v", err)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to serialize metadata: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(metaPath), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create metadata directory: %v", err)
+	}
+
+	// Replace the sidecar atomically and durably: it may hold the only copy of a wrapped data key.
+	tmp, err := os.CreateTemp(filepath.Dir(metaPath), ".meta-*")
+	if err != nil {
+		return fmt.Errorf("failed to write metadata: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metadata: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metadata: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metadata: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write metadata: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), metaPath); err != nil {
+		return fmt.Errorf("failed to write metadata: %v", err)
+	}
+	return nil
+}
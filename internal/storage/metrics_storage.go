@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	storageOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "storage_operations_total",
+		Help: "Storage adapter calls by backend and operation.",
+	}, []string{"backend", "operation"})
+	storageErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "storage_errors_total",
+		Help: "Storage adapter calls that returned an error, by backend and operation.",
+	}, []string{"backend", "operation"})
+	storageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "storage_operation_duration_seconds",
+		Help:    "Storage adapter call latency by backend and operation.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 8), // 1ms to ~16s
+	}, []string{"backend", "operation"})
+)
+
+// MetricsStorage is a StorageAdapter decorator that records the count, errors and latency
+// of every call. OpenFile is timed until the file is opened, not until it is read.
+type MetricsStorage struct {
+	StorageAdapter
+	backend string
+}
+
+// NewMetricsStorage labels the metrics of inner's calls with backend, e.g. "azure" or "local".
+func NewMetricsStorage(inner StorageAdapter, backend string) *MetricsStorage {
+	return &MetricsStorage{StorageAdapter: inner, backend: backend}
+}
+
+// track starts timing a call; defer the returned function with the call's error result.
+func (s *MetricsStorage) track(operation string) func(err *error) {
+	start := time.Now()
+	return func(err *error) {
+		storageOperations.WithLabelValues(s.backend, operation).Inc()
+		storageDuration.WithLabelValues(s.backend, operation).Observe(time.Since(start).Seconds())
+		if *err != nil {
+			storageErrors.WithLabelValues(s.backend, operation).Inc()
+		}
+	}
+}
+
+// HealthCheck probes the wrapped adapter without recording it as an operation.
+func (s *MetricsStorage) HealthCheck(ctx context.Context) error {
+	return CheckHealth(ctx, s.StorageAdapter)
+}
+
+func (s *MetricsStorage) UploadFile(ctx context.Context, filePath string, data []byte) (err error) {
+	defer s.track("upload_file")(&err)
+	return s.StorageAdapter.UploadFile(ctx, filePath, data)
+}
+
+func (s *MetricsStorage) WriteFile(ctx context.Context, path string, content []byte, overwrite bool) (err error) {
+	defer s.track("write_file")(&err)
+	return s.StorageAdapter.WriteFile(ctx, path, content, overwrite)
+}
+
+func (s *MetricsStorage) ReadFile(ctx context.Context, filePath string) (data []byte, err error) {
+	defer s.track("read_file")(&err)
+	return s.StorageAdapter.ReadFile(ctx, filePath)
+}
+
+func (s *MetricsStorage) DeleteFile(ctx context.Context, filePath string) (err error) {
+	defer s.track("delete_file")(&err)
+	return s.StorageAdapter.DeleteFile(ctx, filePath)
+}
+
+func (s *MetricsStorage) ListFiles(ctx context.Context, dirPath string) (files []string, err error) {
+	defer s.track("list_files")(&err)
+	return s.StorageAdapter.ListFiles(ctx, dirPath)
+}
+
+func (s *MetricsStorage) WriteStream(ctx context.Context, path string, r io.Reader, opts WriteOptions) (err error) {
+	defer s.track("write_stream")(&err)
+	return s.StorageAdapter.WriteStream(ctx, path, r, opts)
+}
+
+func (s *MetricsStorage) OpenFile(ctx context.Context, filePath string) (rc io.ReadCloser, err error) {
+	defer s.track("open_file")(&err)
+	return s.StorageAdapter.OpenFile(ctx, filePath)
+}
+
+func (s *MetricsStorage) Stat(ctx context.Context, filePath string) (info *FileInfo, err error) {
+	defer s.track("stat")(&err)
+	return s.StorageAdapter.Stat(ctx, filePath)
+}
+
+func (s *MetricsStorage) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) (err error) {
+	defer s.track("set_metadata")(&err)
+	return s.StorageAdapter.SetMetadata(ctx, filePath, metadata)
+}
+
+func (s *MetricsStorage) SetTags(ctx context.Context, filePath string, tags map[string]string) (err error) {
+	defer s.track("set_tags")(&err)
+	return s.StorageAdapter.SetTags(ctx, filePath, tags)
+}
+
+func (s *MetricsStorage) GetTags(ctx context.Context, filePath string) (tags map[string]string, err error) {
+	defer s.track("get_tags")(&err)
+	return s.StorageAdapter.GetTags(ctx, filePath)
+}
+
+func (s *MetricsStorage) FindFilesByTags(ctx context.Context, query TagQuery) (result *TagSearchResult, err error) {
+	defer s.track("find_files_by_tags")(&err)
+	return s.StorageAdapter.FindFilesByTags(ctx, query)
+}
+
+func (s *MetricsStorage) SetImmutabilityPolicy(ctx context.Context, target string, retainUntil time.Time) (err error) {
+	defer s.track("set_immutability_policy")(&err)
+	return s.StorageAdapter.SetImmutabilityPolicy(ctx, target, retainUntil)
+}
+
+func (s *MetricsStorage) SetLegalHold(ctx context.Context, target string, hold bool) (err error) {
+	defer s.track("set_legal_hold")(&err)
+	return s.StorageAdapter.SetLegalHold(ctx, target, hold)
+}
+
+func (s *MetricsStorage) ListRetentionRules(ctx context.Context) (rules []RetentionRule, err error) {
+	defer s.track("list_retention_rules")(&err)
+	return s.StorageAdapter.ListRetentionRules(ctx)
+}
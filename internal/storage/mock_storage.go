@@ -1,29 +1,119 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"sync"
+	"time"
 )
 
 type MockAzureStorage struct {
-	data map[string][]byte
-	mu   sync.RWMutex
+	data      map[string][]byte
+	info      map[string]FileInfo
+	version   int64
+	tags      *tagIndex
+	retention *retentionStore
+	mu        sync.RWMutex
 }
 
+var _ StorageAdapter = (*MockAzureStorage)(nil)
+
 func NewMockAzureStorage() *MockAzureStorage {
+	tags, _ := newTagIndex("")
+	retention := newRetentionStore(nil, nil)
 	return &MockAzureStorage{
-		data: make(map[string][]byte),
+		data:      make(map[string][]byte),
+		info:      make(map[string]FileInfo),
+		tags:      tags,
+		retention: retention,
 	}
 }
 
 func (s *MockAzureStorage) UploadFile(ctx context.Context, filePath string, data []byte) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.data[filePath] = data
+	if _, exists := s.data[filePath]; exists {
+		if err := s.retention.check(ctx, filePath); err != nil {
+			return err
+		}
+	}
+	s.put(filePath, data, nil)
+	return nil
+}
+
+func (s *MockAzureStorage) WriteFile(ctx context.Context, path string, content []byte, overwrite bool) error {
+	return s.WriteStream(ctx, path, bytes.NewReader(content), WriteOptions{Overwrite: overwrite})
+}
+
+func (s *MockAzureStorage) WriteStream(ctx context.Context, path string, r io.Reader, opts WriteOptions) error {
+	if err := ValidateTags(opts.Tags); err != nil {
+		return err
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read content: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.data[path]; exists {
+		if !opts.Overwrite {
+			return fmt.Errorf("file already exists and overwrite is disabled: %s", path)
+		}
+		if err := s.retention.check(ctx, path); err != nil {
+			return err
+		}
+	}
+	s.put(path, content, opts.Metadata)
+	return s.tags.set(path, opts.Tags)
+}
+
+func (s *MockAzureStorage) OpenFile(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	data, err := s.ReadFile(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *MockAzureStorage) Stat(ctx context.Context, filePath string) (*FileInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	info, exists := s.info[filePath]
+	if !exists {
+		return nil, fmt.Errorf("file not found: %s", filePath)
+	}
+	info.Metadata = copyMap(info.Metadata)
+	return &info, nil
+}
+
+func (s *MockAzureStorage) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, exists := s.info[filePath]
+	if !exists {
+		return fmt.Errorf("file not found: %s", filePath)
+	}
+	info.Metadata = copyMap(metadata)
+	s.info[filePath] = info
 	return nil
 }
 
+// put stores content with a fresh ETag; callers must hold the write lock.
+func (s *MockAzureStorage) put(path string, content []byte, metadata map[string]string) {
+	s.version++
+	s.data[path] = content
+	s.info[path] = FileInfo{
+		Path:     path,
+		Size:     int64(len(content)),
+		ETag:     fmt.Sprintf("\"%x\"", s.version),
+		ModTime:  time.Now(),
+		Metadata: copyMap(metadata),
+	}
+}
+
 func (s *MockAzureStorage) ReadFile(ctx context.Context, filePath string) ([]byte, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -40,16 +130,64 @@ func (s *MockAzureStorage) DeleteFile(ctx context.Context, filePath string) erro
 	if _, exists := s.data[filePath]; !exists {
 		return fmt.Errorf("file not found: %s", filePath)
 	}
+	if err := s.retention.check(ctx, filePath); err != nil {
+		return err
+	}
 	delete(s.data, filePath)
-	return nil
+	delete(s.info, filePath)
+	return s.tags.remove(filePath)
 }
 
 func (s *MockAzureStorage) ListFiles(ctx context.Context, dirPath string) ([]string, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	prefix := listPrefix(dirPath)
 	var files []string
 	for key := range s.data {
-		files = append(files, key)
+		if listed(key, prefix) {
+			files = append(files, key)
+		}
 	}
 	return files, nil
 }
+
+func (s *MockAzureStorage) SetTags(ctx context.Context, filePath string, tags map[string]string) error {
+	if err := ValidateTags(tags); err != nil {
+		return err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, exists := s.data[filePath]; !exists {
+		return fmt.Errorf("file not found: %s", filePath)
+	}
+	return s.tags.set(filePath, tags)
+}
+
+func (s *MockAzureStorage) GetTags(ctx context.Context, filePath string) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, exists := s.data[filePath]; !exists {
+		return nil, fmt.Errorf("file not found: %s", filePath)
+	}
+	tags := s.tags.get(filePath)
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	return tags, nil
+}
+
+func (s *MockAzureStorage) FindFilesByTags(ctx context.Context, query TagQuery) (*TagSearchResult, error) {
+	return s.tags.find(query), nil
+}
+
+func (s *MockAzureStorage) SetImmutabilityPolicy(ctx context.Context, target string, retainUntil time.Time) error {
+	return s.retention.setPolicy(ctx, target, retainUntil, nil)
+}
+
+func (s *MockAzureStorage) SetLegalHold(ctx context.Context, target string, hold bool) error {
+	return s.retention.setLegalHold(ctx, target, hold, nil)
+}
+
+func (s *MockAzureStorage) ListRetentionRules(ctx context.Context) ([]RetentionRule, error) {
+	return s.retention.list(ctx)
+}
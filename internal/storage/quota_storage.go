@@ -0,0 +1,507 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetaOwner is the metadata key recording which user wrote a file.
+const MetaOwner = "owner"
+
+// AnonymousUser owns files written without a user in the context.
+const AnonymousUser = "anonymous"
+
+// Quota scope kinds.
+const (
+	QuotaScopeUser   = "user"
+	QuotaScopePrefix = "prefix"
+)
+
+// ErrQuotaExceeded is returned when a write would exceed a user or prefix quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaLimit bounds what a scope may store. Zero fields are unlimited.
+type QuotaLimit struct {
+	MaxBytes   int64 `json:"maxBytes,omitempty"`
+	MaxObjects int64 `json:"maxObjects,omitempty"`
+}
+
+// QuotaConfig controls QuotaStorage.
+type QuotaConfig struct {
+	// DefaultUser applies to users without an entry in Users.
+	DefaultUser QuotaLimit
+	Users       map[string]QuotaLimit
+	// Prefixes limit everything stored under a path prefix, whoever wrote it.
+	Prefixes map[string]QuotaLimit
+}
+
+// Usage is what a scope currently stores.
+type Usage struct {
+	Bytes   int64 `json:"bytes"`
+	Objects int64 `json:"objects"`
+}
+
+// ScopeUsage pairs a scope's usage with its limit.
+type ScopeUsage struct {
+	Usage
+	Limit QuotaLimit `json:"limit"`
+}
+
+// UsageReport lists consumption per user and per configured prefix.
+type UsageReport struct {
+	Users    map[string]ScopeUsage `json:"users"`
+	Prefixes map[string]ScopeUsage `json:"prefixes"`
+}
+
+// QuotaError describes which quota a write would exceed.
+type QuotaError struct {
+	Path     string
+	Scope    string // QuotaScopeUser or QuotaScopePrefix
+	Name     string // User ID or prefix
+	Resource string // "bytes" or "objects"
+	Limit    int64
+	Used     int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%v: writing %s would exceed the %s %q limit of %d %s (%d used)",
+		ErrQuotaExceeded, e.Path, e.Scope, e.Name, e.Limit, e.Resource, e.Used)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+type userContextKey struct{}
+
+// WithUser attributes storage operations made with ctx to userID.
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userContextKey{}, userID)
+}
+
+// UserFromContext returns the user set with WithUser, or "" when there is none.
+func UserFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userContextKey{}).(string)
+	return userID
+}
+
+// quotaFile is the size and owner of a stored file.
+type quotaFile struct {
+	Size  int64  `json:"size"`
+	Owner string `json:"owner"`
+}
+
+type quotaScope struct {
+	kind, name string
+}
+
+// quotaReservation tracks what an in-flight write has claimed.
+type quotaReservation struct {
+	path   string
+	scopes []quotaScope
+	// credit is the usage the overwritten file frees in each scope.
+	credit   map[quotaScope]Usage
+	reserved Usage
+}
+
+// QuotaStorage is a StorageAdapter decorator that enforces byte and object-count
+// limits per user and per path prefix. Usage is computed by scanning file sizes and
+// owners on first use, kept up to date in memory as this instance writes and deletes
+// files, and recomputed by Rebuild or Watch to pick up changes made by other instances.
+// Writes reserve quota as they stream, so concurrent uploads cannot jointly overshoot.
+type QuotaStorage struct {
+	StorageAdapter
+	config QuotaConfig
+
+	scanMu  sync.Mutex
+	files   map[string]quotaFile
+	used    map[quotaScope]*Usage
+	pending map[quotaScope]*Usage
+	// changed records files written or deleted (nil) while a scan runs, since the scan
+	// may have listed the backend before them.
+	changed map[string]*quotaFile
+	mu      sync.Mutex
+}
+
+var _ StorageAdapter = (*QuotaStorage)(nil)
+
+// NewQuotaStorage wraps inner with quota enforcement.
+func NewQuotaStorage(inner StorageAdapter, config QuotaConfig) *QuotaStorage {
+	return &QuotaStorage{
+		StorageAdapter: inner,
+		config:         config,
+		pending:        make(map[quotaScope]*Usage),
+	}
+}
+
+// UploadFile writes a new file within quota.
+func (s *QuotaStorage) UploadFile(ctx context.Context, filePath string, data []byte) error {
+	return s.WriteFile(ctx, filePath, data, false)
+}
+
+// WriteFile writes a file within quota.
+func (s *QuotaStorage) WriteFile(ctx context.Context, path string, content []byte, overwrite bool) error {
+	return s.WriteStream(ctx, path, bytes.NewReader(content), WriteOptions{Overwrite: overwrite})
+}
+
+// WriteStream writes r, failing with a *QuotaError as soon as the content would
+// exceed a quota. The file is attributed to the user in ctx.
+func (s *QuotaStorage) WriteStream(ctx context.Context, path string, r io.Reader, opts WriteOptions) error {
+	if err := s.load(ctx); err != nil {
+		return err
+	}
+	owner := UserFromContext(ctx)
+	if owner == "" {
+		owner = AnonymousUser
+	}
+
+	res, err := s.reserveObject(quotaKey(path), owner)
+	if err != nil {
+		return err
+	}
+	defer s.release(res)
+
+	metadata := copyMap(opts.Metadata)
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	metadata[MetaOwner] = owner
+
+	qr := &quotaReader{r: r, storage: s, res: res}
+	err = s.StorageAdapter.WriteStream(ctx, path, qr, WriteOptions{Overwrite: opts.Overwrite, Metadata: metadata, Tags: opts.Tags})
+	if qr.err != nil {
+		return qr.err
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setFile(res.path, &quotaFile{Size: qr.size, Owner: owner})
+	return nil
+}
+
+// SetMetadata replaces user metadata while keeping the owner.
+func (s *QuotaStorage) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	info, err := s.StorageAdapter.Stat(ctx, filePath)
+	if err != nil {
+		return err
+	}
+
+	merged := copyMap(metadata)
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	if owner, ok := info.Metadata[MetaOwner]; ok {
+		merged[MetaOwner] = owner
+	}
+	return s.StorageAdapter.SetMetadata(ctx, filePath, merged)
+}
+
+// DeleteFile deletes a file or directory and releases its usage.
+func (s *QuotaStorage) DeleteFile(ctx context.Context, filePath string) error {
+	if err := s.load(ctx); err != nil {
+		return err
+	}
+	if err := s.StorageAdapter.DeleteFile(ctx, filePath); err != nil {
+		return err
+	}
+
+	key := quotaKey(filePath)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for path := range s.files {
+		if path == key || strings.HasPrefix(path, key+"/") {
+			s.setFile(path, nil)
+		}
+	}
+	return nil
+}
+
+// Usage reports consumption for every user with stored files and every configured prefix.
+func (s *QuotaStorage) Usage(ctx context.Context) (*UsageReport, error) {
+	if err := s.load(ctx); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := &UsageReport{Users: map[string]ScopeUsage{}, Prefixes: map[string]ScopeUsage{}}
+	for prefix := range s.config.Prefixes {
+		report.Prefixes[prefix] = ScopeUsage{Limit: s.limit(quotaScope{QuotaScopePrefix, prefix})}
+	}
+	for scope, usage := range s.used {
+		entry := ScopeUsage{Usage: *usage, Limit: s.limit(scope)}
+		if scope.kind == QuotaScopeUser {
+			report.Users[scope.name] = entry
+		} else {
+			report.Prefixes[scope.name] = entry
+		}
+	}
+	return report, nil
+}
+
+// Rebuild recomputes usage by scanning every file in the wrapped backend. Writes
+// continue during the scan and are applied on top of its result.
+func (s *QuotaStorage) Rebuild(ctx context.Context) error {
+	return s.rebuild(ctx, true)
+}
+
+// Watch rebuilds usage every interval until ctx is done, so quotas account for files
+// written and deleted through other instances.
+func (s *QuotaStorage) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.Rebuild(ctx); err != nil {
+			slog.ErrorContext(ctx, "Failed to rebuild quota usage", "error", err)
+		}
+	}
+}
+
+// reserveObject checks the object-count limits for a write to path and claims
+// one object in every scope the file is new to.
+func (s *QuotaStorage) reserveObject(path, owner string) (*quotaReservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := &quotaReservation{path: path, scopes: s.scopes(path, owner), credit: map[quotaScope]Usage{}}
+	if previous, ok := s.files[path]; ok {
+		for _, scope := range s.scopes(path, previous.Owner) {
+			res.credit[scope] = Usage{Bytes: previous.Size, Objects: 1}
+		}
+	}
+
+	for _, scope := range res.scopes {
+		limit := s.limit(scope)
+		used := s.usage(s.used, scope).Objects - res.credit[scope].Objects
+		if limit.MaxObjects > 0 && used+s.usage(s.pending, scope).Objects+1 > limit.MaxObjects {
+			return nil, &QuotaError{Path: path, Scope: scope.kind, Name: scope.name, Resource: "objects",
+				Limit: limit.MaxObjects, Used: s.usage(s.used, scope).Objects}
+		}
+	}
+	for _, scope := range res.scopes {
+		s.usage(s.pending, scope).Objects++
+	}
+	res.reserved.Objects = 1
+	return res, nil
+}
+
+// reserveBytes claims n more bytes for an in-flight write.
+func (s *QuotaStorage) reserveBytes(res *quotaReservation, n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, scope := range res.scopes {
+		limit := s.limit(scope)
+		used := s.usage(s.used, scope).Bytes - res.credit[scope].Bytes
+		if limit.MaxBytes > 0 && used+s.usage(s.pending, scope).Bytes+n > limit.MaxBytes {
+			return &QuotaError{Path: res.path, Scope: scope.kind, Name: scope.name, Resource: "bytes",
+				Limit: limit.MaxBytes, Used: s.usage(s.used, scope).Bytes}
+		}
+	}
+	for _, scope := range res.scopes {
+		s.usage(s.pending, scope).Bytes += n
+	}
+	res.reserved.Bytes += n
+	return nil
+}
+
+// release returns a write's reservation once it has been committed or abandoned.
+func (s *QuotaStorage) release(res *quotaReservation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, scope := range res.scopes {
+		pending := s.usage(s.pending, scope)
+		pending.Bytes -= res.reserved.Bytes
+		pending.Objects -= res.reserved.Objects
+		if *pending == (Usage{}) {
+			delete(s.pending, scope)
+		}
+	}
+}
+
+// account adds (sign 1) or removes (sign -1) a manifest entry from the per-scope
+// totals; callers must hold mu.
+func (s *QuotaStorage) account(path string, sign int64) {
+	file, ok := s.files[path]
+	if !ok {
+		return
+	}
+	for _, scope := range s.scopes(path, file.Owner) {
+		usage := s.usage(s.used, scope)
+		usage.Bytes += sign * file.Size
+		usage.Objects += sign
+		if *usage == (Usage{}) {
+			delete(s.used, scope)
+		}
+	}
+}
+
+// usage returns the counter for scope in m, creating it if needed; callers must hold mu.
+func (s *QuotaStorage) usage(m map[quotaScope]*Usage, scope quotaScope) *Usage {
+	if m[scope] == nil {
+		m[scope] = &Usage{}
+	}
+	return m[scope]
+}
+
+// scopes lists the quota scopes a file at path owned by owner counts against.
+func (s *QuotaStorage) scopes(path, owner string) []quotaScope {
+	scopes := []quotaScope{{QuotaScopeUser, owner}}
+	for prefix := range s.config.Prefixes {
+		if strings.HasPrefix(path, quotaKey(prefix)+"/") {
+			scopes = append(scopes, quotaScope{QuotaScopePrefix, prefix})
+		}
+	}
+	sort.Slice(scopes[1:], func(i, j int) bool { return scopes[i+1].name < scopes[j+1].name })
+	return scopes
+}
+
+func (s *QuotaStorage) limit(scope quotaScope) QuotaLimit {
+	if scope.kind == QuotaScopePrefix {
+		return s.config.Prefixes[scope.name]
+	}
+	if limit, ok := s.config.Users[scope.name]; ok {
+		return limit
+	}
+	return s.config.DefaultUser
+}
+
+// setFile records that path was written (or deleted, with nil); callers must hold mu.
+func (s *QuotaStorage) setFile(path string, file *quotaFile) {
+	s.account(path, -1)
+	if file == nil {
+		delete(s.files, path)
+	} else {
+		s.files[path] = *file
+		s.account(path, 1)
+	}
+	if s.changed != nil {
+		s.changed[path] = file
+	}
+}
+
+// setFiles replaces the known files and recomputes totals; callers must hold mu.
+func (s *QuotaStorage) setFiles(files map[string]quotaFile) {
+	s.files = files
+	s.used = make(map[quotaScope]*Usage)
+	for path := range files {
+		s.account(path, 1)
+	}
+}
+
+// scan reads sizes and owners from the wrapped backend.
+func (s *QuotaStorage) scan(ctx context.Context) (map[string]quotaFile, error) {
+	paths, err := s.StorageAdapter.ListFiles(ctx, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]quotaFile, len(paths))
+	for _, path := range paths {
+		info, err := s.StorageAdapter.Stat(ctx, path)
+		if err != nil {
+			continue // Deleted since listing.
+		}
+		owner := info.Metadata[MetaOwner]
+		if owner == "" {
+			owner = AnonymousUser
+		}
+		files[quotaKey(path)] = quotaFile{Size: info.Size, Owner: owner}
+	}
+	return files, nil
+}
+
+// load computes usage on first use. A failed scan is retried by the next call.
+func (s *QuotaStorage) load(ctx context.Context) error {
+	s.mu.Lock()
+	loaded := s.files != nil
+	s.mu.Unlock()
+	if loaded {
+		return nil
+	}
+	return s.rebuild(ctx, false)
+}
+
+// rebuild scans the backend and replaces usage with the result, unless usage is already
+// loaded and force is false.
+func (s *QuotaStorage) rebuild(ctx context.Context, force bool) error {
+	s.scanMu.Lock()
+	defer s.scanMu.Unlock()
+
+	s.mu.Lock()
+	if s.files != nil && !force {
+		s.mu.Unlock()
+		return nil
+	}
+	s.changed = map[string]*quotaFile{}
+	s.mu.Unlock()
+
+	files, err := s.scan(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := s.changed
+	s.changed = nil
+	if err != nil {
+		return fmt.Errorf("failed to compute usage: %v", err)
+	}
+	for path, file := range changed {
+		if file == nil {
+			delete(files, path)
+		} else {
+			files[path] = *file
+		}
+	}
+	s.setFiles(files)
+	return nil
+}
+
+// quotaReader reserves quota for content as it is read.
+type quotaReader struct {
+	r       io.Reader
+	storage *QuotaStorage
+	res     *quotaReservation
+	size    int64
+	err     error
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	n, err := q.r.Read(p)
+	if n > 0 {
+		if qerr := q.storage.reserveBytes(q.res, int64(n)); qerr != nil {
+			q.err = qerr
+			return 0, qerr
+		}
+		q.size += int64(n)
+	}
+	return n, err
+}
+
+// quotaKey normalizes a path for usage accounting.
+func quotaKey(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
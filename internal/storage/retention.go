@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrImmutable is returned when a write or delete targets WORM-protected data.
+var ErrImmutable = errors.New("file is immutable")
+
+// RetentionRule protects a single file or, when Target ends in "/", every file under a prefix.
+type RetentionRule struct {
+	Target      string    `json:"target"`
+	RetainUntil time.Time `json:"retainUntil,omitempty"`
+	LegalHold   bool      `json:"legalHold"`
+}
+
+// Active reports whether the rule currently blocks modification.
+func (r RetentionRule) Active(now time.Time) bool {
+	return r.LegalHold || now.Before(r.RetainUntil)
+}
+
+// Covers reports whether the rule applies to path.
+func (r RetentionRule) Covers(path string) bool {
+	if strings.HasSuffix(r.Target, "/") {
+		return strings.HasPrefix(path, r.Target)
+	}
+	return path == r.Target
+}
+
+// ImmutableError describes which rule blocked an operation.
+type ImmutableError struct {
+	Path string
+	Rule RetentionRule
+}
+
+func (e *ImmutableError) Error() string {
+	if e.Rule.LegalHold {
+		return fmt.Sprintf("%v: %s is under legal hold (rule %q)", ErrImmutable, e.Path, e.Rule.Target)
+	}
+	return fmt.Sprintf("%v: %s is retained until %s (rule %q)",
+		ErrImmutable, e.Path, e.Rule.RetainUntil.UTC().Format(time.RFC3339), e.Rule.Target)
+}
+
+func (e *ImmutableError) Unwrap() error {
+	return ErrImmutable
+}
+
+// Errors reported by retention rule sources.
+var (
+	errRulesNotModified = errors.New("retention rules not modified")
+	errRulesConflict    = errors.New("retention rules were changed concurrently")
+)
+
+// maxRuleUpdateAttempts bounds how often an update is retried after losing a race with
+// another instance.
+const maxRuleUpdateAttempts = 5
+
+// retentionStore keeps retention rules and decides whether a path may be modified. Rules are
+// re-read before each decision and saved only if nobody changed them in between, so every
+// server and worker sharing the backend sees the same rules. load and save may be nil for an
+// in-memory store.
+type retentionStore struct {
+	// load returns the persisted rules and their version, or errRulesNotModified if they still
+	// have version. Missing rules have the version "".
+	load func(ctx context.Context, version string) ([]byte, string, error)
+	// save persists the rules if they still have version and returns the new version, or
+	// errRulesConflict.
+	save func(ctx context.Context, data []byte, version string) (string, error)
+
+	mu      sync.Mutex
+	rules   map[string]RetentionRule
+	version string
+}
+
+func newRetentionStore(
+	load func(ctx context.Context, version string) ([]byte, string, error),
+	save func(ctx context.Context, data []byte, version string) (string, error),
+) *retentionStore {
+	return &retentionStore{load: load, save: save, rules: make(map[string]RetentionRule)}
+}
+
+// fileRetentionStore persists rules as JSON in a local file, versioned by its size and
+// modification time.
+func fileRetentionStore(file string) *retentionStore {
+	stat := func() (string, error) {
+		info, err := os.Stat(file)
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size()), nil
+	}
+	load := func(_ context.Context, version string) ([]byte, string, error) {
+		current, err := stat()
+		if err != nil || current == "" {
+			return nil, "", err
+		}
+		if current == version {
+			return nil, version, errRulesNotModified
+		}
+		data, err := os.ReadFile(file)
+		return data, current, err
+	}
+	save := func(_ context.Context, data []byte, version string) (string, error) {
+		if current, err := stat(); err != nil {
+			return "", err
+		} else if current != version {
+			return "", errRulesConflict
+		}
+		if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+			return "", err
+		}
+		tmp := file + ".tmp"
+		if err := os.WriteFile(tmp, data, 0644); err != nil {
+			return "", err
+		}
+		if err := os.Rename(tmp, file); err != nil {
+			return "", err
+		}
+		return stat()
+	}
+	return newRetentionStore(load, save)
+}
+
+// setPolicy applies a time-based policy. Active policies can be extended but never shortened.
+// apply, if set, runs once the change is validated and before it is saved; its error aborts
+// the update.
+func (s *retentionStore) setPolicy(ctx context.Context, target string, retainUntil time.Time, apply func() error) error {
+	if target == "" {
+		return fmt.Errorf("retention target is required")
+	}
+	now := time.Now()
+	if !retainUntil.After(now) {
+		return fmt.Errorf("retainUntil must be in the future")
+	}
+
+	return s.update(ctx, func(rules map[string]RetentionRule) error {
+		rule := rules[target]
+		if now.Before(rule.RetainUntil) && retainUntil.Before(rule.RetainUntil) {
+			return fmt.Errorf("%w: cannot shorten retention for %q (currently until %s)",
+				ErrImmutable, target, rule.RetainUntil.UTC().Format(time.RFC3339))
+		}
+		rule.Target = target
+		rule.RetainUntil = retainUntil.UTC()
+		rules[target] = rule
+		return applyRule(apply)
+	})
+}
+
+// setLegalHold places or clears a legal hold. apply works as for setPolicy.
+func (s *retentionStore) setLegalHold(ctx context.Context, target string, hold bool, apply func() error) error {
+	if target == "" {
+		return fmt.Errorf("retention target is required")
+	}
+
+	return s.update(ctx, func(rules map[string]RetentionRule) error {
+		rule := rules[target]
+		rule.Target = target
+		rule.LegalHold = hold
+		if rule.Active(time.Now()) {
+			rules[target] = rule
+		} else {
+			delete(rules, target)
+		}
+		return applyRule(apply)
+	})
+}
+
+// applyRule runs apply if it is set.
+func applyRule(apply func() error) error {
+	if apply == nil {
+		return nil
+	}
+	return apply()
+}
+
+// list returns the active rules ordered by target.
+func (s *retentionStore) list(ctx context.Context) ([]RetentionRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return activeRules(s.rules, time.Now()), nil
+}
+
+// check returns an *ImmutableError if an active rule covers path.
+func (s *retentionStore) check(ctx context.Context, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(ctx); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, rule := range s.rules {
+		if rule.Active(now) && rule.Covers(path) {
+			return &ImmutableError{Path: path, Rule: rule}
+		}
+	}
+	return nil
+}
+
+// refresh re-reads the persisted rules if they changed; callers must hold the lock. A failed
+// read is reported to the caller and retried on the next call.
+func (s *retentionStore) refresh(ctx context.Context) error {
+	if s.load == nil {
+		return nil
+	}
+	data, version, err := s.load(ctx, s.version)
+	if errors.Is(err, errRulesNotModified) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load retention rules: %v", err)
+	}
+
+	rules := make(map[string]RetentionRule)
+	if len(data) > 0 {
+		var list []RetentionRule
+		if err := json.Unmarshal(data, &list); err != nil {
+			return fmt.Errorf("failed to parse retention rules: %v", err)
+		}
+		for _, rule := range list {
+			rules[rule.Target] = rule
+		}
+	}
+	s.rules, s.version = rules, version
+	return nil
+}
+
+// update applies change to the latest rules and saves them, starting over if another
+// instance saved rules in between.
+func (s *retentionStore) update(ctx context.Context, change func(rules map[string]RetentionRule) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for attempt := 0; attempt < maxRuleUpdateAttempts; attempt++ {
+		if err := s.refresh(ctx); err != nil {
+			return err
+		}
+		rules := make(map[string]RetentionRule, len(s.rules))
+		for target, rule := range s.rules {
+			rules[target] = rule
+		}
+		if err := change(rules); err != nil {
+			return err
+		}
+
+		// Expired rules are dropped whenever the rules are saved.
+		active := activeRules(rules, time.Now())
+		if s.save == nil {
+			s.rules = rulesByTarget(active)
+			return nil
+		}
+		data, err := json.Marshal(active)
+		if err != nil {
+			return fmt.Errorf("failed to serialize retention rules: %v", err)
+		}
+		version, err := s.save(ctx, data, s.version)
+		if errors.Is(err, errRulesConflict) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save retention rules: %v", err)
+		}
+		s.rules, s.version = rulesByTarget(active), version
+		return nil
+	}
+	return fmt.Errorf("failed to save retention rules: %w", errRulesConflict)
+}
+
+// activeRules returns the rules active at now, ordered by target.
+func activeRules(rules map[string]RetentionRule, now time.Time) []RetentionRule {
+	active := make([]RetentionRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Active(now) {
+			active = append(active, rule)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].Target < active[j].Target })
+	return active
+}
+
+func rulesByTarget(list []RetentionRule) map[string]RetentionRule {
+	rules := make(map[string]RetentionRule, len(list))
+	for _, rule := range list {
+		rules[rule.Target] = rule
+	}
+	return rules
+}
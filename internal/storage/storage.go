@@ -1,6 +1,12 @@
 package storage
 
-import "context"
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
 
 // StorageAdapter defines an interface for storage operations.
 type StorageAdapter interface {
@@ -9,4 +15,71 @@ type StorageAdapter interface {
 	ReadFile(ctx context.Context, filePath string) ([]byte, error)
 	DeleteFile(ctx context.Context, filePath string) error
 	ListFiles(ctx context.Context, dirPath string) ([]string, error)
+
+	// Streaming and object metadata
+	WriteStream(ctx context.Context, path string, r io.Reader, opts WriteOptions) error
+	OpenFile(ctx context.Context, filePath string) (io.ReadCloser, error)
+	Stat(ctx context.Context, filePath string) (*FileInfo, error)
+	SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error
+
+	// Blob index tags
+	SetTags(ctx context.Context, filePath string, tags map[string]string) error
+	GetTags(ctx context.Context, filePath string) (map[string]string, error)
+	FindFilesByTags(ctx context.Context, query TagQuery) (*TagSearchResult, error)
+
+	// Immutability (WORM) and legal hold
+	SetImmutabilityPolicy(ctx context.Context, target string, retainUntil time.Time) error
+	SetLegalHold(ctx context.Context, target string, hold bool) error
+	ListRetentionRules(ctx context.Context) ([]RetentionRule, error)
+}
+
+// HealthChecker is implemented by backends that can verify they are reachable and usable.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// CheckHealth probes adapter with its HealthCheck, or by listing its root when it has none.
+func CheckHealth(ctx context.Context, adapter StorageAdapter) error {
+	if checker, ok := adapter.(HealthChecker); ok {
+		return checker.HealthCheck(ctx)
+	}
+	_, err := adapter.ListFiles(ctx, ".")
+	return err
+}
+
+// WriteOptions controls WriteStream. Metadata replaces any metadata already on the file.
+// Metadata keys should be lowercase letters, digits and underscores so every backend accepts them.
+type WriteOptions struct {
+	Overwrite bool
+	Metadata  map[string]string
+	// Tags become the file's index tags in the same write; an overwrite without tags
+	// clears the previous file's tags.
+	Tags map[string]string
+}
+
+// FileInfo describes a stored file.
+type FileInfo struct {
+	Path     string            `json:"path"`
+	Size     int64             `json:"size"`
+	ETag     string            `json:"etag"`
+	ModTime  time.Time         `json:"modTime"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// listPrefix converts a ListFiles directory into a key prefix; "" and "." list everything.
+func listPrefix(dirPath string) string {
+	prefix := strings.TrimPrefix(path.Clean("/"+dirPath), "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// listed reports whether key belongs in a listing of prefix. Bookkeeping files under
+// the index directory only appear when that directory is listed explicitly.
+func listed(key, prefix string) bool {
+	if !strings.HasPrefix(key, prefix) {
+		return false
+	}
+	return strings.HasPrefix(prefix, indexDirName+"/") || !strings.HasPrefix(key, indexDirName+"/")
 }
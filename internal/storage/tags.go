@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Limits mirror the Azure blob index tag rules so every backend accepts the same tags.
+const (
+	MaxTagsPerFile     = 10
+	maxTagKeyLength    = 128
+	maxTagValueLength  = 256
+	DefaultTagPageSize = 100
+)
+
+// TagQuery selects files whose tags match every key/value pair in Tags and,
+// when Prefix is set, whose path starts with Prefix.
+type TagQuery struct {
+	Tags       map[string]string
+	Prefix     string
+	Marker     string
+	MaxResults int
+}
+
+// TaggedFile is a single match of a tag search.
+type TaggedFile struct {
+	Path string            `json:"path"`
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// TagSearchResult is one page of tag search results.
+type TagSearchResult struct {
+	Files      []TaggedFile `json:"files"`
+	NextMarker string       `json:"nextMarker,omitempty"`
+}
+
+// ValidateTags checks tags against the blob index tag rules.
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > MaxTagsPerFile {
+		return fmt.Errorf("too many tags: %d (max %d)", len(tags), MaxTagsPerFile)
+	}
+	for key, value := range tags {
+		if len(key) == 0 || len(key) > maxTagKeyLength {
+			return fmt.Errorf("invalid tag key length: %q", key)
+		}
+		if len(value) > maxTagValueLength {
+			return fmt.Errorf("tag value too long for key %q", key)
+		}
+		if !validTagChars(key) || !validTagChars(value) {
+			return fmt.Errorf("tag %q contains unsupported characters", key)
+		}
+	}
+	return nil
+}
+
+// validTagChars allows alphanumerics, space, and + - . / : = _
+func validTagChars(s string) bool {
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == ' ', r == '+', r == '-', r == '.', r == '/', r == ':', r == '=', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// tagIndex is an embedded tag index used by backends without native tag search.
+// When file is empty the index only lives in memory.
+type tagIndex struct {
+	file    string
+	entries map[string]map[string]string
+	mu      sync.RWMutex
+}
+
+func newTagIndex(file string) (*tagIndex, error) {
+	idx := &tagIndex{file: file, entries: make(map[string]map[string]string)}
+	if file == "" {
+		return idx, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tag index: %v", err)
+	}
+	if err := json.Unmarshal(data, &idx.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse tag index: %v", err)
+	}
+	return idx, nil
+}
+
+func (idx *tagIndex) set(path string, tags map[string]string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if len(tags) == 0 {
+		if _, exists := idx.entries[path]; !exists {
+			return nil
+		}
+		delete(idx.entries, path)
+	} else {
+		idx.entries[path] = copyMap(tags)
+	}
+	return idx.persist()
+}
+
+func (idx *tagIndex) get(path string) map[string]string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return copyMap(idx.entries[path])
+}
+
+func (idx *tagIndex) remove(path string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if _, exists := idx.entries[path]; !exists {
+		return nil
+	}
+	delete(idx.entries, path)
+	return idx.persist()
+}
+
+// find returns matches in path order; the marker is the last path of the previous page.
+func (idx *tagIndex) find(query TagQuery) *TagSearchResult {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	paths := make([]string, 0, len(idx.entries))
+	for path, tags := range idx.entries {
+		if path > query.Marker && strings.HasPrefix(path, query.Prefix) && matchesTags(tags, query.Tags) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	limit := query.MaxResults
+	if limit <= 0 {
+		limit = DefaultTagPageSize
+	}
+
+	result := &TagSearchResult{Files: []TaggedFile{}}
+	for i, path := range paths {
+		if i == limit {
+			result.NextMarker = paths[i-1]
+			break
+		}
+		result.Files = append(result.Files, TaggedFile{Path: path, Tags: copyMap(idx.entries[path])})
+	}
+	return result
+}
+
+// persist writes the index to disk; callers must hold the write lock.
+func (idx *tagIndex) persist() error {
+	if idx.file == "" {
+		return nil
+	}
+	data, err := json.Marshal(idx.entries)
+	if err != nil {
+		return fmt.Errorf("failed to serialize tag index: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(idx.file), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create index directory: %v", err)
+	}
+	tmp := idx.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write tag index: %v", err)
+	}
+	return os.Rename(tmp, idx.file)
+}
+
+func matchesTags(tags, filter map[string]string) bool {
+	for key, value := range filter {
+		if v, ok := tags[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
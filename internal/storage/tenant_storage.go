@@ -0,0 +1,373 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoTenant is returned by TenantStorage when the context carries no tenant.
+var ErrNoTenant = errors.New("no tenant in request context")
+
+type tenantContextKey struct{}
+
+// WithTenant scopes storage operations made with ctx to tenantID.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant set with WithTenant, or "" when there is none.
+func TenantFromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenantID
+}
+
+// ValidateTenantID accepts 1-63 lowercase letters, digits and hyphens, starting with a
+// letter or digit, so every tenant ID is also a valid path segment and container name part.
+func ValidateTenantID(tenantID string) error {
+	if len(tenantID) == 0 || len(tenantID) > 63 || tenantID[0] == '-' {
+		return fmt.Errorf("invalid tenant ID %q", tenantID)
+	}
+	for _, r := range tenantID {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return fmt.Errorf("invalid tenant ID %q", tenantID)
+		}
+	}
+	return nil
+}
+
+// PrefixStorage confines a StorageAdapter to the namespace under prefix. Paths are
+// cleaned before the prefix is added, so "..", absolute paths and the like cannot
+// escape it, and listings, tag searches and retention rules only ever return entries
+// inside it, relative to it.
+type PrefixStorage struct {
+	inner  StorageAdapter
+	prefix string
+}
+
+var _ StorageAdapter = (*PrefixStorage)(nil)
+
+// NewPrefixStorage confines inner to prefix.
+func NewPrefixStorage(inner StorageAdapter, prefix string) *PrefixStorage {
+	return &PrefixStorage{inner: inner, prefix: strings.Trim(path.Clean("/"+prefix), "/")}
+}
+
+func (s *PrefixStorage) UploadFile(ctx context.Context, filePath string, data []byte) error {
+	return s.inner.UploadFile(ctx, s.full(filePath), data)
+}
+
+func (s *PrefixStorage) WriteFile(ctx context.Context, path string, content []byte, overwrite bool) error {
+	return s.inner.WriteFile(ctx, s.full(path), content, overwrite)
+}
+
+func (s *PrefixStorage) ReadFile(ctx context.Context, filePath string) ([]byte, error) {
+	return s.inner.ReadFile(ctx, s.full(filePath))
+}
+
+// DeleteFile deletes a file or directory inside the namespace, but never the namespace itself.
+func (s *PrefixStorage) DeleteFile(ctx context.Context, filePath string) error {
+	full := s.full(filePath)
+	if full == s.prefix {
+		return fmt.Errorf("cannot delete the namespace root")
+	}
+	return s.inner.DeleteFile(ctx, full)
+}
+
+func (s *PrefixStorage) ListFiles(ctx context.Context, dirPath string) ([]string, error) {
+	files, err := s.inner.ListFiles(ctx, s.full(dirPath))
+	if err != nil {
+		return nil, err
+	}
+
+	relative := make([]string, 0, len(files))
+	for _, file := range files {
+		if rel, ok := s.relative(file); ok {
+			relative = append(relative, rel)
+		}
+	}
+	return relative, nil
+}
+
+func (s *PrefixStorage) WriteStream(ctx context.Context, path string, r io.Reader, opts WriteOptions) error {
+	return s.inner.WriteStream(ctx, s.full(path), r, opts)
+}
+
+func (s *PrefixStorage) OpenFile(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	return s.inner.OpenFile(ctx, s.full(filePath))
+}
+
+func (s *PrefixStorage) Stat(ctx context.Context, filePath string) (*FileInfo, error) {
+	info, err := s.inner.Stat(ctx, s.full(filePath))
+	if err != nil {
+		return nil, err
+	}
+	if rel, ok := s.relative(info.Path); ok {
+		info.Path = rel
+	}
+	return info, nil
+}
+
+func (s *PrefixStorage) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	return s.inner.SetMetadata(ctx, s.full(filePath), metadata)
+}
+
+func (s *PrefixStorage) SetTags(ctx context.Context, filePath string, tags map[string]string) error {
+	return s.inner.SetTags(ctx, s.full(filePath), tags)
+}
+
+func (s *PrefixStorage) GetTags(ctx context.Context, filePath string) (map[string]string, error) {
+	return s.inner.GetTags(ctx, s.full(filePath))
+}
+
+// FindFilesByTags searches only inside the namespace.
+func (s *PrefixStorage) FindFilesByTags(ctx context.Context, query TagQuery) (*TagSearchResult, error) {
+	query.Prefix = s.full(query.Prefix) + "/"
+	result, err := s.inner.FindFilesByTags(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]TaggedFile, 0, len(result.Files))
+	for _, file := range result.Files {
+		if rel, ok := s.relative(file.Path); ok {
+			file.Path = rel
+			files = append(files, file)
+		}
+	}
+	result.Files = files
+	return result, nil
+}
+
+func (s *PrefixStorage) SetImmutabilityPolicy(ctx context.Context, target string, retainUntil time.Time) error {
+	return s.inner.SetImmutabilityPolicy(ctx, s.fullTarget(target), retainUntil)
+}
+
+func (s *PrefixStorage) SetLegalHold(ctx context.Context, target string, hold bool) error {
+	return s.inner.SetLegalHold(ctx, s.fullTarget(target), hold)
+}
+
+// ListRetentionRules lists the rules targeting files or prefixes inside the namespace.
+func (s *PrefixStorage) ListRetentionRules(ctx context.Context) ([]RetentionRule, error) {
+	rules, err := s.inner.ListRetentionRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	relative := []RetentionRule{}
+	for _, rule := range rules {
+		if rel, ok := strings.CutPrefix(rule.Target, s.prefix+"/"); ok {
+			rule.Target = rel
+			relative = append(relative, rule)
+		}
+	}
+	return relative, nil
+}
+
+// full maps a namespace path to the wrapped adapter's path.
+func (s *PrefixStorage) full(p string) string {
+	rel := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if rel == "" {
+		return s.prefix
+	}
+	return s.prefix + "/" + rel
+}
+
+// fullTarget maps a retention target, keeping the trailing "/" of prefix targets.
+func (s *PrefixStorage) fullTarget(target string) string {
+	if strings.HasSuffix(target, "/") || target == "" {
+		return s.full(target) + "/"
+	}
+	return s.full(target)
+}
+
+// relative maps a wrapped adapter's path back into the namespace.
+func (s *PrefixStorage) relative(p string) (string, bool) {
+	p = strings.TrimPrefix(filepath.ToSlash(p), "./")
+	return strings.CutPrefix(p, s.prefix+"/")
+}
+
+// TenantStorage routes every operation to the namespace of the tenant in the request
+// context: a dedicated adapter (e.g. its own container) when one is configured, otherwise
+// a PrefixStorage under rootPrefix/<tenant> in the shared adapter. Operations without a
+// tenant fail with ErrNoTenant rather than touching the shared namespace.
+type TenantStorage struct {
+	shared     StorageAdapter
+	rootPrefix string
+	dedicated  map[string]StorageAdapter
+
+	prefixed map[string]StorageAdapter
+	mu       sync.Mutex
+}
+
+var _ StorageAdapter = (*TenantStorage)(nil)
+
+// NewTenantStorage routes tenants to dedicated adapters or to prefixes of shared.
+func NewTenantStorage(shared StorageAdapter, rootPrefix string, dedicated map[string]StorageAdapter) *TenantStorage {
+	return &TenantStorage{
+		shared:     shared,
+		rootPrefix: strings.Trim(path.Clean("/"+rootPrefix), "/"),
+		dedicated:  dedicated,
+		prefixed:   make(map[string]StorageAdapter),
+	}
+}
+
+// Namespace returns the prefix of the shared adapter holding tenantID's files, or ""
+// when the tenant has a dedicated adapter.
+func (s *TenantStorage) Namespace(tenantID string) string {
+	if _, ok := s.dedicated[tenantID]; ok {
+		return ""
+	}
+	if s.rootPrefix == "" {
+		return tenantID
+	}
+	return s.rootPrefix + "/" + tenantID
+}
+
+// tenant returns the adapter for the tenant in ctx.
+func (s *TenantStorage) tenant(ctx context.Context) (StorageAdapter, error) {
+	tenantID := TenantFromContext(ctx)
+	if tenantID == "" {
+		return nil, ErrNoTenant
+	}
+	if err := ValidateTenantID(tenantID); err != nil {
+		return nil, err
+	}
+	if adapter, ok := s.dedicated[tenantID]; ok {
+		return adapter, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	adapter, ok := s.prefixed[tenantID]
+	if !ok {
+		adapter = NewPrefixStorage(s.shared, s.Namespace(tenantID))
+		s.prefixed[tenantID] = adapter
+	}
+	return adapter, nil
+}
+
+func (s *TenantStorage) UploadFile(ctx context.Context, filePath string, data []byte) error {
+	adapter, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return adapter.UploadFile(ctx, filePath, data)
+}
+
+func (s *TenantStorage) WriteFile(ctx context.Context, path string, content []byte, overwrite bool) error {
+	adapter, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return adapter.WriteFile(ctx, path, content, overwrite)
+}
+
+func (s *TenantStorage) ReadFile(ctx context.Context, filePath string) ([]byte, error) {
+	adapter, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return adapter.ReadFile(ctx, filePath)
+}
+
+func (s *TenantStorage) DeleteFile(ctx context.Context, filePath string) error {
+	adapter, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return adapter.DeleteFile(ctx, filePath)
+}
+
+func (s *TenantStorage) ListFiles(ctx context.Context, dirPath string) ([]string, error) {
+	adapter, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return adapter.ListFiles(ctx, dirPath)
+}
+
+func (s *TenantStorage) WriteStream(ctx context.Context, path string, r io.Reader, opts WriteOptions) error {
+	adapter, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return adapter.WriteStream(ctx, path, r, opts)
+}
+
+func (s *TenantStorage) OpenFile(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	adapter, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return adapter.OpenFile(ctx, filePath)
+}
+
+func (s *TenantStorage) Stat(ctx context.Context, filePath string) (*FileInfo, error) {
+	adapter, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return adapter.Stat(ctx, filePath)
+}
+
+func (s *TenantStorage) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	adapter, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return adapter.SetMetadata(ctx, filePath, metadata)
+}
+
+func (s *TenantStorage) SetTags(ctx context.Context, filePath string, tags map[string]string) error {
+	adapter, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return adapter.SetTags(ctx, filePath, tags)
+}
+
+func (s *TenantStorage) GetTags(ctx context.Context, filePath string) (map[string]string, error) {
+	adapter, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return adapter.GetTags(ctx, filePath)
+}
+
+func (s *TenantStorage) FindFilesByTags(ctx context.Context, query TagQuery) (*TagSearchResult, error) {
+	adapter, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return adapter.FindFilesByTags(ctx, query)
+}
+
+func (s *TenantStorage) SetImmutabilityPolicy(ctx context.Context, target string, retainUntil time.Time) error {
+	adapter, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return adapter.SetImmutabilityPolicy(ctx, target, retainUntil)
+}
+
+func (s *TenantStorage) SetLegalHold(ctx context.Context, target string, hold bool) error {
+	adapter, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return adapter.SetLegalHold(ctx, target, hold)
+}
+
+func (s *TenantStorage) ListRetentionRules(ctx context.Context) ([]RetentionRule, error) {
+	adapter, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return adapter.ListRetentionRules(ctx)
+}
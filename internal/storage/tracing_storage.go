@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("project-root/internal/storage")
+
+// TracingStorage is a StorageAdapter decorator that runs every call in a span, a child of
+// the span in the call's context.
+type TracingStorage struct {
+	StorageAdapter
+	backend string
+}
+
+// NewTracingStorage labels the spans of inner's calls with backend, e.g. "azure" or "local".
+func NewTracingStorage(inner StorageAdapter, backend string) *TracingStorage {
+	return &TracingStorage{StorageAdapter: inner, backend: backend}
+}
+
+// start opens a span for operation on path; defer the returned function with the call's
+// error result to end it.
+func (s *TracingStorage) start(ctx context.Context, operation, path string) (context.Context, func(err *error)) {
+	ctx, span := tracer.Start(ctx, "storage."+operation, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("storage.backend", s.backend), attribute.String("file.path", path)))
+	return ctx, func(err *error) {
+		if *err != nil {
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+	}
+}
+
+// HealthCheck probes the wrapped adapter without a span, so probes do not flood traces.
+func (s *TracingStorage) HealthCheck(ctx context.Context) error {
+	return CheckHealth(ctx, s.StorageAdapter)
+}
+
+func (s *TracingStorage) UploadFile(ctx context.Context, filePath string, data []byte) (err error) {
+	ctx, end := s.start(ctx, "upload_file", filePath)
+	defer end(&err)
+	return s.StorageAdapter.UploadFile(ctx, filePath, data)
+}
+
+func (s *TracingStorage) WriteFile(ctx context.Context, path string, content []byte, overwrite bool) (err error) {
+	ctx, end := s.start(ctx, "write_file", path)
+	defer end(&err)
+	return s.StorageAdapter.WriteFile(ctx, path, content, overwrite)
+}
+
+func (s *TracingStorage) ReadFile(ctx context.Context, filePath string) (data []byte, err error) {
+	ctx, end := s.start(ctx, "read_file", filePath)
+	defer end(&err)
+	return s.StorageAdapter.ReadFile(ctx, filePath)
+}
+
+func (s *TracingStorage) DeleteFile(ctx context.Context, filePath string) (err error) {
+	ctx, end := s.start(ctx, "delete_file", filePath)
+	defer end(&err)
+	return s.StorageAdapter.DeleteFile(ctx, filePath)
+}
+
+func (s *TracingStorage) ListFiles(ctx context.Context, dirPath string) (files []string, err error) {
+	ctx, end := s.start(ctx, "list_files", dirPath)
+	defer end(&err)
+	return s.StorageAdapter.ListFiles(ctx, dirPath)
+}
+
+func (s *TracingStorage) WriteStream(ctx context.Context, path string, r io.Reader, opts WriteOptions) (err error) {
+	ctx, end := s.start(ctx, "write_stream", path)
+	defer end(&err)
+	return s.StorageAdapter.WriteStream(ctx, path, r, opts)
+}
+
+func (s *TracingStorage) OpenFile(ctx context.Context, filePath string) (rc io.ReadCloser, err error) {
+	ctx, end := s.start(ctx, "open_file", filePath)
+	defer end(&err)
+	return s.StorageAdapter.OpenFile(ctx, filePath)
+}
+
+func (s *TracingStorage) Stat(ctx context.Context, filePath string) (info *FileInfo, err error) {
+	ctx, end := s.start(ctx, "stat", filePath)
+	defer end(&err)
+	return s.StorageAdapter.Stat(ctx, filePath)
+}
+
+func (s *TracingStorage) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) (err error) {
+	ctx, end := s.start(ctx, "set_metadata", filePath)
+	defer end(&err)
+	return s.StorageAdapter.SetMetadata(ctx, filePath, metadata)
+}
+
+func (s *TracingStorage) SetTags(ctx context.Context, filePath string, tags map[string]string) (err error) {
+	ctx, end := s.start(ctx, "set_tags", filePath)
+	defer end(&err)
+	return s.StorageAdapter.SetTags(ctx, filePath, tags)
+}
+
+func (s *TracingStorage) GetTags(ctx context.Context, filePath string) (tags map[string]string, err error) {
+	ctx, end := s.start(ctx, "get_tags", filePath)
+	defer end(&err)
+	return s.StorageAdapter.GetTags(ctx, filePath)
+}
+
+func (s *TracingStorage) FindFilesByTags(ctx context.Context, query TagQuery) (result *TagSearchResult, err error) {
+	ctx, end := s.start(ctx, "find_files_by_tags", query.Prefix)
+	defer end(&err)
+	return s.StorageAdapter.FindFilesByTags(ctx, query)
+}
+
+func (s *TracingStorage) SetImmutabilityPolicy(ctx context.Context, target string, retainUntil time.Time) (err error) {
+	ctx, end := s.start(ctx, "set_immutability_policy", target)
+	defer end(&err)
+	return s.StorageAdapter.SetImmutabilityPolicy(ctx, target, retainUntil)
+}
+
+func (s *TracingStorage) SetLegalHold(ctx context.Context, target string, hold bool) (err error) {
+	ctx, end := s.start(ctx, "set_legal_hold", target)
+	defer end(&err)
+	return s.StorageAdapter.SetLegalHold(ctx, target, hold)
+}
+
+func (s *TracingStorage) ListRetentionRules(ctx context.Context) (rules []RetentionRule, err error) {
+	ctx, end := s.start(ctx, "list_retention_rules", "")
+	defer end(&err)
+	return s.StorageAdapter.ListRetentionRules(ctx)
+}
@@ -0,0 +1,242 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client certificate modes.
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// Cipher policies for TLS 1.2; TLS 1.3 suites are not configurable in Go.
+const (
+	// CipherPolicyModern only allows TLS 1.3.
+	CipherPolicyModern = "modern"
+	// CipherPolicyIntermediate allows TLS 1.2 with forward-secret AEAD suites.
+	CipherPolicyIntermediate = "intermediate"
+)
+
+var intermediateSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// Config describes the server's TLS settings.
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// MinVersion is "1.2" (default) or "1.3".
+	MinVersion string
+	// CipherPolicy is CipherPolicyIntermediate (default) or CipherPolicyModern; CipherSuites,
+	// when set, lists TLS 1.2 suites by their Go names instead.
+	CipherPolicy string
+	CipherSuites []string
+	// ClientCAFile verifies client certificates according to ClientAuth.
+	ClientCAFile string
+	ClientAuth   string
+}
+
+// Reloader serves the certificate and client CA bundle from disk and reloads them when
+// the files change, so certificates can be rotated without a restart.
+type Reloader struct {
+	config Config
+	base   *tls.Config
+
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+	mu        sync.RWMutex
+}
+
+// New loads the certificate and CA bundle and validates the settings.
+func New(config Config) (*Reloader, error) {
+	// The per-client configs replace the server's, so they must advertise HTTP/2 themselves.
+	base := &tls.Config{MinVersion: tls.VersionTLS12, NextProtos: []string{"h2", "http/1.1"}}
+	switch config.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		base.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported TLS minimum version %q", config.MinVersion)
+	}
+
+	if len(config.CipherSuites) > 0 {
+		suites, err := cipherSuites(config.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		base.CipherSuites = suites
+	} else {
+		switch config.CipherPolicy {
+		case "", CipherPolicyIntermediate:
+			base.CipherSuites = intermediateSuites
+		case CipherPolicyModern:
+			base.MinVersion = tls.VersionTLS13
+		default:
+			return nil, fmt.Errorf("unknown cipher policy %q", config.CipherPolicy)
+		}
+	}
+
+	switch config.ClientAuth {
+	case "", ClientAuthNone:
+		base.ClientAuth = tls.NoClientCert
+	case ClientAuthOptional:
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth mode %q", config.ClientAuth)
+	}
+	if base.ClientAuth != tls.NoClientCert && config.ClientCAFile == "" {
+		return nil, fmt.Errorf("client certificate authentication needs a CA file")
+	}
+
+	r := &Reloader{config: config, base: base}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns a server configuration that always uses the latest certificate and CAs.
+func (r *Reloader) TLSConfig() *tls.Config {
+	config := r.base.Clone()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		current := r.base.Clone()
+		current.Certificates = []tls.Certificate{*r.cert}
+		current.ClientCAs = r.clientCAs
+		return current, nil
+	}
+	return config
+}
+
+// Reload reads the certificate, key and CA bundle. On error the current ones stay in use.
+func (r *Reloader) Reload() error {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %v", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.config.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %v", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("client CA file contains no certificates")
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	return nil
+}
+
+// Watch reloads when any of the files changes, checking every interval until ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var failed map[string]time.Time // Modification times of the last set that failed to load
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modTimes, err := r.fileModTimes()
+		if err != nil {
+			slog.Error("Failed to check TLS files", "error", err)
+			continue
+		}
+		r.mu.RLock()
+		changed := !sameModTimes(modTimes, r.modTimes)
+		r.mu.RUnlock()
+		if !changed || sameModTimes(modTimes, failed) {
+			continue
+		}
+
+		if err := r.Reload(); err != nil {
+			failed = modTimes
+			slog.Error("Keeping previous TLS certificate, reload failed", "error", err)
+			continue
+		}
+		slog.Info("Reloaded TLS certificate", "file", r.config.CertFile)
+	}
+}
+
+func (r *Reloader) fileModTimes() (map[string]time.Time, error) {
+	modTimes := map[string]time.Time{}
+	for _, file := range []string{r.config.CertFile, r.config.KeyFile, r.config.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		modTimes[file] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func sameModTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, modTime := range a {
+		if !modTime.Equal(b[file]) {
+			return false
+		}
+	}
+	return true
+}
+
+// cipherSuites resolves suite names, refusing ones Go considers insecure.
+func cipherSuites(names []string) ([]uint16, error) {
+	known := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
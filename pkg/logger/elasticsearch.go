@@ -0,0 +1,185 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ElasticsearchConfig ships records to Elasticsearch in batches.
+type ElasticsearchConfig struct {
+	// URL is the cluster address, e.g. "http://localhost:9200".
+	URL   string
+	Index string
+	// BatchSize records are sent per _bulk request; a partial batch is sent after FlushInterval.
+	BatchSize     int
+	FlushInterval time.Duration
+	// BufferSize bounds the records waiting to be sent. Records arriving while it is full are
+	// dropped rather than slowing the application down.
+	BufferSize int
+	// MaxRetries is how often a failed batch is retried, with doubling backoff, before it is dropped.
+	MaxRetries int
+}
+
+const (
+	defaultBatchSize     = 500
+	defaultFlushInterval = 2 * time.Second
+	defaultBufferSize    = 10000
+	retryBackoff         = 100 * time.Millisecond
+	maxRetryBackoff      = 10 * time.Second
+)
+
+// ElasticsearchSink indexes records through the _bulk API from a background goroutine.
+type ElasticsearchSink struct {
+	config  ElasticsearchConfig
+	client  *http.Client
+	records chan []byte
+	dropped atomic.Int64
+
+	stop      chan struct{}
+	abort     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewElasticsearchSink starts shipping records to the cluster.
+func NewElasticsearchSink(config ElasticsearchConfig) *ElasticsearchSink {
+	if config.Index == "" {
+		config.Index = "logs"
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultFlushInterval
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultBufferSize
+	}
+	s := &ElasticsearchSink{
+		config:  config,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		records: make(chan []byte, config.BufferSize),
+		stop:    make(chan struct{}),
+		abort:   make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write queues a record without blocking.
+func (s *ElasticsearchSink) Write(p []byte) (int, error) {
+	select {
+	case s.records <- bytes.Clone(p):
+	default:
+		s.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+// Dropped is the number of records discarded because the buffer was full or a batch kept failing.
+func (s *ElasticsearchSink) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close sends the queued records and stops. If ctx ends first, retries are abandoned.
+func (s *ElasticsearchSink) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() { close(s.stop) })
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		close(s.abort)
+		<-s.done
+		return ctx.Err()
+	}
+}
+
+func (s *ElasticsearchSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([][]byte, 0, s.config.BatchSize)
+	for {
+		select {
+		case record := <-s.records:
+			if batch = append(batch, record); len(batch) >= s.config.BatchSize {
+				batch = s.send(batch)
+			}
+		case <-ticker.C:
+			batch = s.send(batch)
+		case <-s.stop:
+			// Records logged after Close are left in the buffer.
+			for n := len(s.records); n > 0; n-- {
+				if batch = append(batch, <-s.records); len(batch) >= s.config.BatchSize {
+					batch = s.send(batch)
+				}
+			}
+			s.send(batch)
+			return
+		}
+	}
+}
+
+// send posts batch, retrying with backoff, and returns it emptied for reuse.
+func (s *ElasticsearchSink) send(batch [][]byte) [][]byte {
+	if len(batch) == 0 {
+		return batch
+	}
+	action := fmt.Sprintf(`{"index":{"_index":%q}}`+"\n", s.config.Index)
+	var body bytes.Buffer
+	for _, record := range batch {
+		body.WriteString(action)
+		body.Write(record)
+	}
+
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.post(body.Bytes())
+		if err == nil {
+			break
+		}
+		if attempt >= s.config.MaxRetries {
+			s.dropped.Add(int64(len(batch)))
+			fmt.Fprintf(os.Stderr, "%s dropped %d log records: %v\n", time.Now().Format(time.RFC3339), len(batch), err)
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-s.abort:
+			s.dropped.Add(int64(len(batch)))
+			return batch[:0]
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+	return batch[:0]
+}
+
+func (s *ElasticsearchSink) post(body []byte) error {
+	resp, err := s.client.Post(strings.TrimSuffix(s.config.URL, "/")+"/_bulk", "application/x-ndjson", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("elasticsearch returned %s", resp.Status)
+	}
+
+	// Rejected documents are not retried; a mapping conflict would fail again.
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err == nil && result.Errors {
+		fmt.Fprintf(os.Stderr, "%s elasticsearch rejected some log records\n", time.Now().Format(time.RFC3339))
+	}
+	return nil
+}
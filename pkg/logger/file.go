@@ -0,0 +1,97 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileConfig writes records to a file that is rotated by size.
+type FileConfig struct {
+	Path string
+	// MaxBytes rotates the file before it would grow past this size; zero never rotates.
+	MaxBytes int64
+	// MaxBackups is how many rotated files (Path.1 is the newest) are kept.
+	MaxBackups int
+}
+
+// FileSink appends records to a file, rotating it when it reaches its size limit.
+type FileSink struct {
+	config FileConfig
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+}
+
+// NewFileSink opens (or creates) the log file.
+func NewFileSink(config FileConfig) (*FileSink, error) {
+	s := &FileSink{config: config}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.config.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	s.file, s.size = file, info.Size()
+	return nil
+}
+
+// Write appends a record, rotating first if it would not fit.
+func (s *FileSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if s.config.MaxBytes > 0 && s.size > 0 && s.size+int64(len(p)) > s.config.MaxBytes {
+		if err := s.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.file.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+// rotate shifts Path.N to Path.N+1, dropping the oldest, and moves the current file to Path.1.
+func (s *FileSink) rotate() error {
+	s.file.Close()
+	s.file = nil
+
+	os.Remove(fmt.Sprintf("%s.%d", s.config.Path, s.config.MaxBackups))
+	for i := s.config.MaxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.config.Path, i), fmt.Sprintf("%s.%d", s.config.Path, i+1))
+	}
+	if s.config.MaxBackups > 0 {
+		if err := os.Rename(s.config.Path, s.config.Path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate log file: %v", err)
+		}
+	} else if err := os.Remove(s.config.Path); err != nil {
+		return fmt.Errorf("failed to rotate log file: %v", err)
+	}
+	return s.open()
+}
+
+// Close closes the file.
+func (s *FileSink) Close(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
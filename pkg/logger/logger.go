@@ -1,69 +1,136 @@
 package logger
 
 import (
-	"bytes"
-	"encoding/json"
-	"log"
-	"net/http"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
 	"time"
 
-	"project-root/config"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var elasticsearchURL string
+// Config selects the level and sinks of the log pipeline.
+type Config struct {
+	// Level is "debug", "info", "warn" or "error"; empty means "info".
+	Level string
+	// Stdout writes JSON records to standard output.
+	Stdout        bool
+	File          FileConfig
+	Elasticsearch ElasticsearchConfig
+	// Sinks are added to the configured ones, e.g. to ship records to another log store.
+	Sinks []Sink
+}
+
+// Sink receives each log record as one JSON line. Write must not retain p, and must not
+// block on slow destinations since it runs while the record is being logged.
+type Sink interface {
+	io.Writer
+	// Close flushes buffered records, giving up when ctx is done.
+	Close(ctx context.Context) error
+}
 
-// Initialize Elasticsearch URL from config
-func init() {
-	cfg, err := config.LoadConfig()
+// Setup makes a logger writing to the configured sinks the slog default, which also routes
+// the standard log package through it, and returns a function that flushes and closes the
+// sinks.
+func Setup(config Config) (func(context.Context) error, error) {
+	level, err := ParseLevel(config.Level)
 	if err != nil {
-		log.Printf("⚠️ Warning: Failed to load config, using default Elasticsearch URL")
-		elasticsearchURL = "http://localhost:9200/logs/_doc/"
-		return
+		return nil, err
 	}
 
-	if cfg.Logging.ElasticsearchURL == "" {
-		log.Printf("⚠️ Warning: Elasticsearch URL not set in config, using default")
-		elasticsearchURL = "http://localhost:9200/logs/_doc/"
-	} else {
-		elasticsearchURL = cfg.Logging.ElasticsearchURL
+	var sinks []Sink
+	if config.Stdout {
+		sinks = append(sinks, NewWriterSink(os.Stdout))
+	}
+	if config.File.Path != "" {
+		file, err := NewFileSink(config.File)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, file)
+	}
+	if config.Elasticsearch.URL != "" {
+		sinks = append(sinks, NewElasticsearchSink(config.Elasticsearch))
 	}
+	sinks = append(sinks, config.Sinks...)
+
+	slog.SetDefault(New(level, sinks...))
+	return func(ctx context.Context) error {
+		var errs []error
+		for _, sink := range sinks {
+			errs = append(errs, sink.Close(ctx))
+		}
+		return errors.Join(errs...)
+	}, nil
 }
 
-// 🔹 Log Message Structure
-type LogMessage struct {
-	Level   string `json:"level"`
-	Message string `json:"message"`
-	Error   string `json:"error,omitempty"`
+// New returns a logger writing records at level and above to sinks as JSON. Records logged
+// with a context include its request_id, and the trace_id and span_id of its span.
+func New(level slog.Level, sinks ...Sink) *slog.Logger {
+	handler := slog.NewJSONHandler(fanout(sinks), &slog.HandlerOptions{Level: level})
+	return slog.New(contextHandler{handler})
 }
 
-// 🔹 Send logs to Elasticsearch
-func sendToElasticSearch(logData LogMessage) {
-	jsonData, _ := json.Marshal(logData)
+// ParseLevel parses a level name; empty means info.
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", name)
+	}
+	return level, nil
+}
 
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Post(elasticsearchURL, "application/json", bytes.NewBuffer(jsonData))
+// fanout writes each record to every sink. A failing sink does not stop the others.
+type fanout []Sink
 
-	if err != nil {
-		log.Printf("❌ Failed to send log to Elasticsearch: %v", err)
-		return
+func (f fanout) Write(p []byte) (int, error) {
+	for _, sink := range f {
+		if _, err := sink.Write(p); err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed to write log record: %v\n", time.Now().Format(time.RFC3339), err)
+		}
 	}
-	defer resp.Body.Close()
+	return len(p), nil
+}
+
+// contextHandler adds values carried by the context to each record.
+type contextHandler struct{ slog.Handler }
 
-	if resp.StatusCode >= 400 {
-		log.Printf("❌ Elasticsearch returned error: %s", resp.Status)
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
 	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// writerSink writes records straight to an io.Writer.
+type writerSink struct{ w io.Writer }
+
+// NewWriterSink returns a sink writing records to w, such as os.Stdout.
+func NewWriterSink(w io.Writer) Sink {
+	return writerSink{w}
 }
 
-// 🔹 Log an informational message
-func LogInfo(message string) {
-	logData := LogMessage{Level: "INFO", Message: message}
-	log.Println("ℹ️", message)
-	sendToElasticSearch(logData)
+func (s writerSink) Write(p []byte) (int, error) {
+	return s.w.Write(p)
 }
 
-// 🔹 Log an error message
-func LogError(message string, err error) {
-	logData := LogMessage{Level: "ERROR", Message: message, Error: err.Error()}
-	log.Printf("❌ %s: %v", message, err)
-	sendToElasticSearch(logData)
+func (s writerSink) Close(context.Context) error {
+	return nil
 }
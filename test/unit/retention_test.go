@@ -0,0 +1,113 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"project-root/internal/storage"
+)
+
+// 🔹 Test prefix immutability on Local Storage
+func TestLocalStorageImmutabilityPolicy(t *testing.T) {
+	ctx := context.Background()
+	localStorage := storage.NewLocalStorage(t.TempDir())
+
+	localStorage.WriteFile(ctx, "legal/contract.pdf", []byte("v1"), false)
+	if err := localStorage.SetImmutabilityPolicy(ctx, "legal/", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("❌ Failed to set policy: %v", err)
+	}
+
+	err := localStorage.WriteFile(ctx, "legal/contract.pdf", []byte("v2"), true)
+	if !errors.Is(err, storage.ErrImmutable) {
+		t.Errorf("❌ Expected ErrImmutable on overwrite, got %v", err)
+	}
+	if err := localStorage.DeleteFile(ctx, "legal/contract.pdf"); !errors.Is(err, storage.ErrImmutable) {
+		t.Errorf("❌ Expected ErrImmutable on delete, got %v", err)
+	}
+
+	// New files under the prefix can still be written once
+	if err := localStorage.WriteFile(ctx, "legal/new.pdf", []byte("v1"), false); err != nil {
+		t.Errorf("❌ Expected write-once to succeed, got %v", err)
+	}
+
+	// Policies cannot be shortened
+	if err := localStorage.SetImmutabilityPolicy(ctx, "legal/", time.Now().Add(time.Minute)); err == nil {
+		t.Errorf("❌ Expected error when shortening retention")
+	}
+
+	// Rules survive a restart
+	reopened := storage.NewLocalStorage(localStorage.BasePath)
+	rules, err := reopened.ListRetentionRules(ctx)
+	if err != nil || len(rules) != 1 || rules[0].Target != "legal/" {
+		t.Errorf("❌ Expected persisted rule, got %v (err %v)", rules, err)
+	}
+}
+
+// 🔹 Test legal hold on Mock Azure Storage
+func TestMockAzureStorageLegalHold(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := storage.NewMockAzureStorage()
+
+	mockStorage.UploadFile(ctx, "evidence.txt", []byte("data"))
+	mockStorage.SetLegalHold(ctx, "evidence.txt", true)
+
+	if err := mockStorage.DeleteFile(ctx, "evidence.txt"); !errors.Is(err, storage.ErrImmutable) {
+		t.Fatalf("❌ Expected ErrImmutable under legal hold, got %v", err)
+	}
+
+	mockStorage.SetLegalHold(ctx, "evidence.txt", false)
+	if err := mockStorage.DeleteFile(ctx, "evidence.txt"); err != nil {
+		t.Errorf("❌ Expected delete after hold release, got %v", err)
+	}
+}
+
+// 🔹 Test instances sharing a base path see and keep each other's rules
+func TestLocalStorageRetentionSharedAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	base := t.TempDir()
+	server, worker := storage.NewLocalStorage(base), storage.NewLocalStorage(base)
+	server.WriteFile(ctx, "a.txt", []byte("v1"), false)
+
+	// The worker reads the rules before the server adds one, then must still honor it.
+	if err := worker.WriteFile(ctx, "a.txt", []byte("v2"), true); err != nil {
+		t.Fatalf("❌ Expected overwrite without rules, got %v", err)
+	}
+	if err := server.SetLegalHold(ctx, "a.txt", true); err != nil {
+		t.Fatalf("❌ Failed to set hold: %v", err)
+	}
+	if err := worker.DeleteFile(ctx, "a.txt"); !errors.Is(err, storage.ErrImmutable) {
+		t.Errorf("❌ Expected the worker to see the server's hold, got %v", err)
+	}
+
+	// A rule added by the worker must not drop the server's hold.
+	if err := worker.SetImmutabilityPolicy(ctx, "legal/", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("❌ Failed to set policy: %v", err)
+	}
+	rules, err := server.ListRetentionRules(ctx)
+	if err != nil || len(rules) != 2 {
+		t.Errorf("❌ Expected both rules, got %v (err %v)", rules, err)
+	}
+}
+
+// 🔹 Test a failed load of the rules is retried instead of failing every request
+func TestLocalStorageRetentionLoadRecovers(t *testing.T) {
+	ctx := context.Background()
+	base := t.TempDir()
+	rulesFile := filepath.Join(base, ".index", "retention.json")
+	os.MkdirAll(filepath.Dir(rulesFile), 0755)
+	os.WriteFile(rulesFile, []byte("{corrupt"), 0644)
+
+	localStorage := storage.NewLocalStorage(base)
+	if _, err := localStorage.ListRetentionRules(ctx); err == nil {
+		t.Fatalf("❌ Expected an error for corrupt rules")
+	}
+	os.WriteFile(rulesFile, []byte(`[{"target":"a.txt","legalHold":true}]`), 0644)
+	rules, err := localStorage.ListRetentionRules(ctx)
+	if err != nil || len(rules) != 1 {
+		t.Errorf("❌ Expected the rules to load once repaired, got %v (err %v)", rules, err)
+	}
+}
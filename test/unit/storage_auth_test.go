@@ -0,0 +1,204 @@
+package storage_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"project-root/internal/api"
+	"project-root/internal/auth"
+	"project-root/internal/storage"
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signHS256(secret string, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := b64(header) + "." + b64(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return input + "." + b64(mac.Sum(nil))
+}
+
+func bearer(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// hmacSecret is long enough for NewJWTAuthenticator.
+const hmacSecret = "a-test-secret-of-at-least-32-bytes"
+
+// 🔹 Test JWT validation with an HMAC secret and a JWKS file
+func TestJWTAuthenticator(t *testing.T) {
+	if _, err := auth.NewJWTAuthenticator(auth.JWTConfig{HMACSecret: []byte("s3cret")}); err == nil {
+		t.Errorf("❌ Expected a short HMAC secret to be rejected")
+	}
+	jwt, err := auth.NewJWTAuthenticator(auth.JWTConfig{HMACSecret: []byte(hmacSecret), Audience: "storage"})
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticator: %v", err)
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	identity, err := jwt.Authenticate(bearer(signHS256(hmacSecret, map[string]any{
+		"sub": "alice", "tenant": "acme", "roles": []string{"reader", "writer"}, "aud": "storage", "exp": exp,
+	})))
+	if err != nil || identity.Subject != "jwt:alice" || identity.Tenant != "acme" || len(identity.Roles) != 2 {
+		t.Fatalf("❌ Expected alice@acme with 2 roles, got %+v (err %v)", identity, err)
+	}
+
+	rejected := map[string]string{
+		"expired":      signHS256(hmacSecret, map[string]any{"sub": "alice", "aud": "storage", "exp": time.Now().Add(-time.Hour).Unix()}),
+		"no expiry":    signHS256(hmacSecret, map[string]any{"sub": "alice", "aud": "storage"}),
+		"wrong secret": signHS256("guess", map[string]any{"sub": "alice", "aud": "storage", "exp": exp}),
+		"wrong aud":    signHS256(hmacSecret, map[string]any{"sub": "alice", "aud": "other", "exp": exp}),
+		"no aud":       signHS256(hmacSecret, map[string]any{"sub": "alice", "exp": exp}),
+		"not yet":      signHS256(hmacSecret, map[string]any{"sub": "alice", "aud": "storage", "exp": exp, "nbf": time.Now().Add(time.Hour).Unix()}),
+		"alg none":     b64([]byte(`{"alg":"none"}`)) + "." + b64([]byte(fmt.Sprintf(`{"sub":"alice","aud":"storage","exp":%d}`, exp))) + ".",
+	}
+	for name, token := range rejected {
+		if _, err := jwt.Authenticate(bearer(token)); !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Errorf("❌ Expected %s token to be rejected, got %v", name, err)
+		}
+	}
+
+	// ES256 with a key from a JWKS file
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "EC", "kid": "k1", "crv": "P-256", "x": b64(key.X.FillBytes(make([]byte, 32))), "y": b64(key.Y.FillBytes(make([]byte, 32))),
+	}}})
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(jwksFile, jwks, 0600)
+	ecJWT, err := auth.NewJWTAuthenticator(auth.JWTConfig{JWKSFile: jwksFile})
+	if err != nil {
+		t.Fatalf("❌ Failed to load JWKS: %v", err)
+	}
+
+	header := b64([]byte(`{"alg":"ES256","kid":"k1"}`))
+	payload := b64([]byte(fmt.Sprintf(`{"sub":"svc","exp":%d}`, exp)))
+	digest := sha256.Sum256([]byte(header + "." + payload))
+	r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	if identity, err := ecJWT.Authenticate(bearer(header + "." + payload + "." + b64(signature))); err != nil || identity.Subject != "jwt:svc" {
+		t.Errorf("❌ Expected ES256 token to be accepted, got %+v (err %v)", identity, err)
+	}
+	if _, err := ecJWT.Authenticate(bearer(signHS256(hmacSecret, map[string]any{"sub": "alice", "exp": exp}))); err == nil {
+		t.Errorf("❌ Expected HMAC token to be rejected without a secret")
+	}
+}
+
+// rsaJWKS writes a JWKS file holding key's public half as kid "r1".
+func rsaJWKS(t *testing.T, key *rsa.PrivateKey) string {
+	t.Helper()
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA", "kid": "r1", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(file, jwks, 0600)
+	return file
+}
+
+// 🔹 Test RSA keys only verify RSA signatures and must be strong enough
+func TestJWTAuthenticatorRSA(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwt, err := auth.NewJWTAuthenticator(auth.JWTConfig{JWKSFile: rsaJWKS(t, key), Audience: "storage"})
+	if err != nil {
+		t.Fatalf("❌ Failed to load JWKS: %v", err)
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	payload := b64([]byte(fmt.Sprintf(`{"sub":"svc","aud":"storage","exp":%d}`, exp)))
+	header := b64([]byte(`{"alg":"RS256","kid":"r1"}`))
+	digest := sha256.Sum256([]byte(header + "." + payload))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if identity, err := jwt.Authenticate(bearer(header + "." + payload + "." + b64(signature))); err != nil || identity.Subject != "jwt:svc" {
+		t.Fatalf("❌ Expected RS256 token to be accepted, got %+v (err %v)", identity, err)
+	}
+
+	// A token "signed" with the public key as an HMAC secret must not verify.
+	publicDER := x509.MarshalPKCS1PublicKey(&key.PublicKey)
+	confused := b64([]byte(`{"alg":"HS256","kid":"r1"}`)) + "." + payload
+	mac := hmac.New(sha256.New, publicDER)
+	mac.Write([]byte(confused))
+	rejected := map[string]string{
+		"HS256 with public key": confused + "." + b64(mac.Sum(nil)),
+		"ES256 with RSA key":    b64([]byte(`{"alg":"ES256","kid":"r1"}`)) + "." + payload + "." + b64(signature),
+		"alg none":              b64([]byte(`{"alg":"none","kid":"r1"}`)) + "." + payload + ".",
+	}
+	for name, token := range rejected {
+		if _, err := jwt.Authenticate(bearer(token)); !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Errorf("❌ Expected %s token to be rejected, got %v", name, err)
+		}
+	}
+
+	weak, _ := rsa.GenerateKey(rand.Reader, 1024)
+	if _, err := auth.NewJWTAuthenticator(auth.JWTConfig{JWKSFile: rsaJWKS(t, weak)}); err == nil {
+		t.Errorf("❌ Expected a 1024-bit RSA key to be rejected")
+	}
+}
+
+// 🔹 Test API key authentication and identity propagation through the API
+func TestAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, err := auth.NewAPIKeyAuthenticator([]auth.APIKey{
+		{Name: "uploader", Hash: auth.HashAPIKey("key-acme"), Tenant: "acme"},
+		{Name: "unbound", Hash: auth.HashAPIKey("key-none")},
+	})
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticator: %v", err)
+	}
+	backend := storage.NewLocalStorage(t.TempDir())
+	tenants := storage.NewTenantStorage(backend, "tenants", nil)
+	router := api.SetupRoutes(&api.API{Storage: tenants, Tenants: tenants, Auth: auth.Chain{keys}})
+
+	request := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/directory/docs", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		req.Header.Set("X-Tenant-ID", "globex") // Ignored once the caller is authenticated
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := request("", ""); rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("❌ Expected 401 with challenge without credentials, got %d", rec.Code)
+	}
+	if rec := request("X-API-Key", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("❌ Expected 401 for unknown key, got %d", rec.Code)
+	}
+	if rec := request("X-API-Key", "key-none"); rec.Code != http.StatusForbidden {
+		t.Errorf("❌ Expected 403 for key without tenant, got %d", rec.Code)
+	}
+	if rec := request("Authorization", "ApiKey key-acme"); rec.Code != http.StatusCreated {
+		t.Fatalf("❌ Expected 201 with valid key, got %d %s", rec.Code, rec.Body)
+	}
+
+	// The write landed in the key's tenant, not the one from the header
+	if _, err := backend.Stat(context.Background(), "tenants/acme/docs/.keep"); err != nil {
+		t.Errorf("❌ Expected write in the authenticated tenant: %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package storage_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"project-root/internal/api"
+	"project-root/internal/auth"
+	"project-root/internal/authz"
+	"project-root/internal/storage"
+)
+
+const testPolicy = `
+roles:
+  reader:
+    - actions: [read, list]
+      paths: ["**"]
+  writer:
+    - actions: [write]
+      paths: ["uploads/**", "*.txt"]
+    - effect: deny
+      actions: ["*"]
+      paths: ["uploads/secret/**"]
+  admin:
+    - actions: ["*"]
+      paths: ["**"]
+bindings:
+  apikey:carol: [admin]
+`
+
+// 🔹 Test policy evaluation: globs, deny-by-default, deny precedence and bindings
+func TestPolicyEvaluate(t *testing.T) {
+	policy, err := authz.ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("❌ Failed to parse policy: %v", err)
+	}
+
+	cases := []struct {
+		req  authz.Request
+		want bool
+	}{
+		{authz.Request{Subject: "bob", Roles: []string{"writer"}, Action: authz.Write, Path: "uploads/a/b.bin"}, true},
+		{authz.Request{Subject: "bob", Roles: []string{"writer"}, Action: authz.Write, Path: "notes.txt"}, true},
+		{authz.Request{Subject: "bob", Roles: []string{"writer"}, Action: authz.Write, Path: "docs/notes.txt"}, false},
+		{authz.Request{Subject: "bob", Roles: []string{"writer", "reader"}, Action: authz.Read, Path: "uploads/secret/x"}, false},
+		{authz.Request{Subject: "bob", Roles: []string{"writer"}, Action: authz.Write, Path: "uploads/../uploads/secret/x"}, false},
+		{authz.Request{Subject: "bob", Roles: []string{"unknown"}, Action: authz.Read, Path: "a"}, false},
+		{authz.Request{Subject: "apikey:carol", Action: authz.Admin, Path: ""}, true},
+		{authz.Request{Subject: "dave", Action: authz.Read, Path: "a"}, false},
+	}
+	for _, tc := range cases {
+		if decision := policy.Evaluate(tc.req); decision.Allowed != tc.want {
+			t.Errorf("❌ %+v: expected allowed=%v, got %+v", tc.req, tc.want, decision)
+		}
+	}
+
+	if _, err := authz.ParsePolicy([]byte("roles:\n  x:\n    - actions: [fly]\n      paths: ['**']\n")); err == nil {
+		t.Errorf("❌ Expected unknown action to be rejected")
+	}
+	if _, err := authz.ParsePolicy([]byte("bindings:\n  bob: [ghost]\n")); err == nil {
+		t.Errorf("❌ Expected binding to an unknown role to be rejected")
+	}
+}
+
+// 🔹 Test that policy file changes are picked up and invalid ones are ignored
+func TestPolicyHotReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	os.WriteFile(file, []byte("roles:\n  reader:\n    - actions: [read]\n      paths: ['**']\n"), 0644)
+	engine, err := authz.NewEngine(file)
+	if err != nil {
+		t.Fatalf("❌ Failed to load policy: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go engine.Watch(ctx, 10*time.Millisecond)
+
+	read := authz.Request{Subject: "bob", Roles: []string{"reader"}, Action: authz.Read, Path: "a"}
+	if !engine.Evaluate(read).Allowed {
+		t.Fatalf("❌ Expected initial policy to allow read")
+	}
+
+	// An invalid policy keeps the previous one in effect
+	os.WriteFile(file, []byte("roles: [not, a, map"), 0644)
+	os.Chtimes(file, time.Now(), time.Now().Add(time.Second))
+	time.Sleep(50 * time.Millisecond)
+	if !engine.Evaluate(read).Allowed {
+		t.Fatalf("❌ Invalid policy should not replace the current one")
+	}
+
+	os.WriteFile(file, []byte("roles:\n  reader:\n    - actions: [list]\n      paths: ['**']\n"), 0644)
+	os.Chtimes(file, time.Now(), time.Now().Add(2*time.Second))
+	deadline := time.Now().Add(2 * time.Second)
+	for engine.Evaluate(read).Allowed && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if engine.Evaluate(read).Allowed {
+		t.Errorf("❌ Expected reloaded policy to deny read")
+	}
+}
+
+// 🔹 Test that every route is authorized and listings are filtered
+func TestAuthorizationAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	os.WriteFile(file, []byte(testPolicy), 0644)
+	engine, err := authz.NewEngine(file)
+	if err != nil {
+		t.Fatalf("❌ Failed to load policy: %v", err)
+	}
+	keys, _ := auth.NewAPIKeyAuthenticator([]auth.APIKey{
+		{Name: "bob", Hash: auth.HashAPIKey("bob-key"), Roles: []string{"writer", "reader"}},
+		{Name: "carol", Hash: auth.HashAPIKey("carol-key")},
+	})
+	backend := storage.NewMockAzureStorage()
+	backend.UploadFile(context.Background(), "notes.txt", []byte("notes"))
+	backend.UploadFile(context.Background(), "uploads/secret/plan.txt", []byte("plan"))
+	router := api.SetupRoutes(&api.API{Storage: backend, Auth: auth.Chain{keys}, Authz: engine})
+
+	do := func(key, method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("bob-key", http.MethodGet, "/read/notes.txt"); rec.Code != http.StatusOK {
+		t.Errorf("❌ Expected bob to read notes.txt, got %d", rec.Code)
+	}
+	if rec := do("bob-key", http.MethodDelete, "/delete/notes.txt"); rec.Code != http.StatusForbidden {
+		t.Errorf("❌ Expected bob's delete to be forbidden, got %d", rec.Code)
+	}
+	if rec := do("bob-key", http.MethodGet, "/retention"); rec.Code != http.StatusForbidden {
+		t.Errorf("❌ Expected bob to be denied admin routes, got %d", rec.Code)
+	}
+	if rec := do("carol-key", http.MethodGet, "/retention"); rec.Code != http.StatusOK {
+		t.Errorf("❌ Expected carol (bound to admin) to list retention, got %d", rec.Code)
+	}
+
+	var listing struct{ Files []string }
+	json.Unmarshal(do("bob-key", http.MethodGet, "/list/.").Body.Bytes(), &listing)
+	if len(listing.Files) != 1 || listing.Files[0] != "notes.txt" {
+		t.Errorf("❌ Expected denied files to be hidden from listings, got %v", listing.Files)
+	}
+
+	// Explain own access, and another subject's only as admin
+	var explained struct{ Decision authz.Decision }
+	json.Unmarshal(do("bob-key", http.MethodGet, "/authz/explain?action=write&path=uploads/secret/x").Body.Bytes(), &explained)
+	if explained.Decision.Allowed || explained.Decision.Role != "writer" || explained.Decision.Rule != 1 {
+		t.Errorf("❌ Expected deny by writer rule 1, got %+v", explained.Decision)
+	}
+	if rec := do("bob-key", http.MethodGet, "/authz/explain?action=read&path=a&subject=apikey:carol"); rec.Code != http.StatusForbidden {
+		t.Errorf("❌ Expected explaining another subject to require admin, got %d", rec.Code)
+	}
+	if rec := do("carol-key", http.MethodGet, "/authz/explain?action=read&path=a&subject=dave"); rec.Code != http.StatusOK {
+		t.Errorf("❌ Expected admin to explain another subject, got %d", rec.Code)
+	}
+}
+
+// 🔹 Test that retention changes are authorized against the target in the request body
+func TestAuthorizationRetentionTarget(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	os.WriteFile(file, []byte("roles:\n  archivist:\n    - actions: [admin]\n      paths: ['records/**']\n"), 0644)
+	engine, err := authz.NewEngine(file)
+	if err != nil {
+		t.Fatalf("❌ Failed to load policy: %v", err)
+	}
+	keys, _ := auth.NewAPIKeyAuthenticator([]auth.APIKey{
+		{Name: "erin", Hash: auth.HashAPIKey("erin-key"), Roles: []string{"archivist"}},
+	})
+	backend := storage.NewMockAzureStorage()
+	router := api.SetupRoutes(&api.API{Storage: backend, Auth: auth.Chain{keys}, Authz: engine})
+
+	do := func(target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, target, strings.NewReader(body))
+		req.Header.Set("X-API-Key", "erin-key")
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	if rec := do("/retention/policy", `{"target":"records/2024.csv","retainUntil":"`+until+`"}`); rec.Code != http.StatusNoContent {
+		t.Errorf("❌ Expected a policy inside the archivist's paths to be set, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do("/retention/policy", `{"target":"other/2024.csv","retainUntil":"`+until+`"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("❌ Expected a policy outside the archivist's paths to be forbidden, got %d", rec.Code)
+	}
+	if rec := do("/retention/hold", `{"target":"records/2024.csv","legalHold":true}`); rec.Code != http.StatusNoContent {
+		t.Errorf("❌ Expected a hold inside the archivist's paths to be set, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do("/retention/hold", `{"target":"other/2024.csv","legalHold":true}`); rec.Code != http.StatusForbidden {
+		t.Errorf("❌ Expected a hold outside the archivist's paths to be forbidden, got %d", rec.Code)
+	}
+
+	rules, _ := backend.ListRetentionRules(context.Background())
+	if len(rules) != 1 || rules[0].Target != "records/2024.csv" {
+		t.Errorf("❌ Expected only the permitted rule to be stored, got %+v", rules)
+	}
+}
@@ -0,0 +1,190 @@
+package storage_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/hamba/avro/v2"
+
+	"project-root/internal/events"
+)
+
+// evolvedSchema adds a field to events.AvroSchema, the way a later release would.
+func evolvedSchema(t *testing.T, field string) string {
+	t.Helper()
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(events.AvroSchema), &schema); err != nil {
+		t.Fatalf("❌ Failed to parse the event schema: %v", err)
+	}
+	var extra map[string]any
+	json.Unmarshal([]byte(field), &extra)
+	schema["fields"] = append(schema["fields"].([]any), extra)
+	data, _ := json.Marshal(schema)
+	return string(data)
+}
+
+// 🔹 Test Avro events round-trip in the Confluent wire format
+func TestAvroSerializer(t *testing.T) {
+	ctx := context.Background()
+	registry := events.NewFileRegistry(filepath.Join(t.TempDir(), "schemas.json"))
+	serializer, err := events.NewAvroSerializer(registry, "storage-events")
+	if err != nil {
+		t.Fatalf("❌ Failed to create serializer: %v", err)
+	}
+
+	event := events.NewFactory("storage-server").New(events.FileUploaded, "docs/a.txt", "alice")
+	event.Size = 42
+	event.TenantID = "acme"
+	event.MetaData = map[string]string{events.MetaRequestID: "req-1"}
+	value, _, err := serializer.Serialize(ctx, event)
+	if err != nil {
+		t.Fatalf("❌ Failed to serialize: %v", err)
+	}
+	if value[0] != 0 || binary.BigEndian.Uint32(value[1:5]) != 1 {
+		t.Errorf("❌ Expected a magic byte and schema ID 1, got % x", value[:5])
+	}
+	if again, _, _ := serializer.Serialize(ctx, event); !reflect.DeepEqual(again[:5], value[:5]) {
+		t.Errorf("❌ Expected the schema to be registered once")
+	}
+
+	decoded, err := serializer.Deserialize(ctx, value, nil)
+	if err != nil {
+		t.Fatalf("❌ Failed to deserialize: %v", err)
+	}
+	// Avro timestamps have microsecond precision.
+	event.Timestamp = event.Timestamp.Truncate(time.Microsecond)
+	if !reflect.DeepEqual(decoded, event) {
+		t.Errorf("❌ Expected %+v, got %+v", event, decoded)
+	}
+
+	// JSON written before the topic switched to Avro is still read.
+	legacy, _ := event.ToJSON()
+	if decoded, err := serializer.Deserialize(ctx, legacy, nil); err != nil || decoded.ID != event.ID {
+		t.Errorf("❌ Expected legacy JSON to be read, got %+v (%v)", decoded, err)
+	}
+	if _, err := serializer.Deserialize(ctx, []byte{0, 0, 0, 0, 9, 2}, nil); !errors.Is(err, events.ErrSchemaNotFound) {
+		t.Errorf("❌ Expected an unknown schema ID to fail with ErrSchemaNotFound, got %v", err)
+	}
+}
+
+// 🔹 Test schema evolution is checked on registration and older readers resolve newer data
+func TestAvroSchemaEvolution(t *testing.T) {
+	ctx := context.Background()
+	registry := events.NewFileRegistry(filepath.Join(t.TempDir(), "schemas.json"))
+	serializer, _ := events.NewAvroSerializer(registry, "storage-events")
+	event := events.NewFactory("storage-server").New(events.FileUploaded, "a.txt", "alice")
+	if _, _, err := serializer.Serialize(ctx, event); err != nil {
+		t.Fatalf("❌ Failed to register the current schema: %v", err)
+	}
+
+	breaking := evolvedSchema(t, `{"name": "checksum", "type": "string"}`)
+	if _, err := registry.Register(ctx, "storage-events-value", breaking); !errors.Is(err, events.ErrIncompatibleSchema) {
+		t.Errorf("❌ Expected a new field without a default to be rejected, got %v", err)
+	}
+	compatible := evolvedSchema(t, `{"name": "checksum", "type": "string", "default": ""}`)
+	id, err := registry.Register(ctx, "storage-events-value", compatible)
+	if err != nil || id != 2 {
+		t.Fatalf("❌ Expected a new field with a default to be registered as 2, got %d (%v)", id, err)
+	}
+	if again, _ := registry.Register(ctx, "storage-events-value", compatible); again != id {
+		t.Errorf("❌ Expected re-registering a schema to return its ID, got %d", again)
+	}
+
+	// A producer on the newer schema writes the extra field; this build skips it.
+	writer := avro.MustParse(compatible)
+	data, err := avro.Marshal(writer, map[string]any{
+		"id": event.ID, "type": string(event.Type), "path": "a.txt", "size": int64(5),
+		"timestamp": event.Timestamp, "source": "storage-server", "schemaVersion": 1,
+		"userId": "alice", "tenantId": "", "metadata": map[string]any{}, "checksum": "abc",
+	})
+	if err != nil {
+		t.Fatalf("❌ Failed to encode with the newer schema: %v", err)
+	}
+	value := append([]byte{0, 0, 0, 0, byte(id)}, data...)
+	decoded, err := serializer.Deserialize(ctx, value, nil)
+	if err != nil || decoded.Path != "a.txt" || decoded.Size != 5 {
+		t.Errorf("❌ Expected data from the newer schema to be read, got %+v (%v)", decoded, err)
+	}
+}
+
+// 🔹 Test Avro events flow through Kafka
+func TestAvroOnKafka(t *testing.T) {
+	registry := events.NewFileRegistry(filepath.Join(t.TempDir(), "schemas.json"))
+	serializer, err := events.NewSerializer(events.FormatAvro, "storage-events", registry)
+	if err != nil {
+		t.Fatalf("❌ Failed to create serializer: %v", err)
+	}
+	if _, err := events.NewSerializer(events.FormatAvro, "storage-events", nil); err == nil {
+		t.Errorf("❌ Expected Avro without a registry to be rejected")
+	}
+	kafkaClient := newMockKafkaClient(t)
+	kafkaClient.SetSerializer("storage-events", serializer)
+
+	event := events.NewFactory("test").New(events.FileUploaded, "a.txt", "")
+	if err := kafkaClient.Publish(context.Background(), "storage-events", event); err != nil {
+		t.Fatalf("❌ Failed to publish: %v", err)
+	}
+
+	var handled []string
+	kafkaClient.RegisterHandler(events.FileUploaded, func(ctx context.Context, event *events.StorageEvent) error {
+		handled = append(handled, event.ID)
+		return nil
+	})
+	value, _, _ := serializer.Serialize(context.Background(), event)
+	messages := make(chan *sarama.ConsumerMessage, 1)
+	messages <- &sarama.ConsumerMessage{Topic: "storage-events", Value: value}
+	close(messages)
+	if err := kafkaClient.ConsumeClaim(tracingSession{ctx: context.Background()}, tracingClaim{messages: messages}); err != nil {
+		t.Fatalf("❌ Failed to consume: %v", err)
+	}
+	if len(handled) != 1 || handled[0] != event.ID {
+		t.Errorf("❌ Expected the Avro event to be handled, got %v", handled)
+	}
+}
+
+// 🔹 Test the Confluent registry client
+func TestConfluentRegistry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/subjects/storage-events-value/versions":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if strings.Contains(body["schema"], "breaking") {
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"error_code":409,"message":"Schema being registered is incompatible"}`))
+				return
+			}
+			w.Write([]byte(`{"id":7}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/schemas/ids/7":
+			json.NewEncoder(w).Encode(map[string]string{"schema": events.AvroSchema})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	registry := events.NewConfluentRegistry(server.URL)
+	if id, err := registry.Register(ctx, "storage-events-value", events.AvroSchema); err != nil || id != 7 {
+		t.Errorf("❌ Expected ID 7, got %d (%v)", id, err)
+	}
+	if _, err := registry.Register(ctx, "storage-events-value", `"breaking"`); !errors.Is(err, events.ErrIncompatibleSchema) {
+		t.Errorf("❌ Expected a conflict to be ErrIncompatibleSchema, got %v", err)
+	}
+	if schema, err := registry.Schema(ctx, 7); err != nil || schema != events.AvroSchema {
+		t.Errorf("❌ Expected the schema back, got %v", err)
+	}
+	if _, err := registry.Schema(ctx, 8); !errors.Is(err, events.ErrSchemaNotFound) {
+		t.Errorf("❌ Expected ErrSchemaNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package storage_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"project-root/internal/storage"
+)
+
+// openCounter counts reads that reach the wrapped backend.
+type openCounter struct {
+	storage.StorageAdapter
+	opens int
+}
+
+func (s *openCounter) OpenFile(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	s.opens++
+	return s.StorageAdapter.OpenFile(ctx, filePath)
+}
+
+// 🔹 Test read-through caching, ETag validation and invalidation
+func TestCachingStorage(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := storage.NewMockAzureStorage()
+	backend := &openCounter{StorageAdapter: mockStorage}
+	cache, err := storage.NewCachingStorage(backend, storage.CacheConfig{Dir: t.TempDir(), MaxBytes: 10})
+	if err != nil {
+		t.Fatalf("❌ Failed to create cache: %v", err)
+	}
+
+	mockStorage.UploadFile(ctx, "a.txt", []byte("aaaaaa"))
+	for i := 0; i < 3; i++ {
+		if data, err := cache.ReadFile(ctx, "a.txt"); err != nil || string(data) != "aaaaaa" {
+			t.Fatalf("❌ Cached read failed: %q (err %v)", data, err)
+		}
+	}
+	if backend.opens != 1 {
+		t.Errorf("❌ Expected 1 backend read, got %d", backend.opens)
+	}
+
+	// A change made elsewhere is detected through the ETag
+	mockStorage.WriteFile(ctx, "a.txt", []byte("AAAAAA"), true)
+	if data, _ := cache.ReadFile(ctx, "a.txt"); string(data) != "AAAAAA" {
+		t.Errorf("❌ Expected fresh content after remote change, got %q", data)
+	}
+
+	// Writes through the cache invalidate it
+	cache.WriteFile(ctx, "a.txt", []byte("bbbbbb"), true)
+	if data, _ := cache.ReadFile(ctx, "a.txt"); string(data) != "bbbbbb" {
+		t.Errorf("❌ Expected fresh content after local write, got %q", data)
+	}
+
+	// The LRU evicts a.txt to make room for c.txt
+	mockStorage.UploadFile(ctx, "c.txt", []byte("cccccc"))
+	cache.ReadFile(ctx, "c.txt")
+	before := backend.opens
+	cache.ReadFile(ctx, "a.txt")
+	if backend.opens != before+1 {
+		t.Errorf("❌ Expected evicted entry to be fetched again")
+	}
+}
+
+// changingBackend overwrites a file the first time it is opened, as a concurrent writer would
+// between the cache's ETag check and its download.
+type changingBackend struct {
+	storage.StorageAdapter
+	changed bool
+}
+
+func (s *changingBackend) OpenFile(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	if !s.changed {
+		s.changed = true
+		s.StorageAdapter.WriteFile(ctx, filePath, []byte("version B"), true)
+	}
+	return s.StorageAdapter.OpenFile(ctx, filePath)
+}
+
+// 🔹 Test a file changed during its download is not cached under the old ETag
+func TestCachingStorageConcurrentChange(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := storage.NewMockAzureStorage()
+	backend := &changingBackend{StorageAdapter: mockStorage}
+	cache, _ := storage.NewCachingStorage(backend, storage.CacheConfig{Dir: t.TempDir(), MaxBytes: 100, RevalidateAfter: time.Hour})
+
+	mockStorage.UploadFile(ctx, "a.txt", []byte("version A"))
+	cache.ReadFile(ctx, "a.txt")
+
+	// Version B is downloaded once more, then served from the cache under its own ETag.
+	counter := &openCounter{StorageAdapter: mockStorage}
+	backend.StorageAdapter = counter
+	if data, _ := cache.ReadFile(ctx, "a.txt"); string(data) != "version B" {
+		t.Errorf("❌ Expected version B, got %q", data)
+	}
+	if data, _ := cache.ReadFile(ctx, "a.txt"); string(data) != "version B" || counter.opens != 1 {
+		t.Errorf("❌ Expected version B cached after 1 download, got %q after %d", data, counter.opens)
+	}
+}
+
+// 🔹 Test invalidating a directory drops every cached file under it
+func TestCachingStorageInvalidateDirectory(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := storage.NewMockAzureStorage()
+	backend := &openCounter{StorageAdapter: mockStorage}
+	cache, _ := storage.NewCachingStorage(backend, storage.CacheConfig{Dir: t.TempDir(), MaxBytes: 100, RevalidateAfter: time.Hour})
+
+	for _, path := range []string{"docs/a.txt", "docs/sub/b.txt", "docsx.txt"} {
+		mockStorage.UploadFile(ctx, path, []byte(path))
+		cache.ReadFile(ctx, path)
+	}
+	cache.Invalidate("docs")
+
+	before := backend.opens
+	for _, path := range []string{"docs/a.txt", "docs/sub/b.txt", "docsx.txt"} {
+		cache.ReadFile(ctx, path)
+	}
+	if backend.opens != before+2 {
+		t.Errorf("❌ Expected the 2 files under docs/ to be fetched again, got %d downloads", backend.opens-before)
+	}
+}
@@ -0,0 +1,128 @@
+package storage_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/IBM/sarama"
+
+	"project-root/internal/events"
+)
+
+// 🔹 Test every format round-trips a StorageEvent
+func TestCloudEventsRoundTrip(t *testing.T) {
+	event := events.NewFactory("storage-server").New(events.FileUploaded, "docs/a.txt", "alice")
+	event.Size = 42
+	event.TenantID = "acme"
+	event.MetaData = map[string]string{"contentType": "text/plain"}
+
+	for _, format := range []events.Format{events.FormatLegacy, events.FormatCloudEventsStructured, events.FormatCloudEventsBinary} {
+		value, headers, err := events.Encode(event, format)
+		if err != nil {
+			t.Fatalf("❌ %s: failed to encode: %v", format, err)
+		}
+		decoded, err := events.Decode(value, headers)
+		if err != nil {
+			t.Fatalf("❌ %s: failed to decode: %v", format, err)
+		}
+		if !decoded.Timestamp.Equal(event.Timestamp) {
+			t.Errorf("❌ %s: expected timestamp %v, got %v", format, event.Timestamp, decoded.Timestamp)
+		}
+		decoded.Timestamp = event.Timestamp
+		if !reflect.DeepEqual(decoded, event) {
+			t.Errorf("❌ %s: expected %+v, got %+v", format, event, decoded)
+		}
+	}
+}
+
+// 🔹 Test the CloudEvents attributes in structured and binary mode
+func TestCloudEventsAttributes(t *testing.T) {
+	event := events.NewFactory("storage-server").New(events.FileDeleted, "a.txt", "alice")
+
+	value, headers, err := events.Encode(event, events.FormatCloudEventsStructured)
+	if err != nil {
+		t.Fatalf("❌ Failed to encode: %v", err)
+	}
+	var structured map[string]any
+	json.Unmarshal(value, &structured)
+	for attribute, want := range map[string]any{
+		"specversion": "1.0",
+		"id":          event.ID,
+		"source":      "storage-server",
+		"type":        "storage.FileDeleted",
+		"subject":     "a.txt",
+	} {
+		if structured[attribute] != want {
+			t.Errorf("❌ Expected %s %v, got %v", attribute, want, structured[attribute])
+		}
+	}
+	if headers["content-type"] != "application/cloudevents+json" {
+		t.Errorf("❌ Expected the structured content type, got %q", headers["content-type"])
+	}
+	// FromJSON reads structured CloudEvents as well as the legacy format.
+	if decoded, err := events.FromJSON(value); err != nil || decoded.ID != event.ID || decoded.Path != "a.txt" {
+		t.Errorf("❌ Expected FromJSON to decode a structured CloudEvent, got %+v (%v)", decoded, err)
+	}
+	legacy, _ := event.ToJSON()
+	if decoded, err := events.FromJSON(legacy); err != nil || decoded.ID != event.ID {
+		t.Errorf("❌ Expected FromJSON to decode the legacy format, got %+v (%v)", decoded, err)
+	}
+
+	value, headers, err = events.Encode(event, events.FormatCloudEventsBinary)
+	if err != nil {
+		t.Fatalf("❌ Failed to encode: %v", err)
+	}
+	if headers["ce_specversion"] != "1.0" || headers["ce_id"] != event.ID || headers["ce_type"] != "storage.FileDeleted" || headers["content-type"] != "application/json" {
+		t.Errorf("❌ Unexpected binary headers: %v", headers)
+	}
+	var data map[string]any
+	json.Unmarshal(value, &data)
+	if data["path"] != "a.txt" || data["specversion"] != nil {
+		t.Errorf("❌ Expected only the data in a binary value, got %s", value)
+	}
+
+	headers["ce_specversion"] = "0.3"
+	if _, err := events.Decode(value, headers); err == nil {
+		t.Errorf("❌ Expected an unsupported specversion to be rejected")
+	}
+	if _, err := events.ParseFormat("protobuf"); err == nil {
+		t.Errorf("❌ Expected an unknown format to be rejected")
+	}
+}
+
+// 🔹 Test consumers handle legacy and CloudEvents messages on the same topic
+func TestCloudEventsConsume(t *testing.T) {
+	kafkaClient := newMockKafkaClient(t)
+	kafkaClient.SetSerializer("storage-events", events.JSONSerializer{Format: events.FormatCloudEventsBinary})
+	factory := events.NewFactory("test")
+	if err := kafkaClient.Publish(context.Background(), "storage-events", factory.New(events.FileUploaded, "a.txt", "")); err != nil {
+		t.Fatalf("❌ Failed to publish as a CloudEvent: %v", err)
+	}
+
+	var handled []string
+	kafkaClient.RegisterHandler(events.FileUploaded, func(ctx context.Context, event *events.StorageEvent) error {
+		handled = append(handled, event.Path)
+		return nil
+	})
+	messages := make(chan *sarama.ConsumerMessage, 3)
+	for i, format := range []events.Format{events.FormatLegacy, events.FormatCloudEventsStructured, events.FormatCloudEventsBinary} {
+		value, headers, err := events.Encode(factory.New(events.FileUploaded, string(format), ""), format)
+		if err != nil {
+			t.Fatalf("❌ Failed to encode: %v", err)
+		}
+		message := &sarama.ConsumerMessage{Topic: "storage-events", Offset: int64(i), Value: value}
+		for key, header := range headers {
+			message.Headers = append(message.Headers, &sarama.RecordHeader{Key: []byte(key), Value: []byte(header)})
+		}
+		messages <- message
+	}
+	close(messages)
+	if err := kafkaClient.ConsumeClaim(tracingSession{ctx: context.Background()}, tracingClaim{messages: messages}); err != nil {
+		t.Fatalf("❌ Failed to consume: %v", err)
+	}
+	if !reflect.DeepEqual(handled, []string{"legacy", "cloudevents-structured", "cloudevents-binary"}) {
+		t.Errorf("❌ Expected every format to be handled, got %v", handled)
+	}
+}
@@ -0,0 +1,181 @@
+package storage_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"project-root/internal/api"
+	"project-root/internal/storage"
+)
+
+// 🔹 Test compression round trip for gzip and zstd
+func TestCompressedStorageRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	content := []byte(strings.Repeat(`{"customer":"acme","amount":42}`+"\n", 1000))
+
+	for _, algorithm := range []string{storage.EncodingGzip, storage.EncodingZstd} {
+		inner := storage.NewMockAzureStorage()
+		compressed, err := storage.NewCompressedStorage(inner, storage.CompressionConfig{
+			Algorithm:    algorithm,
+			ContentTypes: []string{"application/json"},
+		})
+		if err != nil {
+			t.Fatalf("❌ Failed to create %s storage: %v", algorithm, err)
+		}
+
+		if err := compressed.WriteFile(ctx, "data.json", content, false); err != nil {
+			t.Fatalf("❌ %s write failed: %v", algorithm, err)
+		}
+
+		stored, _ := inner.ReadFile(ctx, "data.json")
+		if len(stored) >= len(content)/5 {
+			t.Errorf("❌ %s: expected compressed content, stored %d of %d bytes", algorithm, len(stored), len(content))
+		}
+
+		data, err := compressed.ReadFile(ctx, "data.json")
+		if err != nil || !bytes.Equal(data, content) {
+			t.Errorf("❌ %s round trip mismatch (err %v)", algorithm, err)
+		}
+
+		info, _ := compressed.Stat(ctx, "data.json")
+		if info.Size != int64(len(content)) || info.Metadata[storage.MetaContentEncoding] != "" {
+			t.Errorf("❌ %s: unexpected stat %+v", algorithm, info)
+		}
+		encoded, _ := compressed.Stat(storage.WithEncodedContent(ctx), "data.json")
+		if encoded.Size != int64(len(stored)) || encoded.Metadata[storage.MetaContentEncoding] != algorithm {
+			t.Errorf("❌ %s: unexpected encoded stat %+v", algorithm, encoded)
+		}
+
+		// The uncompressed size is stored with the content, not by a later metadata update.
+		if raw, _ := inner.Stat(ctx, "data.json"); raw.Metadata["uncompressed_size"] == "" {
+			t.Errorf("❌ %s: expected the uncompressed size in the stored metadata", algorithm)
+		}
+	}
+}
+
+// 🔹 Test legacy files, skipped content types and encoded reads
+func TestCompressedStorageEncodedAndLegacy(t *testing.T) {
+	ctx := context.Background()
+	inner := storage.NewMockAzureStorage()
+	compressed, _ := storage.NewCompressedStorage(inner, storage.CompressionConfig{
+		Algorithm:    storage.EncodingGzip,
+		ContentTypes: []string{"text/"},
+	})
+
+	inner.UploadFile(ctx, "legacy.txt", []byte("legacy"))
+	if data, err := compressed.ReadFile(ctx, "legacy.txt"); err != nil || string(data) != "legacy" {
+		t.Errorf("❌ Legacy read failed: %q (err %v)", data, err)
+	}
+
+	compressed.WriteFile(ctx, "image.png", []byte("not text"), false)
+	if stored, _ := inner.ReadFile(ctx, "image.png"); string(stored) != "not text" {
+		t.Errorf("❌ Expected non-matching content type to be stored as-is")
+	}
+
+	compressed.WriteFile(ctx, "notes.txt", []byte("hello hello hello"), false)
+	rc, err := compressed.OpenFile(storage.WithEncodedContent(ctx), "notes.txt")
+	if err != nil {
+		t.Fatalf("❌ Encoded open failed: %v", err)
+	}
+	defer rc.Close()
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		t.Fatalf("❌ Expected gzip bytes: %v", err)
+	}
+	if data, _ := io.ReadAll(zr); string(data) != "hello hello hello" {
+		t.Errorf("❌ Unexpected decoded content %q", data)
+	}
+}
+
+// 🔹 Test downloads are served encoded only to clients that accept the encoding
+func TestCompressedDownload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	compressed, _ := storage.NewCompressedStorage(storage.NewLocalStorage(t.TempDir()), storage.CompressionConfig{
+		Algorithm:    storage.EncodingGzip,
+		ContentTypes: []string{"text/"},
+	})
+	content := strings.Repeat("hello ", 100)
+	compressed.WriteFile(ctx, "notes.txt", []byte(content), false)
+	router := api.SetupRoutes(&api.API{Storage: compressed, ServeCompressed: true})
+
+	req := httptest.NewRequest(http.MethodGet, "/read/notes.txt", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != storage.EncodingGzip {
+		t.Fatalf("❌ Expected a gzip response, got headers %v", rec.Header())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("❌ Expected gzip bytes: %v", err)
+	}
+	if data, _ := io.ReadAll(zr); string(data) != content {
+		t.Errorf("❌ Unexpected decoded content %q", data)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/read/notes.txt", nil))
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != content {
+		t.Errorf("❌ Expected plain content without Accept-Encoding, got %v %q", rec.Header(), rec.Body.String())
+	}
+	if rec.Header().Get("Content-Length") != strconv.Itoa(len(content)) {
+		t.Errorf("❌ Expected the uncompressed length, got %q", rec.Header().Get("Content-Length"))
+	}
+}
+
+// 🔹 Test deduplicated content is compressed and served with its own encoding
+func TestCompressedDedupDownload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	backend := storage.NewLocalStorage(t.TempDir())
+	compressed, _ := storage.NewCompressedStorage(backend, storage.CompressionConfig{
+		Algorithm:    storage.EncodingGzip,
+		ContentTypes: []string{"text/"},
+	})
+	dedup := storage.NewDedupStorage(compressed, storage.DedupConfig{})
+	content := strings.Repeat("hello ", 100)
+	if err := dedup.WriteFile(ctx, "notes.txt", []byte(content), false); err != nil {
+		t.Fatalf("❌ Failed to write: %v", err)
+	}
+
+	reference, _ := backend.Stat(ctx, "notes.txt")
+	if reference.Metadata[storage.MetaContentEncoding] != "" {
+		t.Errorf("❌ Expected the reference to be stored uncompressed, got %v", reference.Metadata)
+	}
+	blob, err := backend.Stat(ctx, storage.ReferencedBlob(reference.Metadata))
+	if err != nil || blob.Metadata[storage.MetaContentEncoding] != storage.EncodingGzip {
+		t.Fatalf("❌ Expected the content blob to be compressed, got %+v (err %v)", blob, err)
+	}
+
+	router := api.SetupRoutes(&api.API{Storage: dedup, ServeCompressed: true})
+	req := httptest.NewRequest(http.MethodGet, "/read/notes.txt", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != storage.EncodingGzip {
+		t.Fatalf("❌ Expected a gzip response, got headers %v", rec.Header())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("❌ Expected gzip bytes: %v", err)
+	}
+	if data, _ := io.ReadAll(zr); string(data) != content {
+		t.Errorf("❌ Unexpected decoded content %q", data)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/read/notes.txt", nil))
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != content {
+		t.Errorf("❌ Expected plain content without Accept-Encoding, got %v %q", rec.Header(), rec.Body.String())
+	}
+}
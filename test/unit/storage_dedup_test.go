@@ -0,0 +1,126 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"project-root/internal/storage"
+)
+
+// 🔹 Test deduplication, reference counting and garbage collection
+func TestDedupStorage(t *testing.T) {
+	ctx := context.Background()
+	dedup := storage.NewDedupStorage(storage.NewLocalStorage(t.TempDir()), storage.DedupConfig{SpoolDir: t.TempDir()})
+
+	attachment := bytes.Repeat([]byte("attachment"), 1000)
+	for _, path := range []string{"a/report.pdf", "b/report.pdf", "c/copy.pdf"} {
+		if err := dedup.WriteFile(ctx, path, attachment, false); err != nil {
+			t.Fatalf("❌ Failed to write %s: %v", path, err)
+		}
+	}
+
+	stats, _ := dedup.Stats(ctx)
+	if stats.Blobs != 1 || stats.Files != 3 || stats.BytesSaved != int64(2*len(attachment)) {
+		t.Errorf("❌ Unexpected stats %+v", stats)
+	}
+
+	data, err := dedup.ReadFile(ctx, "b/report.pdf")
+	if err != nil || !bytes.Equal(data, attachment) {
+		t.Fatalf("❌ Read through reference failed (err %v)", err)
+	}
+	info, _ := dedup.Stat(ctx, "b/report.pdf")
+	if info.Size != int64(len(attachment)) {
+		t.Errorf("❌ Expected logical size %d, got %d", len(attachment), info.Size)
+	}
+
+	files, _ := dedup.ListFiles(ctx, ".")
+	if len(files) != 3 {
+		t.Errorf("❌ Expected only logical files in listing, got %v", files)
+	}
+
+	// Referenced content survives garbage collection
+	dedup.DeleteFile(ctx, "a/report.pdf")
+	dedup.DeleteFile(ctx, "b/report.pdf")
+	result, err := dedup.CollectGarbage(ctx, 0)
+	if err != nil || result.Deleted != 0 {
+		t.Fatalf("❌ Expected no blobs collected, got %+v (err %v)", result, err)
+	}
+	if data, _ := dedup.ReadFile(ctx, "c/copy.pdf"); !bytes.Equal(data, attachment) {
+		t.Errorf("❌ Remaining reference lost its content")
+	}
+
+	// Unreferenced content is collected
+	dedup.DeleteFile(ctx, "c/copy.pdf")
+	result, err = dedup.CollectGarbage(ctx, 0)
+	if err != nil || result.Deleted != 1 || result.FreedBytes != int64(len(attachment)) {
+		t.Errorf("❌ Expected 1 blob collected, got %+v (err %v)", result, err)
+	}
+}
+
+// 🔹 Test a collector in another process keeps content uploaded after it started
+func TestDedupGarbageCollectionAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	base := t.TempDir()
+	server := storage.NewDedupStorage(storage.NewLocalStorage(base), storage.DedupConfig{})
+	worker := storage.NewDedupStorage(storage.NewLocalStorage(base), storage.DedupConfig{})
+	server.WriteFile(ctx, "early.txt", []byte("uploaded before the worker started"), false)
+	if _, err := worker.CollectGarbage(ctx, 0); err != nil {
+		t.Fatalf("❌ Initial collection failed: %v", err)
+	}
+
+	server.WriteFile(ctx, "late.txt", []byte("uploaded after the worker started"), false)
+	if result, err := worker.CollectGarbage(ctx, 0); err != nil || result.Deleted != 0 {
+		t.Fatalf("❌ Expected the server's content to be kept, got %+v (err %v)", result, err)
+	}
+	if data, err := server.ReadFile(ctx, "late.txt"); err != nil || string(data) != "uploaded after the worker started" {
+		t.Fatalf("❌ Content lost after collection: %q (err %v)", data, err)
+	}
+	if stats, _ := worker.Stats(ctx); stats.Files != 2 || stats.Blobs != 2 {
+		t.Errorf("❌ Expected the worker to see the server's file in stats, got %+v", stats)
+	}
+
+	// Unreferenced content waits for the grace period.
+	server.DeleteFile(ctx, "late.txt")
+	if result, _ := worker.CollectGarbage(ctx, time.Hour); result.Deleted != 0 {
+		t.Errorf("❌ Expected recent content to be kept during the grace period, got %+v", result)
+	}
+	if result, _ := worker.CollectGarbage(ctx, 0); result.Deleted != 1 {
+		t.Errorf("❌ Expected the unreferenced content to be collected, got %+v", result)
+	}
+}
+
+// 🔹 Test content is stored per tenant and named by HMAC with a hash key
+func TestDedupNamespaces(t *testing.T) {
+	ctx := context.Background()
+	inner := storage.NewLocalStorage(t.TempDir())
+	dedup := storage.NewDedupStorage(inner, storage.DedupConfig{HashKey: bytes.Repeat([]byte("k"), 32)})
+
+	content := []byte("same content")
+	for _, tenant := range []string{"acme", "globex"} {
+		if err := dedup.WriteFile(storage.WithTenant(ctx, tenant), "tenants/"+tenant+"/a.txt", content, false); err != nil {
+			t.Fatalf("❌ Failed to write for %s: %v", tenant, err)
+		}
+	}
+
+	blobs, _ := inner.ListFiles(ctx, ".index/cas")
+	if len(blobs) != 2 {
+		t.Fatalf("❌ Expected one blob per tenant, got %v", blobs)
+	}
+	sum := sha256.Sum256(content)
+	for _, blob := range blobs {
+		if strings.Contains(blob, hex.EncodeToString(sum[:])) {
+			t.Errorf("❌ Blob name reveals the content hash: %s", blob)
+		}
+	}
+	if !strings.Contains(blobs[0], "/acme/") || !strings.Contains(blobs[1], "/globex/") {
+		t.Errorf("❌ Expected blobs under tenant namespaces, got %v", blobs)
+	}
+	if data, err := dedup.ReadFile(ctx, "tenants/globex/a.txt"); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("❌ Read through namespaced blob failed: %q (err %v)", data, err)
+	}
+}
@@ -0,0 +1,172 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"project-root/internal/storage"
+)
+
+// writeKeyFile creates a keyfile with the given key IDs and current key.
+func writeKeyFile(t *testing.T, path, current string, ids ...string) {
+	t.Helper()
+	keys := ""
+	for i, id := range ids {
+		key := make([]byte, 32)
+		key[0] = byte(i + 1)
+		if i > 0 {
+			keys += ","
+		}
+		keys += fmt.Sprintf("%q: %q", id, base64.StdEncoding.EncodeToString(key))
+	}
+	content := fmt.Sprintf(`{"current": %q, "keys": {%s}}`, current, keys)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("❌ Failed to write keyfile: %v", err)
+	}
+}
+
+// 🔹 Test encrypted round trip, legacy plaintext and tamper detection
+func TestEncryptedStorageRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	keyFile := filepath.Join(t.TempDir(), "kek.json")
+	writeKeyFile(t, keyFile, "k1", "k1")
+	keys, err := storage.NewLocalKeyProvider(keyFile)
+	if err != nil {
+		t.Fatalf("❌ Failed to load keys: %v", err)
+	}
+
+	inner := storage.NewMockAzureStorage()
+	encrypted := storage.NewEncryptedStorage(inner, keys)
+
+	// Larger than one chunk so chunking is exercised
+	plaintext := make([]byte, 200*1024+7)
+	rand.Read(plaintext)
+	if err := encrypted.WriteFile(ctx, "secret.bin", plaintext, false); err != nil {
+		t.Fatalf("❌ Failed to write encrypted file: %v", err)
+	}
+
+	stored, _ := inner.ReadFile(ctx, "secret.bin")
+	if bytes.Contains(stored, plaintext[:64]) {
+		t.Errorf("❌ Backend holds plaintext")
+	}
+
+	data, err := encrypted.ReadFile(ctx, "secret.bin")
+	if err != nil || !bytes.Equal(data, plaintext) {
+		t.Fatalf("❌ Round trip mismatch (err %v)", err)
+	}
+	info, _ := encrypted.Stat(ctx, "secret.bin")
+	if info.Size != int64(len(plaintext)) || len(info.Metadata) != 0 {
+		t.Errorf("❌ Expected plaintext size and hidden envelope, got %+v", info)
+	}
+
+	// Legacy plaintext objects stay readable
+	inner.UploadFile(ctx, "legacy.txt", []byte("plain"))
+	if data, err := encrypted.ReadFile(ctx, "legacy.txt"); err != nil || string(data) != "plain" {
+		t.Errorf("❌ Legacy read failed: %q (err %v)", data, err)
+	}
+
+	// Truncated ciphertext fails authentication
+	meta, _ := inner.Stat(ctx, "secret.bin")
+	inner.WriteStream(ctx, "secret.bin", bytes.NewReader(stored[:64*1024+16]), storage.WriteOptions{Overwrite: true, Metadata: meta.Metadata})
+	if _, err := encrypted.ReadFile(ctx, "secret.bin"); err == nil {
+		t.Errorf("❌ Expected truncated ciphertext to fail")
+	}
+}
+
+// 🔹 Test key rotation re-wraps data keys
+func TestEncryptedStorageRotateKeys(t *testing.T) {
+	ctx := context.Background()
+	keyFile := filepath.Join(t.TempDir(), "kek.json")
+	writeKeyFile(t, keyFile, "k1", "k1")
+	oldKeys, _ := storage.NewLocalKeyProvider(keyFile)
+
+	inner := storage.NewMockAzureStorage()
+	storage.NewEncryptedStorage(inner, oldKeys).WriteFile(ctx, "doc.txt", []byte("hello"), false)
+
+	writeKeyFile(t, keyFile, "k2", "k1", "k2")
+	newKeys, _ := storage.NewLocalKeyProvider(keyFile)
+	encrypted := storage.NewEncryptedStorage(inner, newKeys)
+
+	rotated, err := encrypted.RotateKeys(ctx, ".")
+	if err != nil || rotated != 1 {
+		t.Fatalf("❌ Expected 1 rotated file, got %d (err %v)", rotated, err)
+	}
+
+	// Only the new key is needed after rotation
+	writeKeyFile(t, keyFile, "k2", "k0", "k2")
+	onlyNew, _ := storage.NewLocalKeyProvider(keyFile)
+	data, err := storage.NewEncryptedStorage(inner, onlyNew).ReadFile(ctx, "doc.txt")
+	if err != nil || string(data) != "hello" {
+		t.Errorf("❌ Read after rotation failed: %q (err %v)", data, err)
+	}
+}
+
+// 🔹 Test key rotation reaches the content blobs of deduplicated files
+func TestEncryptedStorageRotateDedupContent(t *testing.T) {
+	ctx := context.Background()
+	keyFile := filepath.Join(t.TempDir(), "kek.json")
+	writeKeyFile(t, keyFile, "k1", "k1")
+	oldKeys, _ := storage.NewLocalKeyProvider(keyFile)
+
+	inner := storage.NewLocalStorage(t.TempDir())
+	dedupConfig := storage.DedupConfig{HashKey: bytes.Repeat([]byte("k"), 32)}
+	old := storage.NewDedupStorage(storage.NewEncryptedStorage(inner, oldKeys), dedupConfig)
+	if err := old.WriteFile(ctx, "docs/report.txt", []byte("deduplicated"), false); err != nil {
+		t.Fatalf("❌ Failed to write: %v", err)
+	}
+
+	writeKeyFile(t, keyFile, "k2", "k1", "k2")
+	newKeys, _ := storage.NewLocalKeyProvider(keyFile)
+	if rotated, err := storage.NewEncryptedStorage(inner, newKeys).RotateKeys(ctx, "."); err != nil || rotated != 2 {
+		t.Fatalf("❌ Expected the reference and its blob to be rotated, got %d (err %v)", rotated, err)
+	}
+
+	// Retire the old key
+	writeKeyFile(t, keyFile, "k2", "k0", "k2")
+	onlyNew, _ := storage.NewLocalKeyProvider(keyFile)
+	data, err := storage.NewDedupStorage(storage.NewEncryptedStorage(inner, onlyNew), dedupConfig).ReadFile(ctx, "docs/report.txt")
+	if err != nil || string(data) != "deduplicated" {
+		t.Errorf("❌ Read after rotation failed: %q (err %v)", data, err)
+	}
+}
+
+// 🔹 Test that content is decrypted with its own key when metadata belongs to another version
+func TestEncryptedStorageKeyTravelsWithContent(t *testing.T) {
+	ctx := context.Background()
+	keyFile := filepath.Join(t.TempDir(), "kek.json")
+	writeKeyFile(t, keyFile, "k1", "k1")
+	oldKeys, _ := storage.NewLocalKeyProvider(keyFile)
+
+	inner := storage.NewMockAzureStorage()
+	storage.NewEncryptedStorage(inner, oldKeys).WriteFile(ctx, "doc.txt", []byte("first"), false)
+	writeKeyFile(t, keyFile, "k2", "k1", "k2")
+	newKeys, _ := storage.NewLocalKeyProvider(keyFile)
+	encrypted := storage.NewEncryptedStorage(inner, newKeys)
+	if rotated, err := encrypted.RotateKeys(ctx, "."); err != nil || rotated != 1 {
+		t.Fatalf("❌ Expected 1 rotated file, got %d (err %v)", rotated, err)
+	}
+	first, _ := inner.ReadFile(ctx, "doc.txt")
+	firstInfo, _ := inner.Stat(ctx, "doc.txt")
+
+	// An overwrite racing with a rotation leaves the rotated key beside new content
+	if err := encrypted.WriteFile(ctx, "doc.txt", []byte("second"), true); err != nil {
+		t.Fatalf("❌ Failed to overwrite: %v", err)
+	}
+	secondInfo, _ := inner.Stat(ctx, "doc.txt")
+	inner.SetMetadata(ctx, "doc.txt", firstInfo.Metadata)
+	if data, err := encrypted.ReadFile(ctx, "doc.txt"); err != nil || string(data) != "second" {
+		t.Errorf("❌ Expected the new content, got %q (err %v)", data, err)
+	}
+
+	// Old content beside the new version's metadata, as after an interrupted write
+	inner.WriteStream(ctx, "doc.txt", bytes.NewReader(first), storage.WriteOptions{Overwrite: true, Metadata: secondInfo.Metadata})
+	if data, err := encrypted.ReadFile(ctx, "doc.txt"); err != nil || string(data) != "first" {
+		t.Errorf("❌ Expected the old content, got %q (err %v)", data, err)
+	}
+}
@@ -0,0 +1,105 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/google/uuid"
+
+	"project-root/internal/events"
+)
+
+// 🔹 Test the factory fills in the event envelope
+func TestEventFactory(t *testing.T) {
+	factory := events.NewFactory("storage-server")
+	before := time.Now()
+	first := factory.New(events.FileUploaded, "a.txt", "alice")
+	second := factory.New(events.FileDeleted, "a.txt", "")
+
+	if _, err := uuid.Parse(first.ID); err != nil || first.ID == second.ID {
+		t.Errorf("❌ Expected unique UUIDs, got %q and %q", first.ID, second.ID)
+	}
+	if first.Timestamp.Location() != time.UTC || first.Timestamp.Before(before.Add(-time.Second)) {
+		t.Errorf("❌ Expected the current UTC time, got %v", first.Timestamp)
+	}
+	if first.Source != "storage-server" || first.SchemaVersion != events.SchemaVersion || first.UserID != "alice" {
+		t.Errorf("❌ Unexpected envelope: %+v", first)
+	}
+	if second.UserID != events.AnonymousActor {
+		t.Errorf("❌ Expected a missing actor to be recorded as %q, got %q", events.AnonymousActor, second.UserID)
+	}
+	for _, event := range []*events.StorageEvent{first, second} {
+		if err := event.Validate(); err != nil {
+			t.Errorf("❌ Expected a factory event to be valid: %v", err)
+		}
+	}
+}
+
+// 🔹 Test malformed events are rejected with every problem listed
+func TestEventValidation(t *testing.T) {
+	factory := events.NewFactory("test")
+	newer := factory.New(events.FileUploaded, "a.txt", "alice")
+	newer.SchemaVersion = events.SchemaVersion + 1
+	moved := factory.New(events.FileMoved, "b.txt", "alice")
+	negative := factory.New(events.FileUploaded, "a.txt", "alice")
+	negative.Size = -1
+
+	for name, tc := range map[string]struct {
+		event    *events.StorageEvent
+		problems []string
+	}{
+		"empty":        {&events.StorageEvent{Type: events.FileUploaded}, []string{"invalid id", "path is required", "timestamp is required", "source is required", "schema version 0", "actor is required"}},
+		"unknown type": {&events.StorageEvent{Type: "FileRenamed"}, []string{"unknown type"}},
+		"newer schema": {newer, []string{"schema version 2"}},
+		"move source":  {moved, []string{"sourcePath metadata is required"}},
+		"negative":     {negative, []string{"negative size"}},
+	} {
+		err := tc.event.Validate()
+		if !errors.Is(err, events.ErrInvalidEvent) {
+			t.Errorf("❌ %s: expected ErrInvalidEvent, got %v", name, err)
+			continue
+		}
+		for _, problem := range tc.problems {
+			if !strings.Contains(err.Error(), problem) {
+				t.Errorf("❌ %s: expected %q in %q", name, problem, err)
+			}
+		}
+	}
+}
+
+// 🔹 Test invalid events are neither published nor handed to handlers
+func TestEventValidationOnKafka(t *testing.T) {
+	kafkaClient := newMockKafkaClient(t)
+	ctx := context.Background()
+
+	if err := kafkaClient.Publish(ctx, "storage-events", &events.StorageEvent{Type: events.FileUploaded, Path: "a.txt"}); !errors.Is(err, events.ErrInvalidEvent) {
+		t.Errorf("❌ Expected publishing an event without envelope to fail, got %v", err)
+	}
+	valid := events.NewFactory("test").New(events.FileUploaded, "a.txt", "alice")
+	if err := kafkaClient.Publish(ctx, "storage-events", valid); err != nil {
+		t.Fatalf("❌ Failed to publish a valid event: %v", err)
+	}
+
+	var handled []string
+	kafkaClient.RegisterHandler(events.FileUploaded, func(ctx context.Context, event *events.StorageEvent) error {
+		handled = append(handled, event.ID)
+		return nil
+	})
+	newer := *valid
+	newer.SchemaVersion = events.SchemaVersion + 1
+	messages := make(chan *sarama.ConsumerMessage, 3)
+	messages <- &sarama.ConsumerMessage{Topic: "storage-events", Value: []byte("not json")}
+	messages <- eventMessage(t, &newer)
+	messages <- eventMessage(t, valid)
+	close(messages)
+	if err := kafkaClient.ConsumeClaim(tracingSession{ctx: ctx}, tracingClaim{messages: messages}); err != nil {
+		t.Fatalf("❌ Failed to consume: %v", err)
+	}
+	if len(handled) != 1 || handled[0] != valid.ID {
+		t.Errorf("❌ Expected only the valid event to be handled, got %v", handled)
+	}
+}
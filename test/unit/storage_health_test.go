@@ -0,0 +1,97 @@
+package storage_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"project-root/internal/api"
+	"project-root/internal/auth"
+	"project-root/internal/health"
+	"project-root/internal/storage"
+)
+
+// 🔹 Test per-dependency readiness reports and probe timeouts
+func TestHealthChecker(t *testing.T) {
+	checker := health.NewChecker(time.Second, map[string]time.Duration{"slow": 20 * time.Millisecond})
+	checker.Add(health.Check{Name: "storage", Probe: func(context.Context) error { return nil }})
+
+	rec := httptest.NewRecorder()
+	checker.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var report health.Report
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	if rec.Code != http.StatusOK || report.Status != health.StatusOK || report.Checks["storage"].Status != health.StatusOK {
+		t.Fatalf("❌ Expected ready, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	checker.Add(health.Check{Name: "kafka", Probe: func(context.Context) error { return errors.New("no brokers") }})
+	checker.Add(health.Check{Name: "slow", Probe: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	start := time.Now()
+	rec = httptest.NewRecorder()
+	checker.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	report = health.Report{}
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	if rec.Code != http.StatusServiceUnavailable || report.Status != health.StatusUnavailable {
+		t.Fatalf("❌ Expected 503 unavailable, got %d %s", rec.Code, rec.Body.String())
+	}
+	if report.Checks["storage"].Status != health.StatusOK || report.Checks["kafka"].Error != "no brokers" {
+		t.Errorf("❌ Expected per-dependency results, got %+v", report.Checks)
+	}
+	if report.Checks["slow"].Status != health.StatusUnavailable || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("❌ Expected the slow check to time out quickly, got %+v after %s", report.Checks["slow"], time.Since(start))
+	}
+
+	// Liveness does not depend on dependencies.
+	rec = httptest.NewRecorder()
+	checker.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("❌ Expected liveness to pass, got %d", rec.Code)
+	}
+}
+
+// 🔹 Test local storage probes and unauthenticated health routes on the API
+func TestHealthEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	backend := storage.NewLocalStorage(t.TempDir())
+	if err := storage.CheckHealth(context.Background(), backend); err != nil {
+		t.Fatalf("❌ Expected writable base path to be healthy: %v", err)
+	}
+
+	blocked := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(blocked, []byte("not a directory"), 0644)
+	if err := storage.CheckHealth(context.Background(), storage.NewLocalStorage(blocked)); err == nil {
+		t.Fatalf("❌ Expected a base path that is a file to be unhealthy")
+	}
+
+	keys, _ := auth.NewAPIKeyAuthenticator([]auth.APIKey{{Name: "ops", Hash: auth.HashAPIKey("key")}})
+	checker := health.NewChecker(0, nil)
+	checker.Add(health.Check{Name: "storage", Probe: func(ctx context.Context) error {
+		return storage.CheckHealth(ctx, backend)
+	}})
+	router := api.SetupRoutes(&api.API{Storage: backend, Auth: keys, Health: checker})
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("❌ Expected %s to answer without credentials, got %d", path, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/list/.", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("❌ Expected other routes to still require credentials, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,154 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"project-root/internal/events"
+	"project-root/internal/kafka"
+)
+
+// newAsyncKafkaClient connects an async producer to a mock broker leading storage-events and
+// storage-events.dlq; produce requests for storage-events fail with produceErr when set.
+func newAsyncKafkaClient(t *testing.T, producer kafka.ProducerConfig, produceErr sarama.KError) (*kafka.KafkaClient, *sarama.MockBroker) {
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+	produce := sarama.NewMockProduceResponse(t)
+	if produceErr != sarama.ErrNoError {
+		produce.SetError("storage-events", 0, produceErr)
+	}
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("storage-events", 0, broker.BrokerID()).
+			SetLeader("storage-events.dlq", 0, broker.BrokerID()),
+		"ProduceRequest": produce,
+	})
+	producer.Mode = kafka.ProducerAsync
+	producer.RequiredAcks = intPtr(-1)
+	client, err := kafka.NewKafkaClient(kafka.Config{Brokers: []string{broker.Addr()}, GroupID: "test", Producer: producer})
+	if err != nil {
+		t.Fatalf("❌ Failed to create Kafka client: %v", err)
+	}
+	t.Cleanup(client.Close)
+	return client, broker
+}
+
+func produceRequests(broker *sarama.MockBroker) int {
+	count := 0
+	for _, exchange := range broker.History() {
+		if _, ok := exchange.Request.(*sarama.ProduceRequest); ok {
+			count++
+		}
+	}
+	return count
+}
+
+// 🔹 Test async publishing batches messages, bounds the queue and flushes on Close
+func TestKafkaAsyncProducer(t *testing.T) {
+	// Nothing is sent right away: batches wait for 1000 messages or half a second.
+	client, broker := newAsyncKafkaClient(t, kafka.ProducerConfig{BatchSize: 1000, Linger: 500 * time.Millisecond, QueueSize: 2}, sarama.ErrNoError)
+	factory := events.NewFactory("test")
+	before := scrapeMetrics(promhttp.Handler())
+
+	for _, path := range []string{"a.txt", "b.txt"} {
+		if err := client.Publish(context.Background(), "storage-events", factory.New(events.FileUploaded, path, "")); err != nil {
+			t.Fatalf("❌ Failed to queue %s: %v", path, err)
+		}
+	}
+	if err := client.Publish(context.Background(), "storage-events", factory.New(events.FileUploaded, "c.txt", "")); !errors.Is(err, kafka.ErrQueueFull) {
+		t.Errorf("❌ Expected ErrQueueFull beyond the queue size, got %v", err)
+	}
+	if metrics := scrapeMetrics(promhttp.Handler()); metrics["kafka_producer_queue_depth"] != 2 {
+		t.Errorf("❌ Expected 2 queued messages, got %v", metrics["kafka_producer_queue_depth"])
+	}
+	if produceRequests(broker) != 0 {
+		t.Errorf("❌ Expected the batch to wait for its linger time")
+	}
+
+	client.Close()
+	if produceRequests(broker) == 0 {
+		t.Errorf("❌ Expected Close to send the queued batch")
+	}
+	after := scrapeMetrics(promhttp.Handler())
+	success := `kafka_published_messages_total{result="success",topic="storage-events"}`
+	if delta := after[success] - before[success]; delta != 2 {
+		t.Errorf("❌ Expected 2 delivered messages, got %v", delta)
+	}
+	if after["kafka_producer_queue_depth"] != 0 {
+		t.Errorf("❌ Expected an empty queue after Close, got %v", after["kafka_producer_queue_depth"])
+	}
+	if err := client.Publish(context.Background(), "storage-events", factory.New(events.FileUploaded, "d.txt", "")); !errors.Is(err, kafka.ErrClosed) {
+		t.Errorf("❌ Expected ErrClosed after Close, got %v", err)
+	}
+}
+
+// 🔹 Test failed async deliveries go to the failure handler, then the dead-letter topic
+func TestKafkaAsyncDeliveryFailures(t *testing.T) {
+	producer := kafka.ProducerConfig{DeadLetterTopic: "storage-events.dlq"}
+	client, _ := newAsyncKafkaClient(t, producer, sarama.ErrMessageSizeTooLarge)
+	factory := events.NewFactory("test")
+
+	var mu sync.Mutex
+	var requeued []string
+	accept := true
+	client.SetFailureHandler(func(_ context.Context, topic string, event *events.StorageEvent, err error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !accept {
+			return errors.New("outbox unavailable")
+		}
+		requeued = append(requeued, topic+"/"+event.Path)
+		return nil
+	})
+
+	before := scrapeMetrics(promhttp.Handler())
+	if err := client.Publish(context.Background(), "storage-events", factory.New(events.FileUploaded, "a.txt", "")); err != nil {
+		t.Fatalf("❌ Failed to queue: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		done := len(requeued) > 0
+		mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	if len(requeued) != 1 || requeued[0] != "storage-events/a.txt" {
+		t.Errorf("❌ Expected the failed event to be requeued, got %v", requeued)
+	}
+	accept = false
+	mu.Unlock()
+
+	// With the handler failing, the event goes to the dead-letter topic.
+	if err := client.Publish(context.Background(), "storage-events", factory.New(events.FileUploaded, "b.txt", "")); err != nil {
+		t.Fatalf("❌ Failed to queue: %v", err)
+	}
+	deadLetter := `kafka_undeliverable_messages_total{outcome="dead_letter",topic="storage-events"}`
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if scrapeMetrics(promhttp.Handler())[deadLetter] > before[deadLetter] {
+			break
+		}
+	}
+	client.Close()
+	after := scrapeMetrics(promhttp.Handler())
+	for outcome, want := range map[string]float64{"requeued": 1, "dead_letter": 1} {
+		name := `kafka_undeliverable_messages_total{outcome="` + outcome + `",topic="storage-events"}`
+		if delta := after[name] - before[name]; delta != want {
+			t.Errorf("❌ Expected %v %s messages, got %v", want, outcome, delta)
+		}
+	}
+	dlq := `kafka_published_messages_total{result="success",topic="storage-events.dlq"}`
+	if delta := after[dlq] - before[dlq]; delta != 1 {
+		t.Errorf("❌ Expected the dead letter to be delivered, got %v", delta)
+	}
+}
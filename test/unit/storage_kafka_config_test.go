@@ -0,0 +1,158 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IBM/sarama"
+
+	"project-root/internal/events"
+	"project-root/internal/kafka"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// 🔹 Test invalid Kafka settings are rejected before connecting
+func TestKafkaConfigValidation(t *testing.T) {
+	valid := kafka.Config{Brokers: []string{"localhost:1"}, GroupID: "test", Producer: kafka.ProducerConfig{RequiredAcks: intPtr(-1), Retries: intPtr(3)}}
+	cases := map[string]func(*kafka.Config){
+		"acks":        func(c *kafka.Config) { c.Producer.RequiredAcks = intPtr(2) },
+		"retries":     func(c *kafka.Config) { c.Producer.Retries = intPtr(-1) },
+		"compression": func(c *kafka.Config) { c.Producer.Compression = "brotli" },
+		"idempotence": func(c *kafka.Config) { c.Producer.Idempotent, c.Producer.RequiredAcks = true, intPtr(1) },
+		"offset":      func(c *kafka.Config) { c.Consumer.InitialOffset = "latest" },
+		"rebalance":   func(c *kafka.Config) { c.Consumer.RebalanceStrategy = "random" },
+		"version":     func(c *kafka.Config) { c.Version = "three" },
+		"mode":        func(c *kafka.Config) { c.Producer.Mode = "batch" },
+		"linger":      func(c *kafka.Config) { c.Producer.Mode, c.Producer.BatchSize = kafka.ProducerAsync, 100 },
+		"sasl":        func(c *kafka.Config) { c.SASL.Mechanism = "GSSAPI" },
+		"tls": func(c *kafka.Config) {
+			c.TLS = kafka.TLSConfig{Enabled: true, CAFile: filepath.Join(t.TempDir(), "missing.crt")}
+		},
+	}
+	for name, mutate := range cases {
+		config := valid
+		mutate(&config)
+		if client, err := kafka.NewKafkaClient(config); err == nil {
+			client.Close()
+			t.Errorf("❌ %s: expected the configuration to be rejected", name)
+		} else if strings.Contains(err.Error(), "failed to connect") {
+			t.Errorf("❌ %s: expected validation to fail before connecting, got %v", name, err)
+		}
+	}
+}
+
+// 🔹 Test unset acknowledgements wait for all in-sync replicas
+func TestKafkaProducerDefaults(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(mockClusterHandlers(t, broker))
+
+	client, err := kafka.NewKafkaClient(kafka.Config{Brokers: []string{broker.Addr()}, GroupID: "test"})
+	if err != nil {
+		t.Fatalf("❌ Failed to create Kafka client: %v", err)
+	}
+	defer client.Close()
+	if err := client.Publish(context.Background(), "storage-events", events.NewFactory("test").New(events.FileUploaded, "a.txt", "")); err != nil {
+		t.Fatalf("❌ Failed to publish: %v", err)
+	}
+
+	produced := false
+	for _, exchange := range broker.History() {
+		if request, ok := exchange.Request.(*sarama.ProduceRequest); ok {
+			produced = true
+			if request.RequiredAcks != sarama.WaitForAll {
+				t.Errorf("❌ Expected all in-sync replicas to acknowledge by default, got %d", request.RequiredAcks)
+			}
+		}
+	}
+	if !produced {
+		t.Errorf("❌ Expected a produce request")
+	}
+}
+
+// mockClusterHandlers answers metadata and produce requests for storage-events on broker.
+func mockClusterHandlers(t *testing.T, broker *sarama.MockBroker) map[string]sarama.MockResponse {
+	return map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("storage-events", 0, broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t),
+	}
+}
+
+// 🔹 Test the client authenticates with SASL/PLAIN
+func TestKafkaSASLPlain(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	handlers := mockClusterHandlers(t, broker)
+	handlers["SaslHandshakeRequest"] = sarama.NewMockSaslHandshakeResponse(t).SetEnabledMechanisms([]string{kafka.SASLPlain})
+	handlers["SaslAuthenticateRequest"] = sarama.NewMockSaslAuthenticateResponse(t)
+	// Idempotent producers ask for a producer ID before sending.
+	handlers["InitProducerIDRequest"] = sarama.NewMockInitProducerIDResponse(t)
+	broker.SetHandlerByMap(handlers)
+
+	client, err := kafka.NewKafkaClient(kafka.Config{
+		Brokers:  []string{broker.Addr()},
+		GroupID:  "test",
+		ClientID: "storage-test",
+		Producer: kafka.ProducerConfig{RequiredAcks: intPtr(-1), Compression: "gzip", Retries: intPtr(3), Idempotent: true},
+		Consumer: kafka.ConsumerConfig{InitialOffset: "oldest", RebalanceStrategy: "sticky"},
+		SASL:     kafka.SASLConfig{Mechanism: kafka.SASLPlain, Username: "storage", Password: "secret"},
+	})
+	if err != nil {
+		t.Fatalf("❌ Failed to connect with SASL/PLAIN: %v", err)
+	}
+	defer client.Close()
+
+	authenticated := false
+	for _, exchange := range broker.History() {
+		if request, ok := exchange.Request.(*sarama.SaslAuthenticateRequest); ok {
+			authenticated = bytes.Equal(request.SaslAuthBytes, []byte("\x00storage\x00secret"))
+		}
+	}
+	if !authenticated {
+		t.Errorf("❌ Expected the PLAIN credentials to be sent")
+	}
+}
+
+// 🔹 Test the client verifies brokers against the configured CA
+func TestKafkaTLS(t *testing.T) {
+	ca := issueCert(t, pkix.Name{CommonName: "Kafka CA"}, 1, nil)
+	server := issueCert(t, pkix.Name{CommonName: "localhost"}, 2, ca)
+	caFile, _ := writeCert(t, t.TempDir(), ca)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("❌ Failed to listen: %v", err)
+	}
+	broker := sarama.NewMockBrokerListener(t, 1, tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{server.tls}}))
+	defer broker.Close()
+	broker.SetHandlerByMap(mockClusterHandlers(t, broker))
+
+	config := kafka.Config{
+		Brokers:  []string{broker.Addr()},
+		GroupID:  "test",
+		Producer: kafka.ProducerConfig{RequiredAcks: intPtr(1)},
+		TLS:      kafka.TLSConfig{Enabled: true, CAFile: caFile},
+	}
+	client, err := kafka.NewKafkaClient(config)
+	if err != nil {
+		t.Fatalf("❌ Failed to connect over TLS: %v", err)
+	}
+	client.Close()
+
+	config.TLS.CAFile = ""
+	if client, err := kafka.NewKafkaClient(config); err == nil {
+		client.Close()
+		t.Errorf("❌ Expected a broker signed by an unknown CA to be rejected")
+	}
+}
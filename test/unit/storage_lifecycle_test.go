@@ -0,0 +1,139 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"project-root/internal/lifecycle"
+)
+
+// 🔹 Test that components start in order, stop in reverse and roll back on a failed start
+func TestLifecycleOrder(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	record := func(call string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call)
+	}
+	component := func(name string, startErr error) lifecycle.Component {
+		return lifecycle.Component{
+			Name: name,
+			Start: func(context.Context) error {
+				record("start " + name)
+				return startErr
+			},
+			Stop: func(context.Context) error {
+				record("stop " + name)
+				return nil
+			},
+		}
+	}
+
+	lc := lifecycle.New()
+	lc.Add(component("storage", nil))
+	lc.Add(component("kafka", nil))
+	lc.Add(component("http", nil))
+	if err := lc.Start(context.Background()); err != nil {
+		t.Fatalf("❌ Failed to start: %v", err)
+	}
+	if err := lc.Stop(context.Background()); err != nil {
+		t.Fatalf("❌ Failed to stop: %v", err)
+	}
+	expected := []string{"start storage", "start kafka", "start http", "stop http", "stop kafka", "stop storage"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("❌ Expected %v, got %v", expected, calls)
+	}
+
+	calls = nil
+	lc = lifecycle.New()
+	lc.Add(component("storage", nil))
+	lc.Add(component("kafka", errors.New("no brokers")))
+	lc.Add(component("http", nil))
+	if err := lc.Start(context.Background()); err == nil {
+		t.Fatalf("❌ Expected start to fail")
+	}
+	expected = []string{"start storage", "start kafka", "stop storage"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("❌ Expected %v, got %v", expected, calls)
+	}
+}
+
+// 🔹 Test that a component that does not stop in time is abandoned and the rest still stop
+func TestLifecycleStopDeadline(t *testing.T) {
+	stopped := false
+	lc := lifecycle.New()
+	lc.Add(lifecycle.Component{Name: "storage", Stop: func(context.Context) error {
+		stopped = true
+		return nil
+	}})
+	lc.Add(lifecycle.Component{Name: "stuck", Stop: func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}})
+	lc.Add(lifecycle.Background("watcher", func(ctx context.Context) { <-ctx.Done() }))
+	if err := lc.Start(context.Background()); err != nil {
+		t.Fatalf("❌ Failed to start: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := lc.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("❌ Expected a deadline error, got %v", err)
+	}
+	if !stopped {
+		t.Fatalf("❌ Expected the remaining components to be stopped")
+	}
+}
+
+// 🔹 Test that stopping the HTTP server lets an in-flight request finish
+func TestLifecycleHTTPDrain(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("❌ Failed to reserve a port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	started := make(chan struct{})
+	server := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "done")
+	})}
+	lc := lifecycle.New()
+	lc.Add(lifecycle.HTTPServer(lc, server))
+	if err := lc.Start(context.Background()); err != nil {
+		t.Fatalf("❌ Failed to start: %v", err)
+	}
+
+	result := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		result <- string(body)
+	}()
+
+	<-started
+	if err := lc.Stop(context.Background()); err != nil {
+		t.Fatalf("❌ Failed to stop: %v", err)
+	}
+	if body := <-result; body != "done" {
+		t.Fatalf("❌ Expected the in-flight request to complete, got %q", body)
+	}
+	if _, err := http.Get("http://" + addr + "/"); err == nil {
+		t.Fatalf("❌ Expected new connections to be refused after shutdown")
+	}
+}
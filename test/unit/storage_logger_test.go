@@ -0,0 +1,168 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"project-root/pkg/logger"
+)
+
+// 🔹 Test records are filtered by level and written as JSON with their fields and trace
+func TestLoggerRecords(t *testing.T) {
+	var out bytes.Buffer
+	log := logger.New(slog.LevelWarn, logger.NewWriterSink(&out))
+
+	span := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9},
+		SpanID:  trace.SpanID{0x01},
+	})
+	log.Info("not written")
+	log.WarnContext(trace.ContextWithSpanContext(context.Background(), span), "Replica lagging", "path", "a.txt")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("❌ Expected only the warning to be written, got %q", out.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("❌ Expected a JSON record: %v", err)
+	}
+	if record["level"] != "WARN" || record["msg"] != "Replica lagging" || record["path"] != "a.txt" {
+		t.Errorf("❌ Unexpected record: %v", record)
+	}
+	if record["trace_id"] != span.TraceID().String() {
+		t.Errorf("❌ Expected the record to carry the trace ID, got %v", record["trace_id"])
+	}
+
+	if _, err := logger.ParseLevel("loud"); err == nil {
+		t.Errorf("❌ Expected an unknown level to be rejected")
+	}
+}
+
+// 🔹 Test the file sink rotates by size and keeps a bounded number of backups
+func TestLoggerFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	sink, err := logger.NewFileSink(logger.FileConfig{Path: path, MaxBytes: 100, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("❌ Failed to open log file: %v", err)
+	}
+	record := []byte(strings.Repeat("x", 39) + "\n")
+	for i := 0; i < 8; i++ {
+		if _, err := sink.Write(record); err != nil {
+			t.Fatalf("❌ Failed to write: %v", err)
+		}
+	}
+	sink.Close(context.Background())
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("❌ Expected %s to exist: %v", name, err)
+		}
+		if info.Size() > 100 {
+			t.Errorf("❌ Expected %s to stay within the size limit, got %d bytes", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Errorf("❌ Expected only 2 backups to be kept")
+	}
+}
+
+// 🔹 Test records are shipped in _bulk batches and failed batches are retried
+func TestLoggerElasticsearchBatches(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("❌ Unexpected request %s with %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.Write([]byte(`{"errors":false}`))
+	}))
+	defer server.Close()
+
+	sink := logger.NewElasticsearchSink(logger.ElasticsearchConfig{URL: server.URL, Index: "app-logs", BatchSize: 2, FlushInterval: time.Hour, MaxRetries: 3})
+	log := logger.New(slog.LevelInfo, sink)
+	log.Info("one")
+	log.Info("two")
+	log.Info("three")
+	if err := sink.Close(context.Background()); err != nil {
+		t.Fatalf("❌ Failed to flush: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 3 || len(bodies) != 2 {
+		t.Fatalf("❌ Expected a retried full batch and a final partial one, got %d attempts and %d batches", attempts, len(bodies))
+	}
+	lines := strings.Split(strings.TrimSpace(bodies[0]), "\n")
+	if len(lines) != 4 || lines[0] != `{"index":{"_index":"app-logs"}}` || !strings.Contains(lines[1], `"msg":"one"`) {
+		t.Errorf("❌ Unexpected bulk body: %q", bodies[0])
+	}
+	if !strings.Contains(bodies[1], `"msg":"three"`) {
+		t.Errorf("❌ Expected the remaining record to be flushed on close, got %q", bodies[1])
+	}
+	if sink.Dropped() != 0 {
+		t.Errorf("❌ Expected no records to be dropped, got %d", sink.Dropped())
+	}
+}
+
+// 🔹 Test a slow cluster never blocks logging; records beyond the buffer are dropped
+func TestLoggerElasticsearchBackpressure(t *testing.T) {
+	received := make(chan struct{}, 10)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+		w.Write([]byte(`{"errors":false}`))
+	}))
+	defer server.Close()
+
+	sink := logger.NewElasticsearchSink(logger.ElasticsearchConfig{URL: server.URL, BatchSize: 1, BufferSize: 1, FlushInterval: time.Hour})
+	log := logger.New(slog.LevelInfo, sink)
+	log.Info("in flight")
+	<-received
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			log.Info("queued")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("❌ Expected logging not to block on a slow cluster")
+	}
+	if sink.Dropped() != 2 {
+		t.Errorf("❌ Expected 2 records beyond the buffer to be dropped, got %d", sink.Dropped())
+	}
+
+	close(release)
+	if err := sink.Close(context.Background()); err != nil {
+		t.Fatalf("❌ Failed to flush: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"project-root/internal/api"
+	"project-root/internal/storage"
+)
+
+// 🔹 Test storage call and HTTP request metrics exposed on /metrics
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	backend := storage.NewMetricsStorage(storage.NewLocalStorage(t.TempDir()), "metrics-test")
+
+	if err := backend.WriteFile(ctx, "a.txt", []byte("hello"), false); err != nil {
+		t.Fatalf("❌ Failed to write: %v", err)
+	}
+	if _, err := backend.ReadFile(ctx, "missing.txt"); err == nil {
+		t.Fatalf("❌ Expected reading a missing file to fail")
+	}
+	if err := storage.CheckHealth(ctx, backend); err != nil {
+		t.Fatalf("❌ Expected the wrapped backend to be healthy: %v", err)
+	}
+
+	// Counters are process-wide, so compare HTTP series before and after the requests.
+	router := api.SetupRoutes(&api.API{Storage: backend, Metrics: promhttp.Handler()})
+	readRequests := `http_requests_total{method="GET",route="/read/:path",status="200"}`
+	readBytes := `http_response_bytes_total{method="GET",route="/read/:path",status="200"}`
+	unmatched := `http_requests_total{method="POST",route="unmatched",status="404"}`
+	before := scrapeMetrics(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/read/a.txt", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("❌ Expected to read the file, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/nowhere", bytes.NewReader([]byte("abc"))))
+
+	after := scrapeMetrics(router)
+	for series, delta := range map[string]float64{readRequests: 1, readBytes: 5, unmatched: 1} {
+		if got := after[series] - before[series]; got != delta {
+			t.Errorf("❌ Expected %s to grow by %v, got %v", series, delta, got)
+		}
+	}
+	for _, series := range []string{
+		`storage_operations_total{backend="metrics-test",operation="write_file"}`,
+		`storage_errors_total{backend="metrics-test",operation="read_file"}`,
+		`storage_operation_duration_seconds_count{backend="metrics-test",operation="open_file"}`,
+	} {
+		if after[series] != 1 {
+			t.Errorf("❌ Expected %s to be 1, got %v", series, after[series])
+		}
+	}
+	if after[`storage_operations_total{backend="metrics-test",operation="list_files"}`] != 0 {
+		t.Errorf("❌ Expected health checks not to be recorded as storage operations")
+	}
+}
+
+// scrapeMetrics reads /metrics into a map from series to value.
+func scrapeMetrics(router http.Handler) map[string]float64 {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	values := map[string]float64{}
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.LastIndex(line, " "); i > 0 {
+			values[line[:i]], _ = strconv.ParseFloat(line[i+1:], 64)
+		}
+	}
+	return values
+}
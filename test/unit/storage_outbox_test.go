@@ -0,0 +1,223 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"project-root/internal/api"
+	"project-root/internal/events"
+	"project-root/internal/outbox"
+	"project-root/internal/storage"
+)
+
+// recordingPublisher records delivered event paths and fails while fail returns an error.
+type recordingPublisher struct {
+	mu        sync.Mutex
+	delivered []string
+	fail      func(event *events.StorageEvent) error
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, _ string, event *events.StorageEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail != nil {
+		if err := p.fail(event); err != nil {
+			return err
+		}
+	}
+	p.delivered = append(p.delivered, event.Path+"#"+event.MetaData["n"])
+	return nil
+}
+
+func (p *recordingPublisher) Delivered() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.delivered...)
+}
+
+func openOutbox(t *testing.T, path string) *outbox.Outbox {
+	t.Helper()
+	ob, err := outbox.Open(outbox.Config{Path: path, RetryBackoff: 20 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("❌ Failed to open outbox: %v", err)
+	}
+	return ob
+}
+
+func enqueue(t *testing.T, ob *outbox.Outbox, path, n string) {
+	t.Helper()
+	event := events.NewFactory("test").New(events.FileUploaded, path, "")
+	event.MetaData = map[string]string{"n": n}
+	if err := ob.Enqueue(context.Background(), "storage-events", event); err != nil {
+		t.Fatalf("❌ Failed to enqueue: %v", err)
+	}
+}
+
+// 🔹 Test undelivered events survive a restart and keep their order per path
+func TestOutboxRetriesInOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.db")
+	ob := openOutbox(t, path)
+	enqueue(t, ob, "a.txt", "1")
+	enqueue(t, ob, "b.txt", "1")
+	enqueue(t, ob, "a.txt", "2")
+
+	down := &recordingPublisher{fail: func(*events.StorageEvent) error { return errors.New("kafka: client has run out of available brokers") }}
+	if next := ob.Flush(context.Background(), down); next.IsZero() {
+		t.Errorf("❌ Expected a retry to be scheduled")
+	}
+	ob.Close()
+
+	ob = openOutbox(t, path)
+	defer ob.Close()
+	stats, err := ob.Stats()
+	if err != nil || stats.Pending != 3 || stats.Failing != 2 || stats.Oldest == nil {
+		t.Fatalf("❌ Expected 3 pending events after a restart, 2 of them failing, got %+v (%v)", stats, err)
+	}
+
+	// a.txt#1 fails once more; a.txt#2 must wait for it while b.txt is delivered.
+	failedOnce := false
+	publisher := &recordingPublisher{fail: func(event *events.StorageEvent) error {
+		if event.Path == "a.txt" && !failedOnce {
+			failedOnce = true
+			return errors.New("leader not available")
+		}
+		return nil
+	}}
+	time.Sleep(25 * time.Millisecond)
+	ob.Flush(context.Background(), publisher)
+	if got := publisher.Delivered(); !reflect.DeepEqual(got, []string{"b.txt#1"}) {
+		t.Errorf("❌ Expected only b.txt to be delivered while a.txt is retried, got %v", got)
+	}
+	time.Sleep(25 * time.Millisecond)
+	if next := ob.Flush(context.Background(), publisher); !next.IsZero() {
+		t.Errorf("❌ Expected nothing left to retry, got %v", next)
+	}
+	if got := publisher.Delivered(); !reflect.DeepEqual(got, []string{"b.txt#1", "a.txt#1", "a.txt#2"}) {
+		t.Errorf("❌ Expected a.txt events in order, got %v", got)
+	}
+	if stats, _ := ob.Stats(); stats.Pending != 0 {
+		t.Errorf("❌ Expected an empty outbox, got %+v", stats)
+	}
+}
+
+// 🔹 Test the relay delivers as soon as events are recorded and drops events that can never be published
+func TestOutboxRelay(t *testing.T) {
+	ob := openOutbox(t, filepath.Join(t.TempDir(), "outbox.db"))
+	defer ob.Close()
+	publisher := &recordingPublisher{fail: func(event *events.StorageEvent) error {
+		if event.Path == "invalid.txt" {
+			return fmt.Errorf("%w: unknown type", events.ErrInvalidEvent)
+		}
+		return nil
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ob.Run(ctx, publisher)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	enqueue(t, ob, "invalid.txt", "1")
+	enqueue(t, ob, "a.txt", "1")
+	deadline := time.Now().Add(2 * time.Second)
+	for len(publisher.Delivered()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := publisher.Delivered(); !reflect.DeepEqual(got, []string{"a.txt#1"}) {
+		t.Errorf("❌ Expected the relay to deliver a.txt, got %v", got)
+	}
+	if stats, _ := ob.Stats(); stats.Pending != 0 {
+		t.Errorf("❌ Expected the invalid event to be dropped, got %+v", stats)
+	}
+}
+
+// 🔹 Test events whose async delivery failed are retried after the backoff
+func TestOutboxRequeue(t *testing.T) {
+	ob := openOutbox(t, filepath.Join(t.TempDir(), "outbox.db"))
+	defer ob.Close()
+	event := events.NewFactory("test").New(events.FileUploaded, "a.txt", "")
+	event.MetaData = map[string]string{"n": "1"}
+	if err := ob.Requeue(context.Background(), "storage-events", event, errors.New("message too large")); err != nil {
+		t.Fatalf("❌ Failed to requeue: %v", err)
+	}
+
+	publisher := &recordingPublisher{}
+	if next := ob.Flush(context.Background(), publisher); next.IsZero() || len(publisher.Delivered()) != 0 {
+		t.Errorf("❌ Expected the requeued event to wait for its backoff, delivered %v", publisher.Delivered())
+	}
+	if stats, _ := ob.Stats(); stats.Failing != 1 {
+		t.Errorf("❌ Expected the requeued event to count as failing, got %+v", stats)
+	}
+	time.Sleep(25 * time.Millisecond)
+	ob.Flush(context.Background(), publisher)
+	if got := publisher.Delivered(); !reflect.DeepEqual(got, []string{"a.txt#1"}) {
+		t.Errorf("❌ Expected the requeued event to be delivered, got %v", got)
+	}
+}
+
+// 🔹 Test uploads record events in the outbox and the outbox endpoints report them
+func TestOutboxAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ob := openOutbox(t, filepath.Join(t.TempDir(), "outbox.db"))
+	defer ob.Close()
+	// No Kafka client: the event must wait in the outbox.
+	router := api.SetupRoutes(&api.API{Storage: storage.NewLocalStorage(t.TempDir()), Outbox: ob, Metrics: promhttp.Handler()})
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, _ := writer.CreateFormFile("file", "a.txt")
+	part.Write([]byte("hello"))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload/a.txt", &form)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set(api.RequestIDHeader, "outbox-1")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("❌ Expected the upload to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/outbox/stats", nil))
+	var stats outbox.Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil || stats.Pending != 1 {
+		t.Errorf("❌ Expected 1 pending event, got %s", rec.Body.String())
+	}
+	if metrics := scrapeMetrics(router); metrics["outbox_pending_events"] != 1 {
+		t.Errorf("❌ Expected outbox_pending_events 1, got %v", metrics["outbox_pending_events"])
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/outbox/entries?limit=10", nil))
+	var body struct {
+		Entries []outbox.Entry `json:"entries"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if len(body.Entries) != 1 || body.Entries[0].Event.Path != "a.txt" || body.Entries[0].Event.MetaData[events.MetaRequestID] != "outbox-1" {
+		t.Errorf("❌ Expected the upload event with its request ID, got %s", rec.Body.String())
+	}
+
+	// Once Kafka is reachable the relay drains it.
+	ob.Flush(context.Background(), newMockKafkaClient(t))
+	if metrics := scrapeMetrics(router); metrics["outbox_pending_events"] != 0 {
+		t.Errorf("❌ Expected the outbox to drain to Kafka, got %v pending", metrics["outbox_pending_events"])
+	}
+}
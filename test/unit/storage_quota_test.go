@@ -0,0 +1,126 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"project-root/internal/storage"
+)
+
+// 🔹 Test per-user and per-prefix quota enforcement and usage accounting
+func TestQuotaStorage(t *testing.T) {
+	backend := storage.NewLocalStorage(t.TempDir())
+	quota := storage.NewQuotaStorage(backend, storage.QuotaConfig{
+		DefaultUser: storage.QuotaLimit{MaxBytes: 100},
+		Users:       map[string]storage.QuotaLimit{"bob": {MaxObjects: 2}},
+		Prefixes:    map[string]storage.QuotaLimit{"shared": {MaxBytes: 50}},
+	})
+	alice := storage.WithUser(context.Background(), "alice")
+	bob := storage.WithUser(context.Background(), "bob")
+
+	if err := quota.WriteFile(alice, "a/one.bin", make([]byte, 60), false); err != nil {
+		t.Fatalf("❌ Write within quota failed: %v", err)
+	}
+	err := quota.WriteFile(alice, "a/two.bin", make([]byte, 60), false)
+	var quotaErr *storage.QuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.Scope != storage.QuotaScopeUser || quotaErr.Resource != "bytes" {
+		t.Fatalf("❌ Expected user byte quota error, got %v", err)
+	}
+	if _, err := backend.Stat(alice, "a/two.bin"); err == nil {
+		t.Errorf("❌ Rejected write left a file behind")
+	}
+
+	// Overwriting a file only counts the difference
+	if err := quota.WriteFile(alice, "a/one.bin", make([]byte, 90), true); err != nil {
+		t.Errorf("❌ Overwrite within quota failed: %v", err)
+	}
+
+	// Prefix limits apply across users
+	if err := quota.WriteFile(bob, "shared/x.bin", make([]byte, 40), false); err != nil {
+		t.Fatalf("❌ Write within prefix quota failed: %v", err)
+	}
+	err = quota.WriteStream(bob, "shared/y.bin", bytes.NewReader(make([]byte, 20)), storage.WriteOptions{})
+	if !errors.As(err, &quotaErr) || quotaErr.Scope != storage.QuotaScopePrefix || quotaErr.Name != "shared" {
+		t.Fatalf("❌ Expected prefix quota error, got %v", err)
+	}
+
+	// Object counts
+	quota.WriteFile(bob, "b/1.txt", []byte("1"), false)
+	if err := quota.WriteFile(bob, "b/2.txt", []byte("2"), false); !errors.Is(err, storage.ErrQuotaExceeded) {
+		t.Fatalf("❌ Expected object quota error, got %v", err)
+	}
+
+	report, err := quota.Usage(alice)
+	if err != nil {
+		t.Fatalf("❌ Failed to read usage: %v", err)
+	}
+	if got := report.Users["alice"].Usage; got != (storage.Usage{Bytes: 90, Objects: 1}) {
+		t.Errorf("❌ Unexpected usage for alice: %+v", got)
+	}
+	if got := report.Prefixes["shared"]; got.Bytes != 40 || got.Limit.MaxBytes != 50 {
+		t.Errorf("❌ Unexpected usage for shared: %+v", got)
+	}
+
+	// Deletes release usage
+	quota.DeleteFile(bob, "b/1.txt")
+	if err := quota.WriteFile(bob, "b/2.txt", []byte("2"), false); err != nil {
+		t.Errorf("❌ Write after delete failed: %v", err)
+	}
+
+	// A fresh instance computes the same usage by scanning
+	rebuilt := storage.NewQuotaStorage(backend, storage.QuotaConfig{})
+	rebuiltReport, _ := rebuilt.Usage(alice)
+	if rebuiltReport.Users["alice"].Usage != (storage.Usage{Bytes: 90, Objects: 1}) || rebuiltReport.Users["bob"].Objects != 2 {
+		t.Errorf("❌ Rebuilt usage differs: %+v", rebuiltReport.Users)
+	}
+}
+
+// 🔹 Test usage written through another instance is counted after a rebuild
+func TestQuotaStorageAcrossInstances(t *testing.T) {
+	backend := storage.NewLocalStorage(t.TempDir())
+	config := storage.QuotaConfig{DefaultUser: storage.QuotaLimit{MaxBytes: 100}}
+	first := storage.NewQuotaStorage(backend, config)
+	second := storage.NewQuotaStorage(backend, config)
+	alice := storage.WithUser(context.Background(), "alice")
+
+	if err := first.WriteFile(alice, "a/one.bin", make([]byte, 60), false); err != nil {
+		t.Fatalf("❌ Write within quota failed: %v", err)
+	}
+	if err := second.WriteFile(alice, "a/two.bin", make([]byte, 30), false); err != nil {
+		t.Fatalf("❌ Write within quota failed: %v", err)
+	}
+
+	if err := first.Rebuild(alice); err != nil {
+		t.Fatalf("❌ Rebuild failed: %v", err)
+	}
+	if err := first.WriteFile(alice, "a/three.bin", make([]byte, 20), false); !errors.Is(err, storage.ErrQuotaExceeded) {
+		t.Errorf("❌ Expected the other instance's write to count, got %v", err)
+	}
+	if report, _ := first.Usage(alice); report.Users["alice"].Usage != (storage.Usage{Bytes: 90, Objects: 2}) {
+		t.Errorf("❌ Unexpected usage after rebuild: %+v", report.Users["alice"])
+	}
+}
+
+// 🔹 Test a failed initial scan is retried
+func TestQuotaStorageLoadRecovers(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	backend := storage.NewLocalStorage(dir)
+	quota := storage.NewQuotaStorage(backend, storage.QuotaConfig{})
+	ctx := context.Background()
+
+	// Listing a missing directory fails.
+	if _, err := quota.Usage(ctx); err == nil {
+		t.Fatalf("❌ Expected the scan of a missing directory to fail")
+	}
+	backend.WriteFile(ctx, "existing.txt", []byte("data"), false)
+	report, err := quota.Usage(ctx)
+	if err != nil {
+		t.Fatalf("❌ Expected usage to load once the backend is available, got %v", err)
+	}
+	if report.Users[storage.AnonymousUser].Objects != 1 {
+		t.Errorf("❌ Unexpected usage %+v", report.Users)
+	}
+}
@@ -0,0 +1,114 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"project-root/internal/api"
+	"project-root/internal/ratelimit"
+	"project-root/internal/storage"
+)
+
+// 🔹 Test token buckets for requests and bandwidth
+func TestRateLimiter(t *testing.T) {
+	limiter := ratelimit.New(1, 3)
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow("a"); !ok {
+			t.Fatalf("❌ Expected burst request %d to be allowed", i)
+		}
+	}
+	ok, retryAfter := limiter.Allow("a")
+	if ok || retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("❌ Expected rejection with retry within 1s, got %v %v", ok, retryAfter)
+	}
+	if ok, _ := limiter.Allow("b"); !ok {
+		t.Errorf("❌ Keys should not share buckets")
+	}
+
+	// 1100 bytes at 1000 B/s with a one-second burst takes about 100ms
+	bandwidth := ratelimit.New(1000, 0)
+	start := time.Now()
+	io.Copy(io.Discard, bandwidth.Reader(context.Background(), "a", bytes.NewReader(make([]byte, 1100))))
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("❌ Expected throttled read, took %v", elapsed)
+	}
+
+	var unlimited *ratelimit.Limiter
+	if ok, _ := unlimited.Allow("a"); !ok || ratelimit.New(0, 10) != nil {
+		t.Errorf("❌ Expected nil limiter to allow everything")
+	}
+}
+
+// 🔹 Test 429 responses and streaming upload size limits
+func TestAPILimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := api.SetupRoutes(&api.API{
+		Storage: storage.NewMockAzureStorage(),
+		Limits:  api.Limits{PerIP: ratelimit.New(1, 2), MaxUploadBytes: 1024},
+	})
+
+	upload := func(size int) *httptest.ResponseRecorder {
+		var form bytes.Buffer
+		writer := multipart.NewWriter(&form)
+		part, _ := writer.CreateFormFile("file", "f.bin")
+		part.Write(make([]byte, size))
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPost, "/upload/f.bin?overwrite=true", &form)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.ContentLength = -1 // Chunked: the limit must be enforced while streaming
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := upload(4096); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("❌ Expected 413 for oversized upload, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := upload(100); rec.Code != http.StatusCreated {
+		t.Errorf("❌ Expected small upload to succeed, got %d %s", rec.Code, rec.Body)
+	}
+
+	rec := upload(100)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("❌ Expected 429 with Retry-After, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+// 🔹 Test forwarded headers only pick the client IP behind a trusted proxy
+func TestAPILimitsForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := api.SetupRoutes(&api.API{
+		Storage: storage.NewMockAzureStorage(),
+		Limits:  api.Limits{PerIP: ratelimit.New(1, 2)},
+	})
+	request := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/list/.", nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// A client rotating the header is still limited by its own address.
+	request("198.51.100.1")
+	request("198.51.100.2")
+	if code := request("198.51.100.3"); code != http.StatusTooManyRequests {
+		t.Errorf("❌ Expected a spoofed X-Forwarded-For to be ignored, got %d", code)
+	}
+
+	// Behind a trusted proxy, each forwarded client has its own bucket.
+	router.SetTrustedProxies([]string{"192.0.2.0/24"})
+	for _, client := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		if code := request(client); code == http.StatusTooManyRequests {
+			t.Errorf("❌ Expected %s behind the trusted proxy to have its own limit", client)
+		}
+	}
+}
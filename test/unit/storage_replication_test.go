@@ -0,0 +1,230 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"project-root/internal/events"
+	"project-root/internal/replication"
+	"project-root/internal/storage"
+)
+
+// 🔹 Test event-driven replication and reconciliation
+func TestReplicator(t *testing.T) {
+	ctx := context.Background()
+	primary := storage.NewMockAzureStorage()
+	secondary := storage.NewMockAzureStorage()
+	replicator := replication.NewReplicator(primary, secondary, 2, time.Millisecond)
+
+	primary.UploadFile(ctx, "docs/a.txt", []byte("alpha"))
+	primary.SetTags(ctx, "docs/a.txt", map[string]string{"customer": "acme"})
+	event := &events.StorageEvent{Type: events.FileUploaded, Path: "docs/a.txt", Timestamp: time.Now()}
+	if err := replicator.HandleEvent(ctx, event); err != nil {
+		t.Fatalf("❌ Failed to replicate upload: %v", err)
+	}
+	if data, err := secondary.ReadFile(ctx, "docs/a.txt"); err != nil || string(data) != "alpha" {
+		t.Fatalf("❌ Expected replica content, got %q (err %v)", data, err)
+	}
+	if tags, _ := secondary.GetTags(ctx, "docs/a.txt"); tags["customer"] != "acme" {
+		t.Errorf("❌ Expected tags to be replicated, got %v", tags)
+	}
+
+	// A move copies the new path and removes the old one
+	primary.UploadFile(ctx, "docs/b.txt", []byte("alpha"))
+	primary.DeleteFile(ctx, "docs/a.txt")
+	move := &events.StorageEvent{
+		Type:     events.FileMoved,
+		Path:     "docs/b.txt",
+		MetaData: map[string]string{events.MetaSourcePath: "docs/a.txt"},
+	}
+	if err := replicator.HandleEvent(ctx, move); err != nil {
+		t.Fatalf("❌ Failed to replicate move: %v", err)
+	}
+	if _, err := secondary.ReadFile(ctx, "docs/a.txt"); err == nil {
+		t.Errorf("❌ Expected moved source to be removed from replica")
+	}
+
+	// Deleting twice is harmless
+	primary.DeleteFile(ctx, "docs/b.txt")
+	for i := 0; i < 2; i++ {
+		if err := replicator.HandleEvent(ctx, &events.StorageEvent{Type: events.FileDeleted, Path: "docs/b.txt"}); err != nil {
+			t.Errorf("❌ Delete replication failed: %v", err)
+		}
+	}
+
+	if stats := replicator.Stats(); stats.Replicated != 4 || stats.Failed != 0 {
+		t.Errorf("❌ Unexpected stats %+v", stats)
+	}
+
+	// Reconcile repairs missed, stale and orphaned files
+	primary.UploadFile(ctx, "docs/missed.txt", []byte("missed"))
+	primary.UploadFile(ctx, "docs/stale.txt", []byte("v1"))
+	replicator.HandleEvent(ctx, &events.StorageEvent{Type: events.FileUploaded, Path: "docs/stale.txt"})
+	primary.WriteFile(ctx, "docs/stale.txt", []byte("v2"), true)
+	secondary.UploadFile(ctx, "docs/orphan.txt", []byte("orphan"))
+
+	result, err := replicator.Reconcile(ctx, "docs")
+	if err != nil {
+		t.Fatalf("❌ Reconcile failed: %v", err)
+	}
+	if result.Scanned != 2 || result.Copied != 2 || result.Deleted != 1 || result.Failed != 0 {
+		t.Errorf("❌ Unexpected reconcile result %+v", result)
+	}
+	if data, _ := secondary.ReadFile(ctx, "docs/stale.txt"); string(data) != "v2" {
+		t.Errorf("❌ Expected stale replica to be refreshed, got %q", data)
+	}
+
+	// A second pass finds nothing to do
+	if result, _ := replicator.Reconcile(ctx, "docs"); result.Copied != 0 || result.Deleted != 0 {
+		t.Errorf("❌ Expected replicas to be in sync, got %+v", result)
+	}
+}
+
+// 🔹 Test replicas hold the stored bytes and metadata of an encrypted, compressed and deduplicated primary
+func TestReplicatorCopiesStoredContent(t *testing.T) {
+	ctx := context.Background()
+	keyFile := filepath.Join(t.TempDir(), "kek.json")
+	writeKeyFile(t, keyFile, "k1", "k1")
+	keys, err := storage.NewLocalKeyProvider(keyFile)
+	if err != nil {
+		t.Fatalf("❌ Failed to load keys: %v", err)
+	}
+	// decorate builds the server's compression and encryption stack over a raw backend.
+	decorate := func(raw storage.StorageAdapter) storage.StorageAdapter {
+		compressed, err := storage.NewCompressedStorage(storage.NewEncryptedStorage(raw, keys), storage.CompressionConfig{
+			Algorithm:    storage.EncodingGzip,
+			ContentTypes: []string{"text/"},
+		})
+		if err != nil {
+			t.Fatalf("❌ Failed to create compression: %v", err)
+		}
+		return compressed
+	}
+	dedupConfig := storage.DedupConfig{HashKey: bytes.Repeat([]byte("k"), 32)}
+
+	primary := storage.NewLocalStorage(t.TempDir())
+	secondary := storage.NewLocalStorage(t.TempDir())
+	content := bytes.Repeat([]byte("quarterly numbers "), 500)
+	if err := decorate(primary).WriteFile(ctx, "docs/notes.txt", content, false); err != nil {
+		t.Fatalf("❌ Failed to write through the stack: %v", err)
+	}
+	if err := storage.NewDedupStorage(decorate(primary), dedupConfig).WriteFile(ctx, "docs/report.txt", content, false); err != nil {
+		t.Fatalf("❌ Failed to write through the dedup stack: %v", err)
+	}
+
+	replicator := replication.NewReplicator(primary, secondary, 0, time.Millisecond)
+	for _, path := range []string{"docs/notes.txt", "docs/report.txt"} {
+		if err := replicator.HandleEvent(ctx, &events.StorageEvent{Type: events.FileUploaded, Path: path}); err != nil {
+			t.Fatalf("❌ Failed to replicate %s: %v", path, err)
+		}
+	}
+
+	stored, _ := primary.Stat(ctx, "docs/notes.txt")
+	if stored.Metadata[storage.MetaContentEncoding] == "" {
+		t.Fatalf("❌ Expected compressed content, got metadata %v", stored.Metadata)
+	}
+	replica, err := secondary.Stat(ctx, "docs/notes.txt")
+	if err != nil {
+		t.Fatalf("❌ Replica missing: %v", err)
+	}
+	for k, v := range stored.Metadata {
+		if replica.Metadata[k] != v {
+			t.Errorf("❌ Expected replica metadata %s=%q, got %q", k, v, replica.Metadata[k])
+		}
+	}
+	storedBytes, _ := primary.ReadFile(ctx, "docs/notes.txt")
+	replicaBytes, _ := secondary.ReadFile(ctx, "docs/notes.txt")
+	if !bytes.Equal(storedBytes, replicaBytes) || bytes.Contains(replicaBytes, []byte("quarterly")) {
+		t.Errorf("❌ Expected the stored ciphertext to be copied as is")
+	}
+	if data, err := decorate(secondary).ReadFile(ctx, "docs/notes.txt"); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("❌ Replica does not decode through the stack (err %v)", err)
+	}
+
+	// A deduplicated file brings its content blob along.
+	reference, _ := primary.Stat(ctx, "docs/report.txt")
+	blob := storage.ReferencedBlob(reference.Metadata)
+	if blob == "" {
+		t.Fatalf("❌ Expected a deduplicated reference, got metadata %v", reference.Metadata)
+	}
+	storedBlob, _ := primary.ReadFile(ctx, blob)
+	if replicaBlob, err := secondary.ReadFile(ctx, blob); err != nil || !bytes.Equal(storedBlob, replicaBlob) {
+		t.Fatalf("❌ Expected the stored content blob to be copied as is (err %v)", err)
+	}
+	if data, err := storage.NewDedupStorage(decorate(secondary), dedupConfig).ReadFile(ctx, "docs/report.txt"); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("❌ Deduplicated replica does not decode through the stack (err %v)", err)
+	}
+}
+
+// 🔹 Test reconciliation leaves excluded prefixes and newly uploaded files alone
+func TestReplicatorReconcileDeletes(t *testing.T) {
+	ctx := context.Background()
+	primary := storage.NewMockAzureStorage()
+	secondary := storage.NewMockAzureStorage()
+	replicator := replication.NewReplicator(primary, secondary, 0, time.Millisecond)
+	replicator.Excluded = []string{"tenants/dedicated"}
+
+	primary.UploadFile(ctx, "tenants/shared/a.txt", []byte("a"))
+	secondary.UploadFile(ctx, "tenants/dedicated/b.txt", []byte("b"))
+	secondary.UploadFile(ctx, "tenants/shared/orphan.txt", []byte("orphan"))
+
+	result, err := replicator.Reconcile(ctx, ".")
+	if err != nil {
+		t.Fatalf("❌ Reconcile failed: %v", err)
+	}
+	if result.Deleted != 1 {
+		t.Errorf("❌ Expected only the orphan to be deleted, got %+v", result)
+	}
+	if _, err := secondary.Stat(ctx, "tenants/dedicated/b.txt"); err != nil {
+		t.Errorf("❌ Replica of a dedicated container was deleted")
+	}
+}
+
+// 🔹 Test reconciliation of deduplicated content blobs and the replication lag metrics
+func TestReplicatorReconcileContentBlobs(t *testing.T) {
+	ctx := context.Background()
+	primary := storage.NewLocalStorage(t.TempDir())
+	secondary := storage.NewLocalStorage(t.TempDir())
+	if err := storage.NewDedupStorage(primary, storage.DedupConfig{}).WriteFile(ctx, "docs/report.txt", []byte("report"), false); err != nil {
+		t.Fatalf("❌ Failed to write: %v", err)
+	}
+	reference, _ := primary.Stat(ctx, "docs/report.txt")
+	blob := storage.ReferencedBlob(reference.Metadata)
+
+	replicator := replication.NewReplicator(primary, secondary, 0, time.Millisecond)
+	replicator.Name = "blob-test"
+	event := &events.StorageEvent{Type: events.FileUploaded, Path: "docs/report.txt", Timestamp: time.Now().Add(-time.Minute)}
+	if err := replicator.HandleEvent(ctx, event); err != nil {
+		t.Fatalf("❌ Failed to replicate: %v", err)
+	}
+	metrics := scrapeMetrics(promhttp.Handler())
+	if lag := metrics[`replication_lag_seconds{replicator="blob-test"}`]; lag < 60 {
+		t.Errorf("❌ Expected the lag gauge to report about a minute, got %v", lag)
+	}
+	if metrics[`replication_events_total{replicator="blob-test",result="success"}`] != 1 {
+		t.Errorf("❌ Expected one replicated event to be counted")
+	}
+
+	// A replica whose content blob went missing is copied again
+	secondary.DeleteFile(ctx, blob)
+	orphan := storage.DedupBlobDir + "/_shared/ff/ff00"
+	secondary.WriteFile(ctx, orphan, []byte("unreferenced"), false)
+	result, err := replicator.Reconcile(ctx, ".")
+	if err != nil {
+		t.Fatalf("❌ Reconcile failed: %v", err)
+	}
+	if result.Copied != 1 || result.Deleted != 1 {
+		t.Errorf("❌ Expected the reference to be recopied and the orphan blob deleted, got %+v", result)
+	}
+	if _, err := secondary.Stat(ctx, blob); err != nil {
+		t.Errorf("❌ Expected the missing content blob to be restored: %v", err)
+	}
+	if _, err := secondary.Stat(ctx, orphan); err == nil {
+		t.Errorf("❌ Expected the unreferenced content blob to be deleted")
+	}
+}
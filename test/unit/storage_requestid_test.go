@@ -0,0 +1,120 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/gin-gonic/gin"
+
+	"project-root/internal/api"
+	"project-root/internal/events"
+	"project-root/internal/storage"
+	"project-root/pkg/logger"
+)
+
+// 🔹 Test request IDs are returned to the caller and carried by logs and published events
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logger.New(slog.LevelInfo, logger.NewWriterSink(&logs)))
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	})
+
+	kafkaClient := newMockKafkaClient(t)
+	router := api.SetupRoutes(&api.API{Storage: storage.NewLocalStorage(t.TempDir()), Kafka: kafkaClient})
+
+	// Generated when missing or unsafe, and echoed in the error body.
+	for _, sent := range []string{"", "bad id"} {
+		req := httptest.NewRequest(http.MethodGet, "/read/missing.txt", nil)
+		if sent != "" {
+			req.Header.Set(api.RequestIDHeader, sent)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		id := rec.Header().Get(api.RequestIDHeader)
+		if id == "" || id == sent {
+			t.Fatalf("❌ Expected a generated request ID for %q, got %q", sent, id)
+		}
+		var body api.ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error == "" {
+			t.Fatalf("❌ Expected an error body, got %s", rec.Body.String())
+		}
+		if body.RequestID != id {
+			t.Errorf("❌ Expected the error body to carry %q, got %q", id, body.RequestID)
+		}
+	}
+
+	logs.Reset()
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, _ := writer.CreateFormFile("file", "a.txt")
+	part.Write([]byte("hello"))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload/a.txt", &form)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set(api.RequestIDHeader, "upload-42")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated || rec.Header().Get(api.RequestIDHeader) != "upload-42" {
+		t.Fatalf("❌ Expected the upload to keep the caller's request ID, got %d %q", rec.Code, rec.Header().Get(api.RequestIDHeader))
+	}
+	for _, msg := range []string{"Message published to Kafka", "Request handled"} {
+		if record := findLogRecord(t, &logs, msg); record["request_id"] != "upload-42" {
+			t.Errorf("❌ Expected %q to be logged with the request ID, got %v", msg, record)
+		}
+	}
+
+	// The worker continues with the ID from the message header, or the event metadata.
+	var handled []string
+	kafkaClient.RegisterHandler(events.FileUploaded, func(ctx context.Context, event *events.StorageEvent) error {
+		handled = append(handled, logger.RequestIDFromContext(ctx))
+		slog.InfoContext(ctx, "Handled in worker")
+		return nil
+	})
+	factory := events.NewFactory("test")
+	withHeader := eventMessage(t, factory.New(events.FileUploaded, "a.txt", ""))
+	withHeader.Headers = []*sarama.RecordHeader{{Key: []byte("X-Request-ID"), Value: []byte("upload-42")}}
+	withMetadata := factory.New(events.FileUploaded, "b.txt", "")
+	withMetadata.MetaData = map[string]string{events.MetaRequestID: "upload-43"}
+	messages := make(chan *sarama.ConsumerMessage, 2)
+	messages <- withHeader
+	messages <- eventMessage(t, withMetadata)
+	close(messages)
+	logs.Reset()
+	if err := kafkaClient.ConsumeClaim(tracingSession{ctx: context.Background()}, tracingClaim{messages: messages}); err != nil {
+		t.Fatalf("❌ Failed to consume: %v", err)
+	}
+	if strings.Join(handled, ",") != "upload-42,upload-43" {
+		t.Errorf("❌ Expected handlers to see the publishing request IDs, got %v", handled)
+	}
+	if record := findLogRecord(t, &logs, "Handled in worker"); record["request_id"] != "upload-42" {
+		t.Errorf("❌ Expected worker logs to carry the request ID, got %v", record)
+	}
+}
+
+// findLogRecord returns the first JSON log record with message msg.
+func findLogRecord(t *testing.T, logs *bytes.Buffer, msg string) map[string]any {
+	t.Helper()
+	for _, line := range strings.Split(logs.String(), "\n") {
+		var record map[string]any
+		if json.Unmarshal([]byte(line), &record) == nil && record["msg"] == msg {
+			return record
+		}
+	}
+	t.Fatalf("❌ Expected a %q log record in %s", msg, logs.String())
+	return nil
+}
@@ -0,0 +1,158 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"project-root/internal/api"
+	"project-root/internal/auth"
+	"project-root/internal/storage"
+)
+
+// tenantKeys authenticates "key-<tenant>" as a caller bound to each tenant.
+func tenantKeys(t *testing.T, tenantIDs ...string) auth.Authenticator {
+	t.Helper()
+	keys := make([]auth.APIKey, 0, len(tenantIDs))
+	for _, tenantID := range tenantIDs {
+		keys = append(keys, auth.APIKey{Name: tenantID + "-user", Hash: auth.HashAPIKey("key-" + tenantID), Tenant: tenantID})
+	}
+	authenticator, err := auth.NewAPIKeyAuthenticator(keys)
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticator: %v", err)
+	}
+	return authenticator
+}
+
+func tenantRequest(t *testing.T, router http.Handler, tenantID, method, target string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var req *http.Request
+	if method == http.MethodPost && strings.HasPrefix(target, "/upload/") {
+		var form bytes.Buffer
+		writer := multipart.NewWriter(&form)
+		part, _ := writer.CreateFormFile("file", "upload.txt")
+		part.Write(body)
+		writer.Close()
+		req = httptest.NewRequest(method, target, &form)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+	} else {
+		req = httptest.NewRequest(method, target, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if tenantID != "" {
+		req.Header.Set("X-API-Key", "key-"+tenantID)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// 🔹 Test that no API path reads or lists another tenant's data
+func TestTenantIsolationAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tenants := storage.NewTenantStorage(storage.NewLocalStorage(t.TempDir()), "tenants", nil)
+	router := api.SetupRoutes(&api.API{Storage: tenants, Tenants: tenants, Auth: tenantKeys(t, "acme", "globex", "../acme")})
+
+	for _, tenantID := range []string{"acme", "globex"} {
+		rec := tenantRequest(t, router, tenantID, http.MethodPost, "/upload/report.txt?tag.class=secret", []byte(tenantID+" data"))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("❌ Upload for %s failed: %d %s", tenantID, rec.Code, rec.Body)
+		}
+	}
+	tenantRequest(t, router, "acme", http.MethodPost, "/upload/acme-only.txt", []byte("private"))
+	tenantRequest(t, router, "acme", http.MethodPut, "/retention/hold", []byte(`{"target": "acme-only.txt", "legalHold": true}`))
+
+	// Reads resolve inside the caller's namespace
+	if rec := tenantRequest(t, router, "globex", http.MethodGet, "/read/report.txt", nil); rec.Body.String() != "globex data" {
+		t.Errorf("❌ Expected globex content, got %q", rec.Body)
+	}
+	if rec := tenantRequest(t, router, "globex", http.MethodGet, "/read/acme-only.txt", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("❌ Expected 404 reading another tenant's file, got %d", rec.Code)
+	}
+
+	// Listings, searches and retention rules only show the caller's files
+	rec := tenantRequest(t, router, "globex", http.MethodGet, "/list/.", nil)
+	var listing struct{ Files []string }
+	json.Unmarshal(rec.Body.Bytes(), &listing)
+	if len(listing.Files) != 1 || listing.Files[0] != "report.txt" {
+		t.Errorf("❌ Expected only globex files in listing, got %v", listing.Files)
+	}
+
+	rec = tenantRequest(t, router, "globex", http.MethodGet, "/search?tag.class=secret", nil)
+	var search storage.TagSearchResult
+	json.Unmarshal(rec.Body.Bytes(), &search)
+	if len(search.Files) != 1 || search.Files[0].Path != "report.txt" {
+		t.Errorf("❌ Expected only globex search results, got %+v", search.Files)
+	}
+
+	rec = tenantRequest(t, router, "globex", http.MethodGet, "/retention", nil)
+	if strings.Contains(rec.Body.String(), "acme") {
+		t.Errorf("❌ Another tenant's retention rule leaked: %s", rec.Body)
+	}
+
+	// Deletes cannot reach another tenant either
+	tenantRequest(t, router, "globex", http.MethodDelete, "/delete/acme-only.txt", nil)
+	if rec := tenantRequest(t, router, "acme", http.MethodGet, "/read/acme-only.txt", nil); rec.Body.String() != "private" {
+		t.Errorf("❌ Another tenant's delete reached acme's file")
+	}
+
+	// Requests without a tenant are rejected
+	if rec := tenantRequest(t, router, "", http.MethodGet, "/read/report.txt", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("❌ Expected 401 without tenant, got %d", rec.Code)
+	}
+	if rec := tenantRequest(t, router, "../acme", http.MethodGet, "/read/report.txt", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("❌ Expected 400 for invalid tenant, got %d", rec.Code)
+	}
+}
+
+// 🔹 Test the tenant header is never trusted without authentication
+func TestTenantRequiresAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	backend := storage.NewLocalStorage(t.TempDir())
+	tenants := storage.NewTenantStorage(backend, "tenants", nil)
+	router := api.SetupRoutes(&api.API{Storage: tenants, Tenants: tenants})
+
+	req := httptest.NewRequest(http.MethodPost, "/directory/docs", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("❌ Expected the request to be refused without authentication, got %d", rec.Code)
+	}
+	if _, err := backend.Stat(context.Background(), "tenants/acme/docs/.keep"); err == nil {
+		t.Errorf("❌ Request reached the tenant named in the header")
+	}
+}
+
+// 🔹 Test that storage paths cannot escape a tenant's namespace
+func TestTenantStoragePaths(t *testing.T) {
+	backend := storage.NewLocalStorage(t.TempDir())
+	tenants := storage.NewTenantStorage(backend, "tenants", nil)
+	acme := storage.WithTenant(context.Background(), "acme")
+	globex := storage.WithTenant(context.Background(), "globex")
+
+	tenants.UploadFile(acme, "secret.txt", []byte("acme"))
+	for _, path := range []string{"../acme/secret.txt", "/../../tenants/acme/secret.txt", "./../acme/secret.txt"} {
+		if data, err := tenants.ReadFile(globex, path); err == nil {
+			t.Errorf("❌ %s escaped the namespace: %q", path, data)
+		}
+	}
+	if _, err := backend.Stat(acme, "tenants/acme/secret.txt"); err != nil {
+		t.Errorf("❌ Expected file under the tenant prefix: %v", err)
+	}
+
+	if err := tenants.DeleteFile(globex, "."); err == nil {
+		t.Errorf("❌ Expected deleting the namespace root to fail")
+	}
+	if _, err := tenants.ListFiles(context.Background(), "."); !errors.Is(err, storage.ErrNoTenant) {
+		t.Errorf("❌ Expected ErrNoTenant without a tenant, got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package storage_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"project-root/internal/auth"
+	"project-root/internal/tlsconfig"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	tls  tls.Certificate
+}
+
+// issueCert signs a certificate for subject with parent, or self-signs a CA when parent is nil.
+func issueCert(t *testing.T, subject pkix.Name, serial int64, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("❌ Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("❌ Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, tls: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}}
+}
+
+func writeCert(t *testing.T, dir string, c *testCert) (certFile, keyFile string) {
+	keyDER, _ := x509.MarshalECPrivateKey(c.key)
+	certFile, keyFile = filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+// 🔹 Test mTLS authentication and certificate reload against a live TLS listener
+func TestTLSClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCert(t, pkix.Name{CommonName: "Test CA"}, 1, nil)
+	certFile, keyFile := writeCert(t, dir, issueCert(t, pkix.Name{CommonName: "localhost"}, 2, ca))
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0600)
+
+	reloader, err := tlsconfig.New(tlsconfig.Config{
+		CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: tlsconfig.ClientAuthOptional,
+	})
+	if err != nil {
+		t.Fatalf("❌ Failed to load TLS config: %v", err)
+	}
+	authenticator, err := auth.NewClientCertAuthenticator([]auth.ClientCert{
+		{Subject: "CN=ingest,O=Acme", Tenant: "acme", Roles: []string{"writer"}},
+	})
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticator: %v", err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", reloader.TLSConfig())
+	if err != nil {
+		t.Fatalf("❌ Failed to listen: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := authenticator.Authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(identity)
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(client *testCert) (*http.Response, *auth.Identity) {
+		config := &tls.Config{RootCAs: roots}
+		if client != nil {
+			config.Certificates = []tls.Certificate{client.tls}
+		}
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		defer httpClient.CloseIdleConnections()
+		resp, err := httpClient.Get("https://" + listener.Addr().String() + "/")
+		if err != nil {
+			t.Fatalf("❌ Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var identity auth.Identity
+		json.NewDecoder(resp.Body).Decode(&identity)
+		return resp, &identity
+	}
+
+	resp, identity := get(issueCert(t, pkix.Name{CommonName: "ingest", Organization: []string{"Acme"}}, 3, ca))
+	if resp.StatusCode != http.StatusOK || identity.Subject != "cert:ingest" || identity.Tenant != "acme" || identity.Method != "mtls" {
+		t.Fatalf("❌ Expected ingest@acme via mtls, got %d %+v", resp.StatusCode, identity)
+	}
+	if resp.TLS.PeerCertificates[0].SerialNumber.Int64() != 2 {
+		t.Fatalf("❌ Expected the original server certificate")
+	}
+
+	if resp, _ := get(issueCert(t, pkix.Name{CommonName: "stranger"}, 4, ca)); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("❌ Expected 401 for an unmapped certificate, got %d", resp.StatusCode)
+	}
+	if resp, _ := get(nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("❌ Expected 401 without a client certificate, got %d", resp.StatusCode)
+	}
+
+	// Rotate the server certificate on disk; new handshakes pick it up.
+	writeCert(t, dir, issueCert(t, pkix.Name{CommonName: "localhost"}, 5, ca))
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("❌ Failed to reload: %v", err)
+	}
+	if resp, _ := get(nil); resp.TLS.PeerCertificates[0].SerialNumber.Int64() != 5 {
+		t.Fatalf("❌ Expected the rotated server certificate")
+	}
+
+	// A broken file keeps the current certificate in use.
+	os.WriteFile(certFile, []byte("garbage"), 0600)
+	if err := reloader.Reload(); err == nil {
+		t.Fatalf("❌ Expected reload of an invalid certificate to fail")
+	}
+	if resp, _ := get(nil); resp.TLS.PeerCertificates[0].SerialNumber.Int64() != 5 {
+		t.Fatalf("❌ Expected the last valid certificate to stay in use")
+	}
+}
+
+// 🔹 Test TLS version and cipher policy validation
+func TestTLSPolicy(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, issueCert(t, pkix.Name{CommonName: "localhost"}, 1, nil))
+
+	modern, err := tlsconfig.New(tlsconfig.Config{CertFile: certFile, KeyFile: keyFile, CipherPolicy: tlsconfig.CipherPolicyModern})
+	if err != nil || modern.TLSConfig().MinVersion != tls.VersionTLS13 {
+		t.Fatalf("❌ Expected the modern policy to require TLS 1.3 (err %v)", err)
+	}
+
+	custom, err := tlsconfig.New(tlsconfig.Config{CertFile: certFile, KeyFile: keyFile,
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"}})
+	if err != nil || len(custom.TLSConfig().CipherSuites) != 1 {
+		t.Fatalf("❌ Expected one custom cipher suite (err %v)", err)
+	}
+
+	for name, config := range map[string]tlsconfig.Config{
+		"insecure suite":     {CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		"old version":        {MinVersion: "1.0"},
+		"client auth, no CA": {ClientAuth: tlsconfig.ClientAuthRequire},
+	} {
+		config.CertFile, config.KeyFile = certFile, keyFile
+		if _, err := tlsconfig.New(config); err == nil {
+			t.Errorf("❌ Expected %s to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"project-root/internal/api"
+	"project-root/internal/events"
+	"project-root/internal/kafka"
+	"project-root/internal/storage"
+	"project-root/internal/tracing"
+)
+
+// tracingSession and tracingClaim feed messages to ConsumeClaim without a broker.
+type tracingSession struct {
+	sarama.ConsumerGroupSession
+	ctx context.Context
+}
+
+func (s tracingSession) Context() context.Context                    { return s.ctx }
+func (s tracingSession) MarkMessage(*sarama.ConsumerMessage, string) {}
+
+type tracingClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c tracingClaim) HighWaterMarkOffset() int64               { return 1 }
+func (c tracingClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// spanExporter records the spans of every test. Package tracers bind to the first provider
+// installed, so it is installed once and before any other.
+var spanExporter = sync.OnceValue(func() *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	return exporter
+})
+
+// 🔹 Test a trace started by the client continues through storage, Kafka and the worker handler
+func TestTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := spanExporter()
+	exporter.Reset()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	kafkaClient := newMockKafkaClient(t)
+	backend := storage.NewTracingStorage(storage.NewLocalStorage(t.TempDir()), "local")
+	router := api.SetupRoutes(&api.API{Storage: backend, Kafka: kafkaClient})
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, _ := writer.CreateFormFile("file", "traced.txt")
+	part.Write([]byte("traced"))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload/traced.txt", &form)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("❌ Expected the upload to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range exporter.GetSpans().Snapshots() {
+		spans[span.Name()] = span
+	}
+	server, ok := spans["POST /upload/:path"]
+	if !ok {
+		t.Fatalf("❌ Expected a server span for the upload, got %v", spanNames(spans))
+	}
+	if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("❌ Expected the server span to continue the client's trace, got %s", got)
+	}
+	for _, name := range []string{"storage.write_stream", "publish storage-events"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Fatalf("❌ Expected a %q span, got %v", name, spanNames(spans))
+		}
+		if span.Parent().SpanID() != server.SpanContext().SpanID() {
+			t.Errorf("❌ Expected %q to be a child of the server span", name)
+		}
+	}
+
+	// The worker sees the headers Publish wrote; rebuild them from the producer span.
+	publish := spans["publish storage-events"]
+	headers := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(trace.ContextWithSpanContext(context.Background(), publish.SpanContext()), headers)
+	message := eventMessage(t, events.NewFactory("test").New(events.FileUploaded, "traced.txt", ""))
+	for key, value := range headers {
+		message.Headers = append(message.Headers, &sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+
+	var handlerSpan trace.SpanContext
+	kafkaClient.RegisterHandler(events.FileUploaded, func(ctx context.Context, event *events.StorageEvent) error {
+		handlerSpan = trace.SpanContextFromContext(ctx)
+		return errors.New("replica unavailable")
+	})
+	messages := make(chan *sarama.ConsumerMessage, 1)
+	messages <- message
+	close(messages)
+	if err := kafkaClient.ConsumeClaim(tracingSession{ctx: context.Background()}, tracingClaim{messages: messages}); err != nil {
+		t.Fatalf("❌ Failed to consume: %v", err)
+	}
+
+	spans = map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range exporter.GetSpans().Snapshots() {
+		spans[span.Name()] = span
+	}
+	process, ok := spans["process FileUploaded"]
+	if !ok {
+		t.Fatalf("❌ Expected a consumer span, got %v", spanNames(spans))
+	}
+	if process.SpanContext().TraceID() != server.SpanContext().TraceID() || process.Parent().SpanID() != publish.SpanContext().SpanID() {
+		t.Errorf("❌ Expected the consumer span to continue the publisher's trace")
+	}
+	if handlerSpan.SpanID() != process.SpanContext().SpanID() {
+		t.Errorf("❌ Expected the handler to run in the consumer span")
+	}
+	if process.Status().Code != codes.Error || len(process.Events()) == 0 {
+		t.Errorf("❌ Expected the handler error to be recorded on the consumer span")
+	}
+}
+
+// 🔹 Test the file exporter writes finished spans
+func TestTracingFileExporter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{Exporter: tracing.ExporterFile, File: file, ServiceName: "tracing-test"})
+	if err != nil {
+		t.Fatalf("❌ Failed to set up tracing: %v", err)
+	}
+	_, span := otel.Tracer("tracing-test").Start(context.Background(), "exported")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("❌ Failed to flush spans: %v", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("❌ Failed to read trace file: %v", err)
+	}
+	if !strings.Contains(string(data), `"Name":"exported"`) || !strings.Contains(string(data), "tracing-test") {
+		t.Errorf("❌ Expected the span in the trace file, got %s", data)
+	}
+
+	if _, err := tracing.Setup(context.Background(), tracing.Config{Exporter: "zipkin"}); err == nil {
+		t.Errorf("❌ Expected an unknown exporter to be rejected")
+	}
+}
+
+// newMockKafkaClient returns a client connected to an in-process broker that accepts
+// everything published to storage-events.
+func newMockKafkaClient(t *testing.T) *kafka.KafkaClient {
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("storage-events", 0, broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t),
+	})
+	kafkaClient, err := kafka.NewKafkaClient(kafka.Config{
+		Brokers:  []string{broker.Addr()},
+		GroupID:  "test",
+		Producer: kafka.ProducerConfig{RequiredAcks: intPtr(-1), Retries: intPtr(5)},
+	})
+	if err != nil {
+		t.Fatalf("❌ Failed to create Kafka client: %v", err)
+	}
+	t.Cleanup(kafkaClient.Close)
+	return kafkaClient
+}
+
+// eventMessage wraps event as a message consumed from storage-events.
+func eventMessage(t *testing.T, event *events.StorageEvent) *sarama.ConsumerMessage {
+	t.Helper()
+	value, err := event.ToJSON()
+	if err != nil {
+		t.Fatalf("❌ Failed to encode event: %v", err)
+	}
+	return &sarama.ConsumerMessage{Topic: "storage-events", Value: value}
+}
+
+func spanNames(spans map[string]sdktrace.ReadOnlySpan) []string {
+	names := make([]string, 0, len(spans))
+	for name := range spans {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,123 @@
+package storage_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"project-root/internal/storage"
+)
+
+// 🔹 Test tag search with pagination on Local Storage
+func TestLocalStorageFindFilesByTags(t *testing.T) {
+	ctx := context.Background()
+	localStorage := storage.NewLocalStorage(t.TempDir())
+
+	for _, path := range []string{"a.csv", "b.csv", "c.csv"} {
+		if err := localStorage.WriteFile(ctx, path, []byte("data"), false); err != nil {
+			t.Fatalf("❌ Failed to write %s: %v", path, err)
+		}
+		if err := localStorage.SetTags(ctx, path, map[string]string{"customer": "acme", "class": "legal"}); err != nil {
+			t.Fatalf("❌ Failed to tag %s: %v", path, err)
+		}
+	}
+	localStorage.WriteFile(ctx, "other.csv", []byte("data"), false)
+	localStorage.SetTags(ctx, "other.csv", map[string]string{"customer": "globex"})
+
+	query := storage.TagQuery{Tags: map[string]string{"customer": "acme"}, MaxResults: 2}
+	page, err := localStorage.FindFilesByTags(ctx, query)
+	if err != nil {
+		t.Fatalf("❌ Tag search failed: %v", err)
+	}
+	if len(page.Files) != 2 || page.NextMarker == "" {
+		t.Fatalf("❌ Expected 2 results and a next marker, got %+v", page)
+	}
+
+	query.Marker = page.NextMarker
+	page, err = localStorage.FindFilesByTags(ctx, query)
+	if err != nil {
+		t.Fatalf("❌ Tag search failed: %v", err)
+	}
+	if len(page.Files) != 1 || page.Files[0].Path != "c.csv" || page.NextMarker != "" {
+		t.Errorf("❌ Unexpected second page: %+v", page)
+	}
+
+	// Tags are dropped with the file and the index is hidden from listings
+	localStorage.DeleteFile(ctx, "c.csv")
+	files, _ := localStorage.ListFiles(ctx, ".")
+	if len(files) != 3 {
+		t.Errorf("❌ Expected 3 listed files, got %v", files)
+	}
+	page, _ = localStorage.FindFilesByTags(ctx, storage.TagQuery{Tags: map[string]string{"customer": "acme"}})
+	if len(page.Files) != 2 {
+		t.Errorf("❌ Expected deleted file to leave the index, got %+v", page)
+	}
+}
+
+// 🔹 Test tag validation
+func TestValidateTags(t *testing.T) {
+	if err := storage.ValidateTags(map[string]string{"customer": "acme", "path": "a/b:c"}); err != nil {
+		t.Errorf("❌ Expected valid tags, got %v", err)
+	}
+	if err := storage.ValidateTags(map[string]string{"bad": "it's"}); err == nil {
+		t.Errorf("❌ Expected error for unsupported characters")
+	}
+}
+
+// 🔹 Test Mock Azure Storage tags
+func TestMockAzureStorageTags(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := storage.NewMockAzureStorage()
+
+	if err := mockStorage.SetTags(ctx, "missing", map[string]string{"a": "b"}); err == nil {
+		t.Errorf("❌ Expected error tagging a missing file")
+	}
+
+	mockStorage.UploadFile(ctx, "test-blob", []byte("mock data"))
+	mockStorage.SetTags(ctx, "test-blob", map[string]string{"project": "x"})
+
+	tags, err := mockStorage.GetTags(ctx, "test-blob")
+	if err != nil || tags["project"] != "x" {
+		t.Errorf("❌ Unexpected tags %v (err %v)", tags, err)
+	}
+}
+
+// 🔹 Test that tags are written with the file and an overwrite replaces them
+func TestWriteStreamReplacesTags(t *testing.T) {
+	ctx := context.Background()
+	for name, backend := range map[string]storage.StorageAdapter{
+		"local": storage.NewLocalStorage(t.TempDir()),
+		"mock":  storage.NewMockAzureStorage(),
+	} {
+		write := func(tags map[string]string) {
+			opts := storage.WriteOptions{Overwrite: true, Tags: tags}
+			if err := backend.WriteStream(ctx, "report.csv", strings.NewReader("data"), opts); err != nil {
+				t.Fatalf("❌ %s: failed to write: %v", name, err)
+			}
+		}
+
+		write(map[string]string{"customer": "acme"})
+		if tags, _ := backend.GetTags(ctx, "report.csv"); tags["customer"] != "acme" {
+			t.Errorf("❌ %s: expected tags from the write, got %v", name, tags)
+		}
+
+		write(map[string]string{"class": "legal"})
+		if tags, _ := backend.GetTags(ctx, "report.csv"); len(tags) != 1 || tags["class"] != "legal" {
+			t.Errorf("❌ %s: expected the overwrite's tags only, got %v", name, tags)
+		}
+
+		write(nil)
+		if tags, _ := backend.GetTags(ctx, "report.csv"); len(tags) != 0 {
+			t.Errorf("❌ %s: expected an untagged overwrite to clear tags, got %v", name, tags)
+		}
+		page, _ := backend.FindFilesByTags(ctx, storage.TagQuery{Tags: map[string]string{"class": "legal"}})
+		if len(page.Files) != 0 {
+			t.Errorf("❌ %s: expected cleared tags to leave the index, got %+v", name, page)
+		}
+
+		invalid := storage.WriteOptions{Overwrite: true, Tags: map[string]string{"bad": "it's"}}
+		if err := backend.WriteStream(ctx, "report.csv", strings.NewReader("data"), invalid); err == nil {
+			t.Errorf("❌ %s: expected invalid tags to reject the write", name)
+		}
+	}
+}